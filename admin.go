@@ -0,0 +1,493 @@
+package main
+
+import (
+	"bufio"
+	"data_mapping/config"
+	"data_mapping/database"
+	"data_mapping/database/migrations"
+	"data_mapping/models"
+	"data_mapping/repository"
+	"data_mapping/services"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openStore connects to a database whose schema is up to date. SQL logging
+// is turned off so that command output can be piped.
+func openStore(cfg config.Config) (repository.Store, error) {
+	db, err := database.Connect(cfg)
+	if err != nil {
+		return nil, err
+	}
+	db = db.Session(&gorm.Session{Logger: db.Logger.LogMode(logger.Silent)})
+	if err := requireMigrated(db); err != nil {
+		return nil, err
+	}
+	return repository.New(db), nil
+}
+
+// requireMigrated fails when migrations are pending.
+func requireMigrated(db *gorm.DB) error {
+	pending, err := migrations.Pending(db)
+	if err != nil {
+		return fmt.Errorf("checking schema migrations: %w", err)
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is behind by %d migration(s); run \"migrate up\" first", len(pending))
+	}
+	return nil
+}
+
+// cliActor attributes changes made from the command line to the operating
+// system user running it.
+func cliActor() services.Actor {
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	return services.Actor{User: "cli:" + name}
+}
+
+func parseID(arg, what string) (uint, error) {
+	id, err := strconv.ParseUint(arg, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s ID %q", what, arg)
+	}
+	return uint(id), nil
+}
+
+func clientCommand(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("client needs one of list, create, clone, delete or restore")
+	}
+	command, args := args[0], args[1:]
+
+	store, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "list":
+		clients, err := store.Clients().List()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tSTATUS\tRULES\tCREATED AT")
+		for _, client := range clients {
+			rules, err := store.Mappings().ListByClient(client.ID)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\n", client.ID, client.Name, client.Status, len(rules), client.CreatedAt.Format(time.RFC3339))
+		}
+		return w.Flush()
+	case "create":
+		if len(args) != 1 {
+			return errors.New("usage: client create <name>")
+		}
+		client, err := services.CreateClient(store, cliActor(), models.CreateClientRequest{Name: args[0]})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("created client %d %s\n", client.ID, client.Name)
+		return nil
+	case "clone":
+		return cloneClient(store, args)
+	case "delete":
+		if len(args) != 1 {
+			return errors.New("usage: client delete <client-id>")
+		}
+		id, err := parseID(args[0], "client")
+		if err != nil {
+			return err
+		}
+		err = services.DeleteClient(store, cliActor(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			return fmt.Errorf("client %d not found", id)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("moved client %d to the trash\n", id)
+		return nil
+	case "restore":
+		if len(args) != 1 {
+			return errors.New("usage: client restore <client-id>")
+		}
+		id, err := parseID(args[0], "client")
+		if err != nil {
+			return err
+		}
+		client, rules, err := services.RestoreClient(store, cliActor(), id)
+		if errors.Is(err, repository.ErrNotFound) {
+			return fmt.Errorf("client %d is not in the trash", id)
+		}
+		if errors.Is(err, services.ErrClientNameTaken) {
+			return fmt.Errorf("cannot restore client %d: another client is named %q", id, client.Name)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("restored client %d %s with %d rules\n", client.ID, client.Name, len(rules))
+		return nil
+	default:
+		return fmt.Errorf("unknown client command %q, expected list, create, clone, delete or restore", command)
+	}
+}
+
+func cloneClient(store repository.Store, args []string) error {
+	fs := flag.NewFlagSet("client clone", flag.ContinueOnError)
+	var req models.CloneClientRequest
+	rewrite := func(target string) func(string) error {
+		return func(value string) error {
+			from, to, ok := strings.Cut(value, "=")
+			if !ok {
+				return errors.New("expected from=to")
+			}
+			req.PathRewrites = append(req.PathRewrites, models.PathRewrite{
+				Target: target,
+				From:   splitFlagPath(from),
+				To:     splitFlagPath(to),
+			})
+			return nil
+		}
+	}
+	fs.Func("rewrite-source", "rewrite the source path prefix `from=to` (dotted, repeatable)", rewrite(services.RewriteSource))
+	fs.Func("rewrite-destination", "rewrite the destination path prefix `from=to` (dotted, repeatable)", rewrite(services.RewriteDestination))
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("usage: client clone [flags] <client-id> <new-name>")
+	}
+	sourceID, err := parseID(fs.Arg(0), "client")
+	if err != nil {
+		return err
+	}
+	req.Name = fs.Arg(1)
+
+	result, err := services.CloneClient(store, cliActor(), sourceID, req)
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("client %d not found", sourceID)
+	}
+	for _, conflict := range result.Conflicts {
+		fmt.Fprintf(os.Stderr, "%s: %s: %s\n", conflict.Severity, conflict.Path, conflict.Message)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("created client %d %s from client %d: %d rules (%d rewritten), %d layouts, %d templates\n",
+		result.Client.ID, result.Client.Name, sourceID, result.Rules, result.RewrittenRules, result.Layouts, result.Templates)
+	return nil
+}
+
+func splitFlagPath(dotted string) models.JSONStringList {
+	if dotted == "" {
+		return models.JSONStringList{}
+	}
+	return strings.Split(dotted, ".")
+}
+
+func mappingsCommand(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("mappings needs one of export or import")
+	}
+	switch args[0] {
+	case "export":
+		return exportMappings(cfg, args[1:])
+	case "import":
+		return importMappings(cfg, args[1:])
+	default:
+		return fmt.Errorf("unknown mappings command %q, expected export or import", args[0])
+	}
+}
+
+func exportMappings(cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("mappings export", flag.ContinueOnError)
+	all := fs.Bool("all", false, "export every client into --dir")
+	dir := fs.String("dir", ".", "directory for --all exports")
+	out := fs.String("out", "-", "output file for a single client, or - for standard output")
+	format := fs.String("format", services.RuleSetFormatJSON, "json or yaml")
+	notation := fs.String("notation", "array", "path notation: array or dotted")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *format != services.RuleSetFormatJSON && *format != services.RuleSetFormatYAML {
+		return fmt.Errorf("unsupported rule set format %q, expected json or yaml", *format)
+	}
+	if *notation != "array" && *notation != "dotted" {
+		return errors.New("notation must be array or dotted")
+	}
+	if *all == (fs.NArg() == 1) || fs.NArg() > 1 {
+		return errors.New("usage: mappings export [flags] <client-id> | mappings export --all [--dir dir]")
+	}
+
+	store, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	export := func(client models.Client, path string) error {
+		rules, err := store.Mappings().ListByClient(client.ID)
+		if err != nil {
+			return err
+		}
+		body, err := services.MarshalRuleSet(services.ExportRuleSet(client, rules, *notation == "dotted"), *format)
+		if err != nil {
+			return err
+		}
+		if path == "-" {
+			_, err = os.Stdout.Write(body)
+			return err
+		}
+		return os.WriteFile(path, body, 0o644)
+	}
+
+	if !*all {
+		id, err := parseID(fs.Arg(0), "client")
+		if err != nil {
+			return err
+		}
+		client, err := store.Clients().Get(id)
+		if errors.Is(err, repository.ErrNotFound) {
+			return fmt.Errorf("client %d not found", id)
+		}
+		if err != nil {
+			return err
+		}
+		return export(client, *out)
+	}
+
+	if err := os.MkdirAll(*dir, 0o755); err != nil {
+		return err
+	}
+	clients, err := store.Clients().List()
+	if err != nil {
+		return err
+	}
+	for _, client := range clients {
+		path := filepath.Join(*dir, fmt.Sprintf("client-%d-mappings.%s", client.ID, *format))
+		if err := export(client, path); err != nil {
+			return fmt.Errorf("exporting client %d: %w", client.ID, err)
+		}
+		fmt.Println(path)
+	}
+	return nil
+}
+
+func importMappings(cfg config.Config, args []string) error {
+	fs := flag.NewFlagSet("mappings import", flag.ContinueOnError)
+	mode := fs.String("mode", "merge", "merge, or replace to delete rules missing from the file")
+	dryRun := fs.Bool("dry-run", false, "report the changes without saving them")
+	format := fs.String("format", "", "json or yaml (default from the file extension)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("usage: mappings import [flags] <client-id> <file>")
+	}
+	if *mode != "merge" && *mode != "replace" {
+		return errors.New("mode must be merge or replace")
+	}
+	id, err := parseID(fs.Arg(0), "client")
+	if err != nil {
+		return err
+	}
+	path := fs.Arg(1)
+	if *format == "" {
+		*format = services.RuleSetFormatJSON
+		if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+			*format = services.RuleSetFormatYAML
+		}
+	}
+
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	specs, err := services.DecodeRuleSet(body, *format)
+	if err != nil {
+		return fmt.Errorf("invalid rule set: %w", err)
+	}
+
+	store, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	if _, err := store.Clients().Get(id); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return fmt.Errorf("client %d not found", id)
+		}
+		return err
+	}
+
+	plan, conflicts, err := services.ImportRuleSet(store, cliActor(), id, specs, *mode == "replace", *dryRun)
+	var validationErr *services.ValidationError
+	if errors.As(err, &validationErr) {
+		for _, issue := range validationErr.Issues {
+			for _, message := range issue.Errors {
+				fmt.Fprintf(os.Stderr, "rule %d (%s): %s\n", issue.Index, issue.DestinationPath, message)
+			}
+		}
+	}
+	for _, conflict := range conflicts {
+		fmt.Fprintf(os.Stderr, "%s: %s: %s\n", conflict.Severity, conflict.Path, conflict.Message)
+	}
+	if err != nil {
+		return err
+	}
+
+	verb := "applied"
+	if *dryRun {
+		verb = "would apply"
+	}
+	fmt.Printf("%s %d added, %d updated, %d deleted, %d unchanged\n", verb, len(plan.Add), len(plan.Update), len(plan.Delete), plan.Unchanged)
+	return nil
+}
+
+func userCommand(cfg config.Config, args []string) error {
+	if len(args) != 2 || (args[0] != "add" && args[0] != "reset") {
+		return errors.New("usage: user add|reset <username>; the password is read from standard input")
+	}
+	command, username := args[0], args[1]
+
+	store, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	password, err := readPassword()
+	if err != nil {
+		return err
+	}
+
+	if command == "add" {
+		if _, err := services.AddUser(store.Users(), username, password); err != nil {
+			return err
+		}
+		fmt.Printf("added user %s\n", username)
+		return nil
+	}
+	err = services.ResetPassword(store.Users(), username, password)
+	if errors.Is(err, repository.ErrNotFound) {
+		return fmt.Errorf("user %s not found", username)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("reset the password of %s\n", username)
+	return nil
+}
+
+// readPassword reads the first line of standard input, so that passwords do
+// not appear in the process list or shell history.
+func readPassword() (string, error) {
+	if info, err := os.Stdin.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		fmt.Fprint(os.Stderr, "Password (input is shown): ")
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", errors.New("no password on standard input")
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func logsCommand(cfg config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "prune" {
+		return errors.New("usage: logs prune [--days n] [--archive]")
+	}
+	fs := flag.NewFlagSet("logs prune", flag.ContinueOnError)
+	days := cfg.LogRetentionDays
+	if days <= 0 {
+		days = 30
+	}
+	fs.IntVar(&days, "days", days, "remove logs older than this many days")
+	archive := fs.Bool("archive", cfg.LogRetentionMode == "archive", "move the logs to archived_logs instead of deleting them")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if days < 1 {
+		return errors.New("--days must be at least 1")
+	}
+
+	store, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().UTC().AddDate(0, 0, -days)
+	removed, err := store.Logs().Prune(cutoff, *archive)
+	if err != nil {
+		return err
+	}
+	verb := "deleted"
+	if *archive {
+		verb = "archived"
+	}
+	fmt.Printf("%s %d log entries older than %s\n", verb, removed, cutoff.Format(time.RFC3339))
+	return nil
+}
+
+func trashCommand(cfg config.Config, args []string) error {
+	if len(args) == 0 || (args[0] != "list" && args[0] != "purge") {
+		return errors.New("usage: trash list | trash purge [--days n]")
+	}
+	if args[0] == "list" {
+		store, err := openStore(cfg)
+		if err != nil {
+			return err
+		}
+		clients, err := store.Clients().ListDeleted()
+		if err != nil {
+			return err
+		}
+		rules, err := store.Mappings().ListDeleted()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "TYPE\tID\tCLIENT\tNAME\tDELETED AT")
+		for _, client := range clients {
+			fmt.Fprintf(w, "client\t%d\t%d\t%s\t%s\n", client.ID, client.ID, client.Name, client.DeletedAt.Time.Format(time.RFC3339))
+		}
+		for _, rule := range rules {
+			fmt.Fprintf(w, "mapping\t%d\t%d\t%s\t%s\n", rule.ID, rule.ClientID, rule.DestinationPath.Dotted(), rule.DeletedAt.Time.Format(time.RFC3339))
+		}
+		return w.Flush()
+	}
+
+	fs := flag.NewFlagSet("trash purge", flag.ContinueOnError)
+	days := cfg.TrashRetentionDays
+	if days <= 0 {
+		days = 30
+	}
+	fs.IntVar(&days, "days", days, "remove records deleted more than this many days ago")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if days < 0 {
+		return errors.New("--days must not be negative")
+	}
+
+	store, err := openStore(cfg)
+	if err != nil {
+		return err
+	}
+	cutoff := time.Now().UTC().AddDate(0, 0, -days)
+	clients, rules, err := services.PurgeTrash(store, cutoff)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("purged %d clients and %d mapping rules deleted before %s\n", clients, rules, cutoff.Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,38 @@
+package app
+
+import (
+	"context"
+	"data_mapping/config"
+	"data_mapping/jobs"
+	"data_mapping/repository"
+
+	"gorm.io/gorm"
+)
+
+// App holds the dependencies shared by the HTTP handlers and background jobs.
+type App struct {
+	Config      config.Config
+	DB          *gorm.DB
+	Store       repository.Store
+	BatchRunner *jobs.BatchRunner
+}
+
+// New builds an App around an open database. Nothing runs in the background
+// until Start is called.
+func New(cfg config.Config, db *gorm.DB) *App {
+	store := repository.New(db)
+	return &App{
+		Config:      cfg,
+		DB:          db,
+		Store:       store,
+		BatchRunner: jobs.NewBatchRunner(store, cfg.BatchJobWorkers, cfg.BatchRecordWorkers),
+	}
+}
+
+// Start launches the batch job workers, request log retention and the trash
+// purge. They run until ctx is done.
+func (a *App) Start(ctx context.Context) {
+	a.BatchRunner.Start(ctx)
+	jobs.StartLogRetention(ctx, a.Store.Logs(), a.Config)
+	jobs.StartTrashPurge(ctx, a.Store, a.Config)
+}
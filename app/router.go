@@ -0,0 +1,106 @@
+package app
+
+import (
+	"data_mapping/handlers"
+	"data_mapping/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// NewRouter builds the HTTP routes of the service.
+func NewRouter(a *App) *gin.Engine {
+	store := a.Store
+	cfg := a.Config
+	secret := []byte(cfg.JWTSecret)
+
+	router := gin.New()
+
+	router.Use(gin.Logger())
+	router.Use(middleware.RequestIDMiddleware())
+	router.Use(middleware.ErrorHandlerMiddleware())
+	router.Use(middleware.SecurityMiddleware())
+	router.Use(middleware.CORSMiddleware())
+	router.Use(middleware.LoggingMiddleware(store.Logs(), cfg.LogExcludePaths))
+
+	router.GET("/health", func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"status":  "healthy",
+			"service": "Data Mapping API",
+			"version": "1.0.0",
+		})
+	})
+
+	router.GET("/", func(c *gin.Context) {
+		c.JSON(200, gin.H{
+			"message": "Welcome to the Data Mapping API",
+			"version": "1.0.0",
+			"docs":    "/docs",
+		})
+	})
+
+	router.POST("/login", handlers.LoginHandler(secret, store.Users()))
+
+	// Protected routes
+	auth := router.Group("/")
+	auth.Use(handlers.JWTAuthMiddleware(secret))
+	{
+		// Client management
+		auth.POST("/clients", handlers.CreateClient(store))
+		auth.GET("/clients", handlers.ListClients(store))
+		auth.GET("/clients/:client_id", handlers.GetClient(store))
+		auth.PATCH("/clients/:client_id", handlers.UpdateClient(store))
+		auth.DELETE("/clients/:client_id", handlers.DeleteClient(store))
+		auth.POST("/clients/:client_id/clone", handlers.CloneClient(store))
+		auth.POST("/clients/:client_id/restore", handlers.RestoreClient(store))
+		auth.POST("/clients/:client_id/mappings", handlers.CreateMappings(store))
+		auth.GET("/clients/:client_id/mappings", handlers.GetMappings(store))
+		auth.DELETE("/mappings/:mapping_id", handlers.DeleteMappings(store))
+		auth.POST("/mappings/:mapping_id/restore", handlers.RestoreMapping(store))
+		auth.GET("/trash", handlers.ListTrash(store, cfg.TrashRetentionDays))
+		auth.GET("/clients/:client_id/mappings/export", handlers.ExportMappings(store))
+		auth.POST("/clients/:client_id/mappings/import", handlers.ImportMappings(store))
+		auth.POST("/clients/:client_id/mappings/lint", handlers.LintMappings(store))
+		auth.POST("/clients/:client_id/mappings/suggest", handlers.SuggestMappings(store))
+		auth.GET("/clients/:client_id/mappings/effective", handlers.GetEffectiveMappings(store))
+		auth.GET("/clients/:client_id/templates", handlers.GetClientTemplates(store))
+		auth.PUT("/clients/:client_id/templates", handlers.SetClientTemplates(store))
+
+		auth.GET("/templates", handlers.ListTemplates(store))
+		auth.POST("/templates", handlers.CreateTemplate(store))
+		auth.GET("/templates/:template_id", handlers.GetTemplate(store))
+		auth.PUT("/templates/:template_id", handlers.UpdateTemplate(store))
+		auth.DELETE("/templates/:template_id", handlers.DeleteTemplate(store))
+
+		// Input schemas
+		auth.POST("/clients/:client_id/schema/infer", handlers.InferSchema(store))
+		auth.GET("/clients/:client_id/schema", handlers.GetSchema(store))
+
+		auth.POST("/clients/:client_id/transform", handlers.UnifiedTransformHandler(store, cfg))
+		auth.POST("/clients/:client_id/transform/reverse", handlers.ReverseTransformHandler(store))
+
+		// Output layouts
+		auth.GET("/clients/:client_id/layouts/:format", handlers.GetLayout(store))
+		auth.PUT("/clients/:client_id/layouts/:format", handlers.PutLayout(store))
+		auth.DELETE("/clients/:client_id/layouts/:format", handlers.DeleteLayout(store))
+
+		// Transformation run history
+		auth.GET("/clients/:client_id/runs", handlers.ListClientRuns(store))
+		auth.GET("/runs/:run_id", handlers.GetRun(store, cfg))
+		auth.POST("/runs/:run_id/replay", handlers.ReplayRun(store, cfg))
+
+		// Batch transformation jobs
+		auth.POST("/clients/:client_id/jobs", handlers.CreateBatchJob(store, a.BatchRunner, cfg))
+		auth.GET("/clients/:client_id/jobs", handlers.ListClientJobs(store))
+		auth.GET("/jobs/:job_id", handlers.GetBatchJob(store))
+		auth.GET("/jobs/:job_id/output", handlers.DownloadBatchJobOutput(store))
+		auth.GET("/jobs/:job_id/errors", handlers.DownloadBatchJobErrors(store))
+
+		// Audit trail
+		auth.GET("/audit", handlers.ListAuditEvents(store))
+
+		// Request logs
+		auth.GET("/logs", handlers.ListLogs(store))
+	}
+
+	return router
+}
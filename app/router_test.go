@@ -0,0 +1,75 @@
+package app
+
+import (
+	"data_mapping/config"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newDryRunDB returns a Postgres handle that builds statements without
+// connecting, so routing and request validation can be tested offline.
+func newDryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(postgres.Open("host=localhost dbname=test"), &gorm.Config{
+		DryRun:                 true,
+		DisableAutomaticPing:   true,
+		SkipDefaultTransaction: true,
+		Logger:                 logger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestNewRouter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := NewRouter(New(config.Config{JWTSecret: "test-secret"}, newDryRunDB(t)))
+
+	do := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodGet, "/health", "", ""); rec.Code != http.StatusOK {
+		t.Errorf("GET /health: status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if rec := do(http.MethodGet, "/clients", "", ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /clients without token: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if rec := do(http.MethodPost, "/login", "", `{"username":"admin","password":"wrong"}`); rec.Code != http.StatusUnauthorized {
+		t.Errorf("POST /login with a wrong password: status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+
+	rec := do(http.MethodPost, "/login", "", `{"username":"admin","password":"password"}`)
+	var login struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &login); err != nil || login.Token == "" {
+		t.Fatalf("POST /login: status %d, body %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := do(http.MethodGet, "/clients", login.Token, ""); rec.Code != http.StatusOK {
+		t.Errorf("GET /clients: status = %d, body %s", rec.Code, rec.Body.String())
+	}
+	if rec := do(http.MethodPost, "/clients", login.Token, `{}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("POST /clients without a name: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+	if rec := do(http.MethodDelete, "/clients/1/layouts/xml", login.Token, ""); rec.Code == http.StatusNotFound && strings.Contains(rec.Body.String(), "page not found") {
+		t.Errorf("DELETE /clients/1/layouts/xml is not routed")
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"data_mapping/models"
+	"data_mapping/utils"
+	"flag"
+	"fmt"
+	"os"
+)
+
+func runValidate(args []string) error {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	rulesPath := fs.String("rules", "", "JSON file of mapping rules")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	rules, err := loadRules(*rulesPath)
+	if err != nil {
+		return err
+	}
+	if !reportValidation(rules) {
+		return errFailed
+	}
+	fmt.Printf("%d rules are valid\n", len(rules))
+	return nil
+}
+
+// reportValidation prints the problems that would make the mappings endpoint
+// reject rules: invalid rules and conflicts with error severity. Conflict
+// warnings are printed too. It reports whether the rules would be accepted.
+func reportValidation(rules []models.MappingRule) bool {
+	ok := true
+	for _, issue := range utils.ValidateMappingRules(rules) {
+		for _, message := range issue.Errors {
+			fmt.Fprintf(os.Stderr, "rule %d (%s): error: %s\n", issue.Index, issue.DestinationPath, message)
+		}
+		ok = false
+	}
+	for _, conflict := range utils.AnalyzeRuleConflicts(rules) {
+		fmt.Fprintf(os.Stderr, "rules %v (%s): %s: %s\n", conflict.Rules, conflict.Path, conflict.Severity, conflict.Message)
+		if conflict.Severity == utils.SeverityError {
+			ok = false
+		}
+	}
+	return ok
+}
+
+func runLint(args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ContinueOnError)
+	rulesPath := fs.String("rules", "", "JSON file of mapping rules")
+	strict := fs.Bool("strict", false, "fail on warnings as well as errors")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	rules, err := loadRules(*rulesPath)
+	if err != nil {
+		return err
+	}
+
+	var errorCount, warningCount int
+	count := func(severity string) {
+		if severity == utils.SeverityError {
+			errorCount++
+		} else {
+			warningCount++
+		}
+	}
+	for _, issue := range utils.LintRules(rules) {
+		fmt.Printf("rule %d (%s): %s: %s: %s\n", issue.Rule, issue.DestinationPath, issue.Severity, issue.Code, issue.Message)
+		count(issue.Severity)
+	}
+	for _, conflict := range utils.AnalyzeRuleConflicts(rules) {
+		fmt.Printf("rules %v (%s): %s: %s: %s\n", conflict.Rules, conflict.Path, conflict.Severity, conflict.Type, conflict.Message)
+		count(conflict.Severity)
+	}
+
+	fmt.Printf("%d rules, %d errors, %d warnings\n", len(rules), errorCount, warningCount)
+	if errorCount > 0 || (*strict && warningCount > 0) {
+		return errFailed
+	}
+	return nil
+}
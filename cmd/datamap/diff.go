@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"data_mapping/models"
+	"data_mapping/utils"
+	"flag"
+	"fmt"
+)
+
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	in := fs.String("in", "", "input file to transform with both rule sets")
+	inFormat := fs.String("in-format", "", "input format: json, ndjson or csv (default from the --in extension)")
+	columnTypes := fs.String("column-types", "", "CSV input column types, e.g. amount:number,active:boolean")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: datamap diff [--in input] old-rules.json new-rules.json")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		fs.Usage()
+		return errUsage
+	}
+	oldRules, err := loadRules(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	newRules, err := loadRules(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	changed := printRuleChanges(oldRules, newRules)
+
+	if *in != "" {
+		format := *inFormat
+		if format == "" {
+			format = formatFromExtension(*in)
+		}
+		opts, err := csvOptions(",", *columnTypes, "")
+		if err != nil {
+			return err
+		}
+		records, err := readRecords(*in, format, opts)
+		if err != nil {
+			return err
+		}
+		if printOutputChanges(records, oldRules, newRules) {
+			changed = true
+		}
+	}
+
+	if changed {
+		return errFailed
+	}
+	fmt.Println("no differences")
+	return nil
+}
+
+// printRuleChanges prints the rules added, removed and changed between two
+// rule sets, matching rules the way an import does, and reports whether
+// there were any.
+func printRuleChanges(oldRules, newRules []models.MappingRule) bool {
+	// Rules read from files have no IDs; PlanMappingChanges tells existing
+	// rules apart by ID.
+	existing := make([]models.MappingRule, len(oldRules))
+	for i, rule := range oldRules {
+		rule.ID = uint(i + 1)
+		existing[i] = rule
+	}
+	plan := utils.PlanMappingChanges(existing, newRules, true)
+
+	for _, rule := range plan.Add {
+		fmt.Printf("+ %s\n", utils.RuleKey(rule))
+	}
+	for _, rule := range plan.Delete {
+		fmt.Printf("- %s\n", utils.RuleKey(rule))
+	}
+	for _, update := range plan.Update {
+		fmt.Printf("~ %s\n", utils.RuleKey(update.Before))
+		before, _ := decodeJSON(models.NewMappingRuleSpec(update.Before))
+		after, _ := decodeJSON(models.NewMappingRuleSpec(update.After))
+		for _, diff := range utils.DiffJSON(before, after) {
+			fmt.Printf("    %s\n", describeChange(diff))
+		}
+	}
+	return len(plan.Add)+len(plan.Delete)+len(plan.Update) > 0
+}
+
+// printOutputChanges transforms every record with both rule sets and prints
+// where the outputs differ. It reports whether any did.
+func printOutputChanges(records []map[string]interface{}, oldRules, newRules []models.MappingRule) bool {
+	changed := false
+	for i, record := range records {
+		before, oldErr := transformRecord(record, oldRules)
+		after, newErr := transformRecord(record, newRules)
+		if oldErr != nil || newErr != nil {
+			if fmt.Sprint(oldErr) != fmt.Sprint(newErr) {
+				fmt.Printf("record %d: error %v -> %v\n", i, oldErr, newErr)
+				changed = true
+			}
+			continue
+		}
+		diffs := utils.DiffJSON(before, after)
+		if len(diffs) == 0 {
+			continue
+		}
+		changed = true
+		fmt.Printf("record %d:\n", i)
+		for _, diff := range diffs {
+			fmt.Printf("    %s\n", describeChange(diff))
+		}
+	}
+	return changed
+}
+
+func transformRecord(record map[string]interface{}, rules []models.MappingRule) (interface{}, error) {
+	output, err := utils.Transform(record, rules)
+	if err != nil {
+		return nil, err
+	}
+	return decodeJSON(output)
+}
+
+// readRecords reads every record of an input file. A JSON file may hold a
+// single object or an array of objects.
+func readRecords(path, format string, opts utils.CSVOptions) ([]map[string]interface{}, error) {
+	input, err := openInput(path)
+	if err != nil {
+		return nil, err
+	}
+	defer input.Close()
+
+	var decode utils.RecordDecoder
+	switch format {
+	case formatCSV:
+		decode = utils.NewCSVDecoder(input, opts)
+	case formatNDJSON:
+		decode = utils.NewRecordDecoder(input, utils.RecordFormatNDJSON)
+	case formatJSON:
+		br := bufio.NewReader(input)
+		detected, err := utils.DetectRecordFormat(br)
+		if err != nil {
+			return nil, fmt.Errorf("reading input: %v", err)
+		}
+		if detected != utils.RecordFormatJSONArray {
+			record, err := readObject(br)
+			if err != nil {
+				return nil, err
+			}
+			return []map[string]interface{}{record}, nil
+		}
+		decode = utils.NewRecordDecoder(br, detected)
+	default:
+		return nil, fmt.Errorf("unknown input format %q, expected json, ndjson or csv", format)
+	}
+
+	var records []map[string]interface{}
+	err = decode(func(index int, record map[string]interface{}, err error) error {
+		if err != nil {
+			return fmt.Errorf("record %d: %v", index, err)
+		}
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+func describeChange(diff utils.JSONDiff) string {
+	switch diff.Op {
+	case utils.DiffAdded:
+		return fmt.Sprintf("%s added: %s", diff.Path, compactJSON(diff.After))
+	case utils.DiffRemoved:
+		return fmt.Sprintf("%s removed: %s", diff.Path, compactJSON(diff.Before))
+	default:
+		return fmt.Sprintf("%s: %s -> %s", diff.Path, compactJSON(diff.Before), compactJSON(diff.After))
+	}
+}
@@ -0,0 +1,116 @@
+// Command datamap applies mapping rules to files without the HTTP server and
+// checks rule sets, so rule authors can iterate locally and CI can gate
+// changes to rule repositories. Rules are read in the JSON format accepted by
+// POST /clients/:client_id/mappings.
+package main
+
+import (
+	"data_mapping/models"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+const usage = `Usage: datamap <command> [flags]
+
+Commands:
+  transform  apply rules to a JSON, NDJSON or CSV file
+  validate   check rules the way the mappings endpoint does
+  lint       statically check expressions and find dead rules
+  test       run golden cases against the rules
+  diff       compare two rule sets and, with --in, their output
+
+Run "datamap <command> -h" for the flags of a command.
+`
+
+// errFailed reports that a command ran and found problems it already
+// printed. It exits with status 1 without another message.
+var errFailed = errors.New("failed")
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	commands := map[string]func([]string) error{
+		"transform": runTransform,
+		"validate":  runValidate,
+		"lint":      runLint,
+		"test":      runTest,
+		"diff":      runDiff,
+	}
+	command, ok := commands[os.Args[1]]
+	if !ok {
+		if os.Args[1] == "help" || os.Args[1] == "-h" || os.Args[1] == "--help" {
+			fmt.Print(usage)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "datamap: unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	err := command(os.Args[2:])
+	switch {
+	case err == nil:
+	case errors.Is(err, flag.ErrHelp):
+	case errors.Is(err, errUsage):
+		os.Exit(2)
+	case errors.Is(err, errFailed):
+		os.Exit(1)
+	default:
+		fmt.Fprintf(os.Stderr, "datamap: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// errUsage reports invalid flags, already described by the flag package.
+var errUsage = errors.New("usage")
+
+// parseFlags parses args and turns flag errors into errUsage.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	return nil
+}
+
+// loadRules reads a JSON array of mapping rules. Paths may be arrays or
+// dotted strings, as in the API.
+func loadRules(path string) ([]models.MappingRule, error) {
+	if path == "" {
+		return nil, errors.New("--rules is required")
+	}
+	data, err := readInput(path)
+	if err != nil {
+		return nil, err
+	}
+	var rules []models.MappingRule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return rules, nil
+}
+
+// readInput reads a whole file, or standard input when path is "-".
+func readInput(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// compactJSON formats a value for one-line messages.
+func compactJSON(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"data_mapping/models"
+	"data_mapping/utils"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// testCase is a golden case: transforming Input must produce Expected.
+type testCase struct {
+	Name     string                 `json:"name"`
+	Input    map[string]interface{} `json:"input"`
+	Expected map[string]interface{} `json:"expected"`
+}
+
+func runTest(args []string) error {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	rulesPath := fs.String("rules", "", "JSON file of mapping rules")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: datamap test --rules rules.json case.json|dir ...")
+		fs.PrintDefaults()
+	}
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New("no test cases given")
+	}
+	rules, err := loadRules(*rulesPath)
+	if err != nil {
+		return err
+	}
+
+	files, err := caseFiles(fs.Args())
+	if err != nil {
+		return err
+	}
+	var passed, failed int
+	for _, file := range files {
+		cases, err := loadCases(file)
+		if err != nil {
+			return err
+		}
+		for i, tc := range cases {
+			name := tc.Name
+			if name == "" {
+				name = fmt.Sprintf("case %d", i)
+			}
+			diffs, err := runCase(tc, rules)
+			switch {
+			case err != nil:
+				fmt.Printf("FAIL %s: %s: %v\n", file, name, err)
+				failed++
+			case len(diffs) > 0:
+				fmt.Printf("FAIL %s: %s\n", file, name)
+				for _, diff := range diffs {
+					fmt.Printf("    %s\n", describeMismatch(diff))
+				}
+				failed++
+			default:
+				fmt.Printf("PASS %s: %s\n", file, name)
+				passed++
+			}
+		}
+	}
+
+	fmt.Printf("%d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		return errFailed
+	}
+	return nil
+}
+
+// runCase transforms the case input and compares the output with the
+// expected document.
+func runCase(tc testCase, rules []models.MappingRule) ([]utils.JSONDiff, error) {
+	if tc.Input == nil {
+		return nil, errors.New("case has no input")
+	}
+	output, err := utils.Transform(tc.Input, rules)
+	if err != nil {
+		return nil, err
+	}
+	// Round trip the output so numbers compare as they would once written.
+	actual, err := decodeJSON(output)
+	if err != nil {
+		return nil, err
+	}
+	expected := tc.Expected
+	if expected == nil {
+		expected = map[string]interface{}{}
+	}
+	return utils.DiffJSON(expected, actual), nil
+}
+
+// describeMismatch explains a difference between the expected document and
+// the output.
+func describeMismatch(diff utils.JSONDiff) string {
+	switch diff.Op {
+	case utils.DiffAdded:
+		return fmt.Sprintf("%s: unexpected %s", diff.Path, compactJSON(diff.After))
+	case utils.DiffRemoved:
+		return fmt.Sprintf("%s: missing, expected %s", diff.Path, compactJSON(diff.Before))
+	default:
+		return fmt.Sprintf("%s: expected %s, got %s", diff.Path, compactJSON(diff.Before), compactJSON(diff.After))
+	}
+}
+
+// caseFiles expands directories into the .json files they contain.
+func caseFiles(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		matches, err := filepath.Glob(filepath.Join(path, "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(matches)
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// loadCases reads a file holding one case or an array of cases.
+func loadCases(path string) ([]testCase, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cases []testCase
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(data, &cases)
+	} else {
+		var tc testCase
+		err = json.Unmarshal(data, &tc)
+		cases = append(cases, tc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return cases, nil
+}
+
+// decodeJSON returns value as encoding/json would decode it.
+func decodeJSON(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var decoded interface{}
+	err = json.Unmarshal(data, &decoded)
+	return decoded, err
+}
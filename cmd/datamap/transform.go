@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bufio"
+	"data_mapping/models"
+	"data_mapping/utils"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	formatJSON   = "json"
+	formatNDJSON = "ndjson"
+	formatCSV    = "csv"
+)
+
+func runTransform(args []string) error {
+	fs := flag.NewFlagSet("transform", flag.ContinueOnError)
+	rulesPath := fs.String("rules", "", "JSON file of mapping rules")
+	in := fs.String("in", "-", "input file, or - for standard input")
+	out := fs.String("out", "-", "output file, or - for standard output")
+	inFormat := fs.String("in-format", "", "input format: json, ndjson or csv (default from the --in extension)")
+	outFormat := fs.String("out-format", "", "output format: json, ndjson or csv (default matches the input)")
+	delimiter := fs.String("delimiter", ",", `CSV delimiter, or "tab"`)
+	columnTypes := fs.String("column-types", "", "CSV input column types, e.g. amount:number,active:boolean")
+	columns := fs.String("columns", "", "comma separated CSV output columns (default: rule destinations)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	rules, err := loadRules(*rulesPath)
+	if err != nil {
+		return err
+	}
+	if !reportValidation(rules) {
+		return errFailed
+	}
+
+	format := *inFormat
+	if format == "" {
+		format = formatFromExtension(*in)
+	}
+	opts, err := csvOptions(*delimiter, *columnTypes, *columns)
+	if err != nil {
+		return err
+	}
+
+	input, err := openInput(*in)
+	if err != nil {
+		return err
+	}
+	defer input.Close()
+	output, err := openOutput(*out)
+	if err != nil {
+		return err
+	}
+
+	failed, err := transformInput(input, output, rules, format, *outFormat, opts)
+	if closeErr := output.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		fmt.Fprintf(os.Stderr, "%d record(s) failed\n", failed)
+		return errFailed
+	}
+	return nil
+}
+
+// transformInput transforms input into output and returns the number of
+// records that failed. A JSON file holding a single object is transformed as
+// one record and, unless another output format is asked for, written as an
+// indented object.
+func transformInput(input io.Reader, output io.Writer, rules []models.MappingRule, format, outFormat string, opts utils.CSVOptions) (int, error) {
+	var decode utils.RecordDecoder
+	switch format {
+	case formatCSV:
+		decode = utils.NewCSVDecoder(input, opts)
+	case formatNDJSON:
+		decode = utils.NewRecordDecoder(input, utils.RecordFormatNDJSON)
+	case formatJSON:
+		br := bufio.NewReader(input)
+		detected, err := utils.DetectRecordFormat(br)
+		if err != nil {
+			return 0, fmt.Errorf("reading input: %v", err)
+		}
+		if detected == utils.RecordFormatJSONArray {
+			decode = utils.NewRecordDecoder(br, detected)
+			break
+		}
+		record, err := readObject(br)
+		if err != nil {
+			return 0, err
+		}
+		if outFormat == "" || outFormat == formatJSON {
+			return 0, writeObject(output, record, rules)
+		}
+		decode = func(fn utils.RecordFunc) error { return fn(0, record, nil) }
+	default:
+		return 0, fmt.Errorf("unknown input format %q, expected json, ndjson or csv", format)
+	}
+
+	if outFormat == "" {
+		outFormat = format
+	}
+	var writer utils.RecordWriter
+	switch outFormat {
+	case formatJSON:
+		writer = utils.NewJSONArrayRecordWriter(output)
+	case formatNDJSON:
+		writer = utils.NewNDJSONRecordWriter(output)
+	case formatCSV:
+		writer = utils.NewCSVRecordWriter(output, rules, opts)
+	default:
+		return 0, fmt.Errorf("unknown output format %q, expected json, ndjson or csv", outFormat)
+	}
+
+	counter := &failureCounter{RecordWriter: writer}
+	err := utils.TransformRecords(decode, counter, rules)
+	return counter.failed, err
+}
+
+// readObject reads a JSON object holding one record. Like the transform
+// endpoint, it accepts the record wrapped as {"input_data": {...}}.
+func readObject(r io.Reader) (map[string]interface{}, error) {
+	var value interface{}
+	if err := json.NewDecoder(r).Decode(&value); err != nil {
+		return nil, fmt.Errorf("reading input: %v", err)
+	}
+	if _, ok := value.(map[string]interface{}); !ok {
+		return nil, errors.New("input must be a JSON object or an array of objects")
+	}
+	records, err := utils.SampleRecords([]interface{}{value})
+	if err != nil {
+		return nil, err
+	}
+	return records[0], nil
+}
+
+// writeObject transforms one record and writes it as an indented object.
+func writeObject(w io.Writer, record map[string]interface{}, rules []models.MappingRule) error {
+	output, err := utils.Transform(record, rules)
+	if err != nil {
+		return err
+	}
+	for _, field := range utils.MissingRequiredFields(output, rules) {
+		fmt.Fprintf(os.Stderr, "warning: required field %s is missing\n", field)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(output)
+}
+
+// failureCounter counts the records a RecordWriter reports as failed.
+type failureCounter struct {
+	utils.RecordWriter
+	failed int
+}
+
+func (c *failureCounter) WriteError(index int, err error) error {
+	c.failed++
+	return c.RecordWriter.WriteError(index, err)
+}
+
+func formatFromExtension(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		return formatCSV
+	case ".ndjson", ".jsonl":
+		return formatNDJSON
+	default:
+		return formatJSON
+	}
+}
+
+func csvOptions(delimiter, columnTypes, columns string) (utils.CSVOptions, error) {
+	opts := utils.DefaultCSVOptions()
+	switch {
+	case delimiter == "tab" || delimiter == `\t`:
+		opts.Delimiter = '\t'
+	case len([]rune(delimiter)) == 1:
+		opts.Delimiter = []rune(delimiter)[0]
+	default:
+		return opts, errors.New("--delimiter must be a single character or \"tab\"")
+	}
+	types, err := utils.ParseCSVColumnTypes(columnTypes)
+	if err != nil {
+		return opts, err
+	}
+	opts.ColumnTypes = types
+	for _, column := range strings.Split(columns, ",") {
+		if column = strings.TrimSpace(column); column != "" {
+			opts.Columns = append(opts.Columns, column)
+		}
+	}
+	return opts, nil
+}
+
+func openInput(path string) (io.ReadCloser, error) {
+	if path == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	return os.Open(path)
+}
+
+func openOutput(path string) (io.WriteCloser, error) {
+	if path == "-" {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+	return os.Create(path)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
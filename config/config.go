@@ -3,12 +3,16 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
 	ServerPort      string
+	DBDriver        string
+	SQLitePath      string
 	DatabaseURL     string
 	JWTSecret       string
 	LogLevel        string
@@ -20,18 +24,39 @@ type Config struct {
 	DBName          string
 	DBPort          string
 	DevelopmentMode bool
-}
 
-var AppConfig Config
+	// Request log retention
+	LogRetentionDays int
+	LogRetentionMode string
+	LogExcludePaths  []string
+	LogPruneInterval int
+
+	// Deleted clients and mapping rules
+	TrashRetentionDays int
+	TrashPurgeInterval int
+
+	// Transformation run history
+	RecordTransformRuns bool
+	RunStoreBodies      bool
+	RunEncryptionKey    string
+
+	// Batch transformation jobs
+	BatchJobWorkers    int
+	BatchRecordWorkers int
+	BatchMaxUploadMB   int
+}
 
-func init() {
-	// Load .env file if it exists
+// Load reads the configuration from the environment, after loading a .env
+// file from the working directory if there is one.
+func Load() Config {
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found, using environment variables")
 	}
 
-	AppConfig = Config{
+	return Config{
 		ServerPort:      getEnv("SERVER_PORT", "8080"),
+		DBDriver:        getEnv("DB_DRIVER", "postgres"),
+		SQLitePath:      getEnv("SQLITE_PATH", "data_mapping.db"),
 		DatabaseURL:     getEnv("DATABASE_URL", ""),
 		JWTSecret:       getEnv("JWT_SECRET", "your-secret-key"),
 		LogLevel:        getEnv("LOG_LEVEL", "info"),
@@ -43,6 +68,22 @@ func init() {
 		DBName:          getEnv("DB_NAME", "data_mapping"),
 		DBPort:          getEnv("DB_PORT", "5432"),
 		DevelopmentMode: getEnv("DEVELOPMENT_MODE", "false") == "true",
+
+		LogRetentionDays: getEnvInt("LOG_RETENTION_DAYS", 0),
+		LogRetentionMode: getEnv("LOG_RETENTION_MODE", "delete"),
+		LogExcludePaths:  getEnvList("LOG_EXCLUDE_PATHS", "/health"),
+		LogPruneInterval: getEnvInt("LOG_PRUNE_INTERVAL_MINUTES", 60),
+
+		TrashRetentionDays: getEnvInt("TRASH_RETENTION_DAYS", 30),
+		TrashPurgeInterval: getEnvInt("TRASH_PURGE_INTERVAL_MINUTES", 60),
+
+		RecordTransformRuns: getEnv("RECORD_TRANSFORM_RUNS", "false") == "true",
+		RunStoreBodies:      getEnv("RUN_STORE_BODIES", "false") == "true",
+		RunEncryptionKey:    getEnv("RUN_ENCRYPTION_KEY", ""),
+
+		BatchJobWorkers:    getEnvInt("BATCH_JOB_WORKERS", 2),
+		BatchRecordWorkers: getEnvInt("BATCH_RECORD_WORKERS", 4),
+		BatchMaxUploadMB:   getEnvInt("BATCH_MAX_UPLOAD_MB", 200),
 	}
 }
 
@@ -52,3 +93,33 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Invalid value for %s: %q, using default %d", key, value, defaultValue)
+		return defaultValue
+	}
+	return i
+}
+
+// getEnvList reads a comma separated list, dropping empty entries. The
+// default applies only when the variable is unset, so setting it empty gives
+// an empty list.
+func getEnvList(key, defaultValue string) []string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		value = defaultValue
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -2,89 +2,86 @@ package database
 
 import (
 	"data_mapping/config"
-	"data_mapping/database/migrations"
-	"data_mapping/models"
 	"fmt"
 	"log"
 	"time"
 
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
-var DB *gorm.DB
+// Connect opens the database described by cfg, retrying while it comes up.
+// DBDriver selects Postgres or a single file SQLite database.
+func Connect(cfg config.Config) (*gorm.DB, error) {
+	if cfg.DBDriver != "postgres" && cfg.DBDriver != "sqlite" {
+		return nil, fmt.Errorf("unsupported database driver %q, expected postgres or sqlite", cfg.DBDriver)
+	}
 
-func init() {
-	// Try to connect with retries
 	var db *gorm.DB
 	var err error
-	
+
 	maxRetries := 5
 	retryDelay := time.Second * 3
-	
+
 	for i := 0; i < maxRetries; i++ {
-		db, err = connectDB()
+		db, err = connectDB(cfg)
 		if err == nil {
 			break
 		}
-		
+
 		log.Printf("Failed to connect to database (attempt %d/%d): %v", i+1, maxRetries, err)
 		if i < maxRetries-1 {
 			log.Printf("Retrying in %v...", retryDelay)
 			time.Sleep(retryDelay)
 		}
 	}
-	
+
 	if err != nil {
-		log.Fatal("Failed to connect to database after multiple attempts:", err)
+		return nil, fmt.Errorf("failed to connect to database after %d attempts: %w", maxRetries, err)
 	}
-	
+
 	log.Println("Successfully connected to database")
-	DB = db
-	
-	// Run migrations
-	log.Println("Running auto migrations...")
-	err = DB.AutoMigrate(&models.Log{}, &models.Client{}, &models.MappingRule{})
-	if err != nil {
-		log.Printf("Warning: Failed to run auto migrations: %v", err)
+	return db, nil
+}
+
+func connectDB(cfg config.Config) (*gorm.DB, error) {
+	gormConfig := &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Info),
+		NowFunc: func() time.Time {
+			return time.Now().UTC() // Use UTC for all timestamps
+		},
 	}
 
-	// Run custom migrations
-	if err := migrations.AddRequiredFieldsToMappingRules(DB); err != nil {
-		log.Printf("Warning: Failed to run custom migrations: %v", err)
+	if cfg.DBDriver == "sqlite" {
+		log.Printf("Opening SQLite database %s", cfg.SQLitePath)
+		// Foreign keys are off by default in SQLite; WAL and a busy timeout
+		// let the batch workers write while requests are logged.
+		dsn := cfg.SQLitePath + "?_pragma=foreign_keys(1)&_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)"
+		return gorm.Open(sqlite.Open(dsn), gormConfig)
 	}
-	
-	log.Println("Database initialization complete")
-}
 
-func connectDB() (*gorm.DB, error) {
 	var dsn string
-	
+
 	// Print connection details for debugging (remove sensitive info in production)
-	log.Printf("Connecting to database at %s:%s as %s", 
-		config.AppConfig.DBHost, 
-		config.AppConfig.DBPort, 
-		config.AppConfig.DBUser)
-	
-	if config.AppConfig.DatabaseURL != "" {
-		dsn = config.AppConfig.DatabaseURL
+	log.Printf("Connecting to database at %s:%s as %s",
+		cfg.DBHost,
+		cfg.DBPort,
+		cfg.DBUser)
+
+	if cfg.DatabaseURL != "" {
+		dsn = cfg.DatabaseURL
 	} else {
 		dsn = fmt.Sprintf(
 			"host=%s user=%s password=%s dbname=%s port=%s sslmode=require",
-			config.AppConfig.DBHost,
-			config.AppConfig.DBUser,
-			config.AppConfig.DBPassword,
-			config.AppConfig.DBName,
-			config.AppConfig.DBPort,
+			cfg.DBHost,
+			cfg.DBUser,
+			cfg.DBPassword,
+			cfg.DBName,
+			cfg.DBPort,
 		)
 	}
 
-	// Configure GORM with connection pooling and timeouts
-	return gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
-		NowFunc: func() time.Time {
-			return time.Now().UTC() // Use UTC for all timestamps
-		},
-	})
-}
\ No newline at end of file
+	return gorm.Open(postgres.Open(dsn), gormConfig)
+}
@@ -0,0 +1,200 @@
+package migrations
+
+import (
+	"data_mapping/models"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// The baseline creates the schema as it stood before versioned migrations.
+// Databases created by earlier releases already hold these tables; for them
+// it only converts legacy columns and adds missing ones. The structs are a
+// snapshot and must not follow later changes to the models.
+
+type baselineClient struct {
+	ID        uint   `gorm:"primaryKey"`
+	Name      string `gorm:"unique;not null"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (baselineClient) TableName() string { return "clients" }
+
+type baselineMappingRule struct {
+	ID              uint                  `gorm:"primaryKey"`
+	ClientID        uint                  `gorm:"not null"`
+	Client          baselineClient        `gorm:"foreignKey:ClientID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	SourcePath      models.JSONStringList `gorm:"not null"`
+	DestinationPath models.JSONStringList `gorm:"not null"`
+	TransformType   string                `gorm:"not null"`
+	TransformLogic  string                `gorm:"type:text"`
+	Required        bool                  `gorm:"default:false"`
+	DefaultValue    string                `gorm:"type:text"`
+	LookupTable     models.JSONStringMap
+	InverseLogic    string `gorm:"type:text"`
+	MergeStrategy   string `gorm:"not null;default:overwrite"`
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+func (baselineMappingRule) TableName() string { return "mapping_rules" }
+
+type baselineLog struct {
+	ID          uint      `gorm:"primaryKey"`
+	Timestamp   time.Time `gorm:"not null;index"`
+	Method      string    `gorm:"size:10;not null"`
+	Path        string    `gorm:"size:255;not null;index"`
+	ClientIP    string    `gorm:"size:100"`
+	StatusCode  int       `gorm:"not null"`
+	User        string    `gorm:"size:100"`
+	QueryParams string    `gorm:"type:text"`
+	Error       string    `gorm:"type:text"`
+}
+
+func (baselineLog) TableName() string { return "logs" }
+
+type baselineArchivedLog struct {
+	Log baselineLog `gorm:"embedded"`
+}
+
+func (baselineArchivedLog) TableName() string { return "archived_logs" }
+
+type baselineAuditEvent struct {
+	ID        uint      `gorm:"primaryKey"`
+	Timestamp time.Time `gorm:"not null;index"`
+	Actor     string    `gorm:"size:100;index"`
+	ClientID  uint      `gorm:"index"`
+	Entity    string    `gorm:"size:50;not null;index"`
+	EntityID  uint
+	Action    string `gorm:"size:20;not null"`
+	Before    models.JSONDocument
+	After     models.JSONDocument
+	RequestID string `gorm:"size:64;index"`
+}
+
+func (baselineAuditEvent) TableName() string { return "audit_events" }
+
+type baselineTransformRun struct {
+	ID             uint   `gorm:"primaryKey"`
+	ClientID       uint   `gorm:"not null;index"`
+	RuleSetVersion string `gorm:"size:64"`
+	RuleCount      int
+	InputHash      string `gorm:"size:64;index"`
+	Input          string `gorm:"type:text"`
+	Output         string `gorm:"type:text"`
+	Streamed       bool
+	DurationMs     int64
+	Warnings       models.JSONDocument
+	Status         string    `gorm:"size:20;not null"`
+	Error          string    `gorm:"type:text"`
+	Actor          string    `gorm:"size:100"`
+	RequestID      string    `gorm:"size:64"`
+	CreatedAt      time.Time `gorm:"index"`
+}
+
+func (baselineTransformRun) TableName() string { return "transform_runs" }
+
+type baselineBatchJob struct {
+	ID               uint   `gorm:"primaryKey"`
+	ClientID         uint   `gorm:"not null;index"`
+	Status           string `gorm:"size:20;not null;index"`
+	InputFormat      string `gorm:"size:20;not null"`
+	OutputFormat     string `gorm:"size:20;not null;default:ndjson"`
+	Input            string `gorm:"type:text"`
+	Output           string `gorm:"type:text"`
+	ErrorLog         string `gorm:"type:text"`
+	RuleSetVersion   string `gorm:"size:64"`
+	TotalRecords     int
+	ProcessedRecords int
+	FailedRecords    int
+	Error            string `gorm:"type:text"`
+	CreatedBy        string `gorm:"size:100"`
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	StartedAt        *time.Time
+	FinishedAt       *time.Time
+}
+
+func (baselineBatchJob) TableName() string { return "batch_jobs" }
+
+type baselineOutputLayout struct {
+	ID         uint                `gorm:"primaryKey"`
+	ClientID   uint                `gorm:"not null;uniqueIndex:idx_output_layouts_client_format"`
+	Format     string              `gorm:"size:20;not null;uniqueIndex:idx_output_layouts_client_format"`
+	Definition models.JSONDocument `gorm:"not null"`
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (baselineOutputLayout) TableName() string { return "output_layouts" }
+
+type baselineInputSchema struct {
+	ID          uint                `gorm:"primaryKey"`
+	ClientID    uint                `gorm:"not null;uniqueIndex"`
+	SampleCount int                 `gorm:"not null"`
+	Fields      models.JSONDocument `gorm:"not null"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (baselineInputSchema) TableName() string { return "input_schemas" }
+
+// baselineTables lists the baseline tables with referenced tables first.
+func baselineTables() []interface{} {
+	return []interface{}{
+		&baselineLog{},
+		&baselineArchivedLog{},
+		&baselineClient{},
+		&baselineMappingRule{},
+		&baselineAuditEvent{},
+		&baselineTransformRun{},
+		&baselineBatchJob{},
+		&baselineOutputLayout{},
+		&baselineInputSchema{},
+	}
+}
+
+func baselineUp(tx *gorm.DB) error {
+	if err := convertLogTimestampToTime(tx); err != nil {
+		return err
+	}
+	return tx.AutoMigrate(baselineTables()...)
+}
+
+func baselineDown(tx *gorm.DB) error {
+	tables := baselineTables()
+	for i := len(tables) - 1; i >= 0; i-- {
+		if err := tx.Migrator().DropTable(tables[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// convertLogTimestampToTime changes logs.timestamp from the text column used by
+// earlier versions into a timestamptz so that range queries can use an index.
+// It must run before AutoMigrate, which cannot cast existing text values.
+// Only Postgres databases predate the timestamp column.
+func convertLogTimestampToTime(db *gorm.DB) error {
+	if db.Dialector.Name() != "postgres" || !db.Migrator().HasTable("logs") {
+		return nil
+	}
+
+	columns, err := db.Migrator().ColumnTypes("logs")
+	if err != nil {
+		return err
+	}
+	var dataType string
+	for _, column := range columns {
+		if column.Name() == "timestamp" {
+			dataType = strings.ToLower(column.DatabaseTypeName())
+		}
+	}
+	if dataType != "text" && dataType != "varchar" && dataType != "character varying" {
+		return nil
+	}
+
+	return db.Exec(`ALTER TABLE logs ALTER COLUMN "timestamp" TYPE timestamptz USING "timestamp"::timestamptz`).Error
+}
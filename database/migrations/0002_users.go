@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type usersUser struct {
+	ID           uint   `gorm:"primaryKey"`
+	Username     string `gorm:"size:100;not null;uniqueIndex"`
+	PasswordHash string `gorm:"size:100;not null"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+func (usersUser) TableName() string { return "users" }
+
+func usersUp(tx *gorm.DB) error {
+	return tx.Migrator().CreateTable(&usersUser{})
+}
+
+func usersDown(tx *gorm.DB) error {
+	return tx.Migrator().DropTable(&usersUser{})
+}
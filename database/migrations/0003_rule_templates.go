@@ -0,0 +1,55 @@
+package migrations
+
+import (
+	"data_mapping/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ruleTemplatesTemplate struct {
+	ID          uint   `gorm:"primaryKey"`
+	Name        string `gorm:"size:100;not null;uniqueIndex"`
+	Description string `gorm:"type:text"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (ruleTemplatesTemplate) TableName() string { return "rule_templates" }
+
+type ruleTemplatesRule struct {
+	ID              uint                  `gorm:"primaryKey"`
+	TemplateID      uint                  `gorm:"not null;index"`
+	Template        ruleTemplatesTemplate `gorm:"foreignKey:TemplateID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	SourcePath      models.JSONStringList `gorm:"not null"`
+	DestinationPath models.JSONStringList `gorm:"not null"`
+	TransformType   string                `gorm:"not null"`
+	TransformLogic  string                `gorm:"type:text"`
+	Required        bool                  `gorm:"default:false"`
+	DefaultValue    string                `gorm:"type:text"`
+	LookupTable     models.JSONStringMap
+	InverseLogic    string `gorm:"type:text"`
+	MergeStrategy   string `gorm:"size:20"`
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+}
+
+func (ruleTemplatesRule) TableName() string { return "template_rules" }
+
+type ruleTemplatesClientTemplate struct {
+	ClientID   uint                  `gorm:"primaryKey;autoIncrement:false"`
+	Client     baselineClient        `gorm:"foreignKey:ClientID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	TemplateID uint                  `gorm:"primaryKey;autoIncrement:false;index"`
+	Template   ruleTemplatesTemplate `gorm:"foreignKey:TemplateID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+	Position   int                   `gorm:"not null"`
+}
+
+func (ruleTemplatesClientTemplate) TableName() string { return "client_templates" }
+
+func ruleTemplatesUp(tx *gorm.DB) error {
+	return tx.Migrator().CreateTable(&ruleTemplatesTemplate{}, &ruleTemplatesRule{}, &ruleTemplatesClientTemplate{})
+}
+
+func ruleTemplatesDown(tx *gorm.DB) error {
+	return tx.Migrator().DropTable(&ruleTemplatesClientTemplate{}, &ruleTemplatesRule{}, &ruleTemplatesTemplate{})
+}
@@ -0,0 +1,82 @@
+package migrations
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type softDeleteClient struct {
+	ID        uint   `gorm:"primaryKey"`
+	Name      string `gorm:"not null;uniqueIndex:idx_clients_name_live,where:deleted_at IS NULL"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (softDeleteClient) TableName() string { return "clients" }
+
+type softDeleteMappingRule struct {
+	ID        uint           `gorm:"primaryKey"`
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+}
+
+func (softDeleteMappingRule) TableName() string { return "mapping_rules" }
+
+// legacyClientNameConstraints are the names the unique constraint on
+// clients.name has had: the baseline's, and the one Postgres gave the column
+// constraint created by earlier releases.
+var legacyClientNameConstraints = []string{"uni_clients_name", "clients_name_key"}
+
+// softDeleteUp adds deleted_at to clients and mapping rules, and replaces the
+// unique constraint on client names with a unique index over clients that are
+// not deleted.
+func softDeleteUp(tx *gorm.DB) error {
+	m := tx.Migrator()
+	// SQLite drops constraints by rebuilding the table, which loses its
+	// indexes, so this comes first.
+	for _, name := range legacyClientNameConstraints {
+		if m.HasConstraint(&softDeleteClient{}, name) {
+			if err := m.DropConstraint(&softDeleteClient{}, name); err != nil {
+				return err
+			}
+		}
+	}
+	for _, model := range []interface{}{&softDeleteClient{}, &softDeleteMappingRule{}} {
+		if err := m.AddColumn(model, "DeletedAt"); err != nil {
+			return err
+		}
+		if err := m.CreateIndex(model, "DeletedAt"); err != nil {
+			return err
+		}
+	}
+	return m.CreateIndex(&softDeleteClient{}, "idx_clients_name_live")
+}
+
+// softDeleteDown purges deleted clients and rules, since the restored unique
+// constraint cannot hold a deleted client's name twice, and drops deleted_at.
+func softDeleteDown(tx *gorm.DB) error {
+	if err := tx.Exec("DELETE FROM mapping_rules WHERE deleted_at IS NOT NULL OR client_id IN (SELECT id FROM clients WHERE deleted_at IS NOT NULL)").Error; err != nil {
+		return err
+	}
+	if err := tx.Exec("DELETE FROM client_templates WHERE client_id IN (SELECT id FROM clients WHERE deleted_at IS NOT NULL)").Error; err != nil {
+		return err
+	}
+	if err := tx.Exec("DELETE FROM clients WHERE deleted_at IS NOT NULL").Error; err != nil {
+		return err
+	}
+
+	m := tx.Migrator()
+	if err := m.DropIndex(&softDeleteClient{}, "idx_clients_name_live"); err != nil {
+		return err
+	}
+	for _, model := range []interface{}{&softDeleteClient{}, &softDeleteMappingRule{}} {
+		if err := m.DropIndex(model, "DeletedAt"); err != nil {
+			return err
+		}
+		if err := m.DropColumn(model, "DeletedAt"); err != nil {
+			return err
+		}
+	}
+	return m.CreateConstraint(&baselineClient{}, "uni_clients_name")
+}
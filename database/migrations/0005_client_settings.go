@@ -0,0 +1,69 @@
+package migrations
+
+import (
+	"data_mapping/models"
+
+	"gorm.io/gorm"
+)
+
+type clientSettingsClient struct {
+	ID          uint   `gorm:"primaryKey"`
+	Status      string `gorm:"size:20;not null;default:active"`
+	Contact     string `gorm:"size:255"`
+	PartnerCode string `gorm:"size:50;index"`
+	Tags        models.JSONStringList
+	Settings    clientSettingsSettings `gorm:"embedded;embeddedPrefix:settings_"`
+}
+
+type clientSettingsSettings struct {
+	Timezone     string `gorm:"size:64"`
+	DateLayouts  models.JSONStringList
+	NullPolicy   string `gorm:"size:20"`
+	OutputFormat string `gorm:"size:20"`
+	StrictMode   bool   `gorm:"not null;default:false"`
+}
+
+func (clientSettingsClient) TableName() string { return "clients" }
+
+// clientSettingsColumns are the columns added to clients.
+var clientSettingsColumns = []string{
+	"status", "contact", "partner_code", "tags",
+	"settings_timezone", "settings_date_layouts", "settings_null_policy", "settings_output_format", "settings_strict_mode",
+}
+
+// clientSettingsUp adds status, metadata and transform settings to clients.
+// Existing clients become active, with no tags and default settings.
+func clientSettingsUp(tx *gorm.DB) error {
+	m := tx.Migrator()
+	for _, column := range clientSettingsColumns {
+		if err := m.AddColumn(&clientSettingsClient{}, column); err != nil {
+			return err
+		}
+	}
+	if err := tx.Exec("UPDATE clients SET tags = '[]', settings_date_layouts = '[]'").Error; err != nil {
+		return err
+	}
+	return m.CreateIndex(&clientSettingsClient{}, "PartnerCode")
+}
+
+func clientSettingsDown(tx *gorm.DB) error {
+	m := tx.Migrator()
+	if err := m.DropIndex(&clientSettingsClient{}, "PartnerCode"); err != nil {
+		return err
+	}
+	for _, column := range clientSettingsColumns {
+		if err := m.DropColumn(&clientSettingsClient{}, column); err != nil {
+			return err
+		}
+	}
+	// SQLite drops columns by rebuilding the table, which loses the indexes
+	// added by earlier migrations.
+	for _, index := range []string{"DeletedAt", "idx_clients_name_live"} {
+		if !m.HasIndex(&softDeleteClient{}, index) {
+			if err := m.CreateIndex(&softDeleteClient{}, index); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package migrations
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+
+	"gorm.io/gorm"
+)
+
+type batchJobFilesJob struct {
+	ID           uint   `gorm:"primaryKey"`
+	ClientID     uint   `gorm:"not null;index"`
+	Status       string `gorm:"size:20;not null;index"`
+	InputPath    string `gorm:"size:500"`
+	OutputPath   string `gorm:"size:500"`
+	ErrorLogPath string `gorm:"size:500"`
+	Input        string `gorm:"type:text"`
+	Output       string `gorm:"type:text"`
+	ErrorLog     string `gorm:"type:text"`
+}
+
+func (batchJobFilesJob) TableName() string { return "batch_jobs" }
+
+var batchJobFilesColumns = []string{"input_path", "output_path", "error_log_path"}
+
+// batchJobFilesUp adds the paths of the files batch jobs keep their upload
+// and results in. Existing jobs keep theirs in the text columns.
+func batchJobFilesUp(tx *gorm.DB) error {
+	m := tx.Migrator()
+	for _, column := range batchJobFilesColumns {
+		if err := m.AddColumn(&batchJobFilesJob{}, column); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// batchJobFilesDown reads the files of jobs back into the text columns. The
+// files are left in place.
+func batchJobFilesDown(tx *gorm.DB) error {
+	var stored []batchJobFilesJob
+	err := tx.Where("input_path <> '' OR output_path <> '' OR error_log_path <> ''").Find(&stored).Error
+	if err != nil {
+		return err
+	}
+	for _, job := range stored {
+		updates := map[string]interface{}{}
+		files := []struct{ column, path string }{
+			{"input", job.InputPath},
+			{"output", job.OutputPath},
+			{"error_log", job.ErrorLogPath},
+		}
+		for _, file := range files {
+			if file.path == "" {
+				continue
+			}
+			data, err := os.ReadFile(file.path)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			updates[file.column] = string(data)
+		}
+		if len(updates) > 0 {
+			if err := tx.Model(&batchJobFilesJob{}).Where("id = ?", job.ID).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	m := tx.Migrator()
+	for _, column := range batchJobFilesColumns {
+		if err := m.DropColumn(&batchJobFilesJob{}, column); err != nil {
+			return err
+		}
+	}
+	// SQLite drops columns by rebuilding the table, which loses its indexes.
+	for _, index := range []string{"ClientID", "Status"} {
+		if !m.HasIndex(&batchJobFilesJob{}, index) {
+			if err := m.CreateIndex(&batchJobFilesJob{}, index); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package migrations
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type batchJobChunksJob struct {
+	ID             uint   `gorm:"primaryKey"`
+	ClientID       uint   `gorm:"not null;index"`
+	Status         string `gorm:"size:20;not null;index"`
+	InputPath      string `gorm:"size:500"`
+	OutputPath     string `gorm:"size:500"`
+	ErrorLogPath   string `gorm:"size:500"`
+	Input          string `gorm:"type:text"`
+	Output         string `gorm:"type:text"`
+	ErrorLog       string `gorm:"type:text"`
+	LeaseOwner     string `gorm:"size:100"`
+	LeaseExpiresAt *time.Time
+}
+
+func (batchJobChunksJob) TableName() string { return "batch_jobs" }
+
+type batchJobChunksChunk struct {
+	ID    uint   `gorm:"primaryKey"`
+	JobID uint   `gorm:"not null;uniqueIndex:idx_batch_job_chunks_position"`
+	Body  string `gorm:"size:20;not null;uniqueIndex:idx_batch_job_chunks_position"`
+	Seq   int    `gorm:"not null;uniqueIndex:idx_batch_job_chunks_position"`
+	Data  []byte `gorm:"not null"`
+}
+
+func (batchJobChunksChunk) TableName() string { return "batch_job_chunks" }
+
+// batchJobChunksSize is the size of the chunks existing bodies are split
+// into, the same as the repository writes.
+const batchJobChunksSize = 1 << 20
+
+var (
+	batchJobChunksLeaseColumns = []string{"lease_owner", "lease_expires_at"}
+	batchJobChunksBodyColumns  = []string{"input", "output", "error_log", "input_path", "output_path", "error_log_path"}
+)
+
+// batchJobChunksUp moves job bodies from files and text columns into
+// batch_job_chunks and adds the lease columns. Running jobs are requeued,
+// since they belonged to runners without leases. Files that no longer exist
+// leave their body empty; the files themselves are left in place.
+func batchJobChunksUp(tx *gorm.DB) error {
+	if err := tx.Migrator().CreateTable(&batchJobChunksChunk{}); err != nil {
+		return err
+	}
+
+	var jobs []batchJobChunksJob
+	err := tx.Select("id", batchJobChunksBodyColumns).FindInBatches(&jobs, 10, func(*gorm.DB, int) error {
+		for _, job := range jobs {
+			bodies := []struct{ name, path, text string }{
+				{"input", job.InputPath, job.Input},
+				{"output", job.OutputPath, job.Output},
+				{"errors", job.ErrorLogPath, job.ErrorLog},
+			}
+			for _, body := range bodies {
+				data := []byte(body.text)
+				if body.path != "" {
+					var err error
+					data, err = os.ReadFile(body.path)
+					if errors.Is(err, fs.ErrNotExist) {
+						continue
+					}
+					if err != nil {
+						return err
+					}
+				}
+				for seq := 0; len(data) > 0; seq++ {
+					n := min(len(data), batchJobChunksSize)
+					chunk := batchJobChunksChunk{JobID: job.ID, Body: body.name, Seq: seq, Data: data[:n]}
+					if err := tx.Create(&chunk).Error; err != nil {
+						return err
+					}
+					data = data[n:]
+				}
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	m := tx.Migrator()
+	for _, column := range batchJobChunksBodyColumns {
+		if err := m.DropColumn(&batchJobChunksJob{}, column); err != nil {
+			return err
+		}
+	}
+	for _, column := range batchJobChunksLeaseColumns {
+		if err := m.AddColumn(&batchJobChunksJob{}, column); err != nil {
+			return err
+		}
+	}
+	if err := tx.Exec("UPDATE batch_jobs SET status = 'queued', processed_records = 0, failed_records = 0 WHERE status = 'running'").Error; err != nil {
+		return err
+	}
+	return batchJobChunksIndexes(tx)
+}
+
+// batchJobChunksDown moves the chunks back into the text columns and leaves
+// the path columns empty.
+func batchJobChunksDown(tx *gorm.DB) error {
+	m := tx.Migrator()
+	for _, column := range batchJobChunksBodyColumns {
+		if err := m.AddColumn(&batchJobChunksJob{}, column); err != nil {
+			return err
+		}
+	}
+
+	var jobIDs []uint
+	if err := tx.Model(&batchJobChunksChunk{}).Distinct("job_id").Order("job_id").Pluck("job_id", &jobIDs).Error; err != nil {
+		return err
+	}
+	bodies := []struct{ name, column string }{{"input", "input"}, {"output", "output"}, {"errors", "error_log"}}
+	for _, jobID := range jobIDs {
+		for _, body := range bodies {
+			var chunks []batchJobChunksChunk
+			if err := tx.Where("job_id = ? AND body = ?", jobID, body.name).Order("seq").Find(&chunks).Error; err != nil {
+				return err
+			}
+			if len(chunks) == 0 {
+				continue
+			}
+			var data []byte
+			for _, chunk := range chunks {
+				data = append(data, chunk.Data...)
+			}
+			if err := tx.Model(&batchJobChunksJob{}).Where("id = ?", jobID).Update(body.column, string(data)).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, column := range batchJobChunksLeaseColumns {
+		if err := m.DropColumn(&batchJobChunksJob{}, column); err != nil {
+			return err
+		}
+	}
+	if err := m.DropTable(&batchJobChunksChunk{}); err != nil {
+		return err
+	}
+	return batchJobChunksIndexes(tx)
+}
+
+// batchJobChunksIndexes restores the indexes of batch_jobs, which SQLite
+// loses when it drops columns by rebuilding the table.
+func batchJobChunksIndexes(tx *gorm.DB) error {
+	m := tx.Migrator()
+	for _, index := range []string{"ClientID", "Status"} {
+		if !m.HasIndex(&batchJobChunksJob{}, index) {
+			if err := m.CreateIndex(&batchJobChunksJob{}, index); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
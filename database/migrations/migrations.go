@@ -0,0 +1,211 @@
+package migrations
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration is one numbered schema change. Up and Down each run in their own
+// transaction together with the update of schema_migrations.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	// Down reverts Up. Migrations without Down cannot be rolled back.
+	Down func(tx *gorm.DB) error
+}
+
+// all lists every migration in version order. New migrations are appended
+// with the next version number and never changed once released.
+var all = []Migration{
+	{Version: 1, Name: "baseline", Up: baselineUp, Down: baselineDown},
+	{Version: 2, Name: "users", Up: usersUp, Down: usersDown},
+	{Version: 3, Name: "rule_templates", Up: ruleTemplatesUp, Down: ruleTemplatesDown},
+	{Version: 4, Name: "soft_delete", Up: softDeleteUp, Down: softDeleteDown},
+	{Version: 5, Name: "client_settings", Up: clientSettingsUp, Down: clientSettingsDown},
+	{Version: 6, Name: "batch_job_files", Up: batchJobFilesUp, Down: batchJobFilesDown},
+	{Version: 7, Name: "batch_job_chunks", Up: batchJobChunksUp, Down: batchJobChunksDown},
+}
+
+// SchemaMigration records an applied migration.
+type SchemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"size:255;not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Status is the state of one migration. AppliedAt is nil while it is
+// pending.
+type Status struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at"`
+}
+
+// advisoryLockKey identifies the Postgres advisory lock held while migrating,
+// so that replicas starting together apply each migration once.
+const advisoryLockKey = 72616401
+
+// Up applies every pending migration in order and returns the ones applied.
+func Up(db *gorm.DB) ([]Migration, error) {
+	var done []Migration
+	err := withLock(db, func(conn *gorm.DB) error {
+		applied, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range all {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := m.Up(tx); err != nil {
+					return err
+				}
+				return tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now().UTC()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d %s: %w", m.Version, m.Name, err)
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the latest steps applied migrations, newest first, and returns
+// the ones reverted.
+func Down(db *gorm.DB, steps int) ([]Migration, error) {
+	var done []Migration
+	err := withLock(db, func(conn *gorm.DB) error {
+		applied, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+		versions := make([]int, 0, len(applied))
+		for version := range applied {
+			versions = append(versions, version)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(versions)))
+		if steps < len(versions) {
+			versions = versions[:steps]
+		}
+
+		for _, version := range versions {
+			m, ok := find(version)
+			if !ok {
+				return fmt.Errorf("migration %d is applied but unknown to this build", version)
+			}
+			if m.Down == nil {
+				return fmt.Errorf("migration %d %s cannot be reverted", m.Version, m.Name)
+			}
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := m.Down(tx); err != nil {
+					return err
+				}
+				return tx.Delete(&SchemaMigration{}, m.Version).Error
+			})
+			if err != nil {
+				return fmt.Errorf("reverting migration %d %s: %w", m.Version, m.Name, err)
+			}
+			done = append(done, m)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// List returns the state of every known migration in version order.
+func List(db *gorm.DB) ([]Status, error) {
+	var applied map[int]time.Time
+	if db.Migrator().HasTable(&SchemaMigration{}) {
+		var err error
+		if applied, err = appliedVersions(db); err != nil {
+			return nil, err
+		}
+	}
+	statuses := make([]Status, 0, len(all))
+	for _, m := range all {
+		status := Status{Version: m.Version, Name: m.Name}
+		if at, ok := applied[m.Version]; ok {
+			status.AppliedAt = &at
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Pending returns the migrations not yet applied to db.
+func Pending(db *gorm.DB) ([]Migration, error) {
+	statuses, err := List(db)
+	if err != nil {
+		return nil, err
+	}
+	var pending []Migration
+	for i, status := range statuses {
+		if status.AppliedAt == nil {
+			pending = append(pending, all[i])
+		}
+	}
+	return pending, nil
+}
+
+func find(version int) (Migration, bool) {
+	for _, m := range all {
+		if m.Version == version {
+			return m, true
+		}
+	}
+	return Migration{}, false
+}
+
+func appliedVersions(db *gorm.DB) (map[int]time.Time, error) {
+	if err := db.AutoMigrate(&SchemaMigration{}); err != nil {
+		return nil, err
+	}
+	var rows []SchemaMigration
+	if err := db.Order("version").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	applied := make(map[int]time.Time, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row.AppliedAt
+	}
+	return applied, nil
+}
+
+// withLock runs fn on a single connection holding the migration lock. SQLite
+// serializes writers itself, so only Postgres takes an advisory lock. SQLite
+// instead runs migrations with foreign keys off: it alters tables by
+// rebuilding them, and dropping the old table would otherwise cascade to the
+// rows referencing it.
+func withLock(db *gorm.DB, fn func(conn *gorm.DB) error) error {
+	switch db.Dialector.Name() {
+	case "postgres":
+		return db.Connection(func(conn *gorm.DB) error {
+			if err := conn.Exec("SELECT pg_advisory_lock(?)", advisoryLockKey).Error; err != nil {
+				return fmt.Errorf("acquiring migration lock: %w", err)
+			}
+			defer conn.Exec("SELECT pg_advisory_unlock(?)", advisoryLockKey)
+			return fn(conn.Session(&gorm.Session{NewDB: true}))
+		})
+	case "sqlite":
+		return db.Connection(func(conn *gorm.DB) error {
+			if err := conn.Exec("PRAGMA foreign_keys = OFF").Error; err != nil {
+				return err
+			}
+			defer conn.Exec("PRAGMA foreign_keys = ON")
+			return fn(conn.Session(&gorm.Session{NewDB: true}))
+		})
+	default:
+		return fn(db)
+	}
+}
@@ -0,0 +1,125 @@
+package migrations
+
+import (
+	"data_mapping/config"
+	"data_mapping/database"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := database.Connect(config.Config{DBDriver: "sqlite", SQLitePath: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db = db.Session(&gorm.Session{Logger: logger.Discard})
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// schema describes the columns and indexes of every table except
+// schema_migrations, independent of column order.
+func schema(t *testing.T, db *gorm.DB) []string {
+	t.Helper()
+	var columns []string
+	err := db.Raw(`SELECT m.name || '.' || p.name FROM sqlite_master m JOIN pragma_table_info(m.name) p
+		WHERE m.type = 'table' AND m.name NOT IN ('schema_migrations', 'sqlite_sequence') ORDER BY 1`).Scan(&columns).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	var indexes []string
+	err = db.Raw(`SELECT tbl_name || ' index ' || name FROM sqlite_master
+		WHERE type = 'index' AND name NOT LIKE 'sqlite_%' AND tbl_name <> 'schema_migrations' ORDER BY 1`).Scan(&indexes).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(columns, indexes...)
+}
+
+func TestUpDownRoundTrip(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := Up(db); err != nil {
+		t.Fatal(err)
+	}
+	migrated := schema(t, db)
+	if len(migrated) == 0 {
+		t.Fatal("no tables after migrating up")
+	}
+
+	// Every migration reverts to the schema of the one before it and
+	// reapplies cleanly.
+	previous := make([][]string, len(all)+1)
+	previous[len(all)] = migrated
+	for i := len(all); i > 0; i-- {
+		reverted, err := Down(db, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(reverted) != 1 || reverted[0].Version != i {
+			t.Fatalf("Down reverted %+v, want migration %d", reverted, i)
+		}
+		previous[i-1] = schema(t, db)
+	}
+	if len(previous[0]) != 0 {
+		t.Errorf("schema after reverting every migration = %v, want no tables", previous[0])
+	}
+	if pending, err := Pending(db); err != nil || len(pending) != len(all) {
+		t.Errorf("Pending = %d migrations, %v, want %d", len(pending), err, len(all))
+	}
+
+	for i := 1; i <= len(all); i++ {
+		if err := db.Transaction(func(tx *gorm.DB) error { return all[i-1].Up(tx) }); err != nil {
+			t.Fatalf("migration %d: %v", i, err)
+		}
+		if got := schema(t, db); !reflect.DeepEqual(got, previous[i]) {
+			t.Errorf("schema after reapplying migration %d differs:\ngot  %v\nwant %v", i, got, previous[i])
+		}
+	}
+}
+
+func TestBatchJobFilesDownReadsEveryFile(t *testing.T) {
+	db := newTestDB(t)
+	if _, err := Up(db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Down(db, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// One file named by two columns fills both, and empty paths leave
+	// their columns alone.
+	path := filepath.Join(t.TempDir(), "body.ndjson")
+	if err := os.WriteFile(path, []byte("{\"name\":\"Asha\"}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	err := db.Exec(`INSERT INTO batch_jobs (id, client_id, status, input_format, output_format, input_path, output_path, error_log_path, error_log)
+		VALUES (1, 1, 'completed', 'ndjson', 'ndjson', ?, ?, '', 'kept')`, path, path).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Down(db, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	var job batchJobFilesJob
+	if err := db.Select("id", "input", "output", "error_log").First(&job, 1).Error; err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\"name\":\"Asha\"}\n"; job.Input != want || job.Output != want || job.ErrorLog != "kept" {
+		t.Errorf("job = %+v, want input and output read from %s and the error log kept", job, path)
+	}
+	if columns := schema(t, db); strings.Contains(strings.Join(columns, " "), "input_path") {
+		t.Errorf("schema still has the path columns: %v", columns)
+	}
+}
@@ -1,5 +1,5 @@
 import React, { useState, useEffect, useRef } from 'react';
-import { Plus, Trash2, Settings, AlertCircle, Info, Code, Save, X, Upload, Download, FileText } from 'lucide-react';
+import { Plus, Trash2, Settings, AlertCircle, Info, Code, Save, X, Upload, Download, FileText, ChevronLeft, ChevronRight } from 'lucide-react';
 import { clientsAPI, mappingAPI } from '../services/api';
 import toast from 'react-hot-toast';
 import { Button } from '@/components/ui/button';
@@ -11,14 +11,60 @@ import { Badge } from '@/components/ui/badge';
 import { Select, SelectContent, SelectItem, SelectTrigger, SelectValue } from '@/components/ui/select';
 import { Textarea } from '@/components/ui/textarea';
 
+const CLIENTS_PAGE_SIZE = 25;
+const MAPPINGS_PAGE_SIZE = 50;
+const SEARCH_DEBOUNCE_MS = 300;
+
+// lastPageOffset is the offset of the last page of a list of total items.
+const lastPageOffset = (total, pageSize) => Math.max(0, Math.floor((total - 1) / pageSize) * pageSize);
+
+const Pager = ({ offset, pageSize, total, noun, onChange }) => {
+  if (total <= pageSize) {
+    return null;
+  }
+  return (
+    <div className="flex items-center justify-between px-4 py-3 border-t border-gray-200">
+      <p className="text-sm text-gray-500">
+        {offset + 1}–{Math.min(offset + pageSize, total)} of {total} {noun}
+      </p>
+      <div className="space-x-2">
+        <Button
+          variant="outline"
+          size="sm"
+          onClick={() => onChange(Math.max(0, offset - pageSize))}
+          disabled={offset === 0}
+        >
+          <ChevronLeft className="h-4 w-4 mr-1" />
+          Previous
+        </Button>
+        <Button
+          variant="outline"
+          size="sm"
+          onClick={() => onChange(offset + pageSize)}
+          disabled={offset + pageSize >= total}
+        >
+          Next
+          <ChevronRight className="h-4 w-4 ml-1" />
+        </Button>
+      </div>
+    </div>
+  );
+};
+
 const Clients = () => {
   const [clients, setClients] = useState([]);
+  const [totalClients, setTotalClients] = useState(0);
+  const [clientsOffset, setClientsOffset] = useState(0);
+  const [searchInput, setSearchInput] = useState('');
+  const [search, setSearch] = useState('');
   const [loading, setLoading] = useState(true);
   const [showCreateModal, setShowCreateModal] = useState(false);
   const [newClientName, setNewClientName] = useState('');
   const [creating, setCreating] = useState(false);
   const [selectedClient, setSelectedClient] = useState(null);
   const [mappings, setMappings] = useState([]);
+  const [totalMappings, setTotalMappings] = useState(0);
+  const [mappingsOffset, setMappingsOffset] = useState(0);
   const [showMappingForm, setShowMappingForm] = useState(false);
   const [newMapping, setNewMapping] = useState({
     source_path: '',
@@ -26,7 +72,8 @@ const Clients = () => {
     transform_type: 'copy',
     transform_logic: '',
     default_value: '',
-    required: false
+    required: false,
+    merge_strategy: 'overwrite'
   });
   const [savingMapping, setSavingMapping] = useState(false);
   const [showBulkMappingForm, setShowBulkMappingForm] = useState(false);
@@ -34,14 +81,36 @@ const Clients = () => {
   const [savingBulkMapping, setSavingBulkMapping] = useState(false);
   const fileInputRef = useRef(null);
 
+  // Search once typing pauses rather than on every keystroke
+  useEffect(() => {
+    const timer = setTimeout(() => {
+      const next = searchInput.trim();
+      if (next !== search) {
+        setSearch(next);
+        setClientsOffset(0);
+      }
+    }, SEARCH_DEBOUNCE_MS);
+    return () => clearTimeout(timer);
+  }, [searchInput]);
+
   useEffect(() => {
     loadClients();
-  }, []);
+  }, [search, clientsOffset]);
 
   const loadClients = async () => {
     try {
-      const data = await clientsAPI.getAll();
-      setClients(data);
+      const page = await clientsAPI.getAll({
+        search: search || undefined,
+        limit: CLIENTS_PAGE_SIZE,
+        offset: clientsOffset
+      });
+      // Deleting the last client on a page leaves it empty
+      if (page.data.length === 0 && clientsOffset > 0) {
+        setClientsOffset(lastPageOffset(page.total, CLIENTS_PAGE_SIZE));
+        return;
+      }
+      setClients(page.data);
+      setTotalClients(page.total);
     } catch (error) {
       toast.error('Failed to load clients');
     } finally {
@@ -68,7 +137,7 @@ const Clients = () => {
   };
 
   const handleDeleteClient = async (clientId, clientName) => {
-    if (!confirm(`Are you sure you want to delete "${clientName}"? This will also delete all associated mapping rules.`)) {
+    if (!confirm(`Are you sure you want to delete "${clientName}"? Its mapping rules go to the trash with it and can be restored until they are purged.`)) {
       return;
     }
 
@@ -81,19 +150,28 @@ const Clients = () => {
     }
   };
 
-  const loadMappings = async (clientId) => {
+  const loadMappings = async (clientId, offset = mappingsOffset) => {
     try {
-      const data = await mappingAPI.getByClient(clientId);
-      setMappings(data);
+      const page = await mappingAPI.getByClient(clientId, { limit: MAPPINGS_PAGE_SIZE, offset });
+      if (page.data.length === 0 && offset > 0) {
+        loadMappings(clientId, lastPageOffset(page.total, MAPPINGS_PAGE_SIZE));
+        return;
+      }
+      setMappings(page.data);
+      setTotalMappings(page.total);
+      setMappingsOffset(offset);
     } catch (error) {
       toast.error('Failed to load mapping rules');
       setMappings([]);
+      setTotalMappings(0);
     }
   };
 
   const handleViewMappings = (client) => {
     setSelectedClient(client);
-    loadMappings(client.id);
+    setMappings([]);
+    setTotalMappings(0);
+    loadMappings(client.id, 0);
   };
 
   const handleCreateMapping = async (e) => {
@@ -118,9 +196,11 @@ const Clients = () => {
         transform_type: 'copy',
         transform_logic: '',
         default_value: '',
-        required: false
+        required: false,
+        merge_strategy: 'overwrite'
       });
-      loadMappings(selectedClient.id);
+      // New rules are applied last, so show the last page
+      loadMappings(selectedClient.id, lastPageOffset(totalMappings + 1, MAPPINGS_PAGE_SIZE));
     } catch (error) {
       toast.error('Failed to create mapping rule');
     } finally {
@@ -134,47 +214,24 @@ const Clients = () => {
 
     setSavingBulkMapping(true);
     try {
-      // Parse the bulk mapping text - expect JSON array format
-      const bulkMappings = JSON.parse(bulkMappingText);
-      
-      if (!Array.isArray(bulkMappings)) {
-        throw new Error('Expected an array of mapping rules');
-      }
-
-      // Validate and transform each mapping rule
-      const transformedMappings = bulkMappings.map((mapping, index) => {
-        const required = ['source_path', 'destination_path', 'transform_type'];
-        for (const field of required) {
-          if (!mapping[field]) {
-            throw new Error(`Missing required field '${field}' in mapping rule ${index + 1}`);
-          }
-        }
-
-        return {
-          source_path: Array.isArray(mapping.source_path) 
-            ? mapping.source_path 
-            : mapping.source_path.split('.').filter(p => p.trim()),
-          destination_path: Array.isArray(mapping.destination_path) 
-            ? mapping.destination_path 
-            : mapping.destination_path.split('.').filter(p => p.trim()),
-          transform_type: mapping.transform_type,
-          transform_logic: mapping.transform_logic || '',
-          default_value: mapping.default_value || '',
-          required: mapping.required || false
-        };
-      });
-
-      await mappingAPI.create(selectedClient.id, transformedMappings);
-      toast.success(`Successfully created ${transformedMappings.length} mapping rules`);
+      // The server accepts JSON or YAML, with array or dotted paths
+      const trimmed = bulkMappingText.trim();
+      const format = trimmed.startsWith('[') || trimmed.startsWith('{') ? 'json' : 'yaml';
+      const result = await mappingAPI.importRules(selectedClient.id, bulkMappingText, { format, mode: 'merge' });
+      const { add, update } = result.data;
+      toast.success(`Imported mapping rules: ${add.length} added, ${update.length} updated`);
       setShowBulkMappingForm(false);
       setBulkMappingText('');
       loadMappings(selectedClient.id);
     } catch (error) {
       console.error('Bulk mapping error:', error);
-      if (error.name === 'SyntaxError') {
-        toast.error('Invalid JSON format. Please check your syntax.');
+      const details = error.response?.data?.details;
+      if (Array.isArray(details) && details.length > 0) {
+        const first = details[0];
+        toast.error(`Mapping rule ${first.index + 1}: ${first.errors.join('; ')}` +
+          (details.length > 1 ? ` (and ${details.length - 1} more)` : ''));
       } else {
-        toast.error(error.message || 'Failed to create bulk mapping rules');
+        toast.error(error.response?.data?.error || error.message || 'Failed to import mapping rules');
       }
     } finally {
       setSavingBulkMapping(false);
@@ -211,53 +268,42 @@ const Clients = () => {
     setBulkMappingText(JSON.stringify(template, null, 2));
   };
 
-  const exportMappingRules = () => {
-    if (mappings.length === 0) {
+  const exportMappingRules = async () => {
+    if (totalMappings === 0) {
       toast.error('No mapping rules to export');
       return;
     }
 
-    const exportData = mappings.map(mapping => ({
-      source_path: mapping.source_path.join('.'),
-      destination_path: mapping.destination_path.join('.'),
-      transform_type: mapping.transform_type,
-      transform_logic: mapping.transform_logic,
-      default_value: mapping.default_value,
-      required: mapping.required
-    }));
-
-    const blob = new Blob([JSON.stringify(exportData, null, 2)], { type: 'application/json' });
-    const url = URL.createObjectURL(blob);
-    const a = document.createElement('a');
-    a.href = url;
-    a.download = `${selectedClient?.name || 'client'}_mapping_rules.json`;
-    document.body.appendChild(a);
-    a.click();
-    document.body.removeChild(a);
-    URL.revokeObjectURL(url);
-    toast.success('Mapping rules exported successfully');
+    try {
+      const content = await mappingAPI.exportRules(selectedClient.id, 'json', 'dotted');
+      const blob = new Blob([content], { type: 'application/json' });
+      const url = URL.createObjectURL(blob);
+      const a = document.createElement('a');
+      a.href = url;
+      a.download = `${selectedClient?.name || 'client'}_mapping_rules.json`;
+      document.body.appendChild(a);
+      a.click();
+      document.body.removeChild(a);
+      URL.revokeObjectURL(url);
+      toast.success('Mapping rules exported successfully');
+    } catch (error) {
+      toast.error('Failed to export mapping rules');
+    }
   };
 
   const handleFileUpload = (event) => {
     const file = event.target.files[0];
     if (!file) return;
 
-    if (file.type !== 'application/json') {
-      toast.error('Please upload a JSON file');
+    if (!/\.(json|ya?ml)$/i.test(file.name)) {
+      toast.error('Please upload a JSON or YAML file');
       return;
     }
 
     const reader = new FileReader();
     reader.onload = (e) => {
-      try {
-        const content = e.target.result;
-        // Validate JSON format
-        JSON.parse(content);
-        setBulkMappingText(content);
-        toast.success('File uploaded successfully');
-      } catch (error) {
-        toast.error('Invalid JSON file format');
-      }
+      setBulkMappingText(e.target.result);
+      toast.success('File uploaded successfully');
     };
     reader.readAsText(file);
   };
@@ -295,10 +341,28 @@ const Clients = () => {
         </Button>
       </div>
 
+      <div className="flex items-center justify-between">
+        <Input
+          type="search"
+          value={searchInput}
+          onChange={(e) => setSearchInput(e.target.value)}
+          placeholder="Search clients by name"
+          className="max-w-sm"
+        />
+        <p className="text-sm text-gray-500">
+          {totalClients} {totalClients === 1 ? 'client' : 'clients'}
+        </p>
+      </div>
+
       {/* Clients Table */}
       <Card>
         <CardContent className="p-0">
-          {clients.length === 0 ? (
+          {clients.length === 0 && search ? (
+            <div className="text-center py-12">
+              <AlertCircle className="mx-auto h-12 w-12 text-gray-400" />
+              <h3 className="mt-2 text-sm font-medium text-gray-900">No clients match "{search}"</h3>
+            </div>
+          ) : clients.length === 0 ? (
             <div className="text-center py-12">
               <AlertCircle className="mx-auto h-12 w-12 text-gray-400" />
               <h3 className="mt-2 text-sm font-medium text-gray-900">No clients</h3>
@@ -319,6 +383,7 @@ const Clients = () => {
                 <TableRow>
                   <TableHead>ID</TableHead>
                   <TableHead>Name</TableHead>
+                  <TableHead>Status</TableHead>
                   <TableHead>Created</TableHead>
                   <TableHead>Actions</TableHead>
                 </TableRow>
@@ -328,6 +393,11 @@ const Clients = () => {
                   <TableRow key={client.id}>
                     <TableCell className="font-medium">{client.id}</TableCell>
                     <TableCell>{client.name}</TableCell>
+                    <TableCell>
+                      <Badge variant={client.status === 'suspended' ? 'destructive' : 'secondary'}>
+                        {client.status}
+                      </Badge>
+                    </TableCell>
                     <TableCell className="text-gray-500">
                       {new Date(client.created_at).toLocaleDateString()}
                     </TableCell>
@@ -357,6 +427,13 @@ const Clients = () => {
               </TableBody>
             </Table>
           )}
+          <Pager
+            offset={clientsOffset}
+            pageSize={CLIENTS_PAGE_SIZE}
+            total={totalClients}
+            noun="clients"
+            onChange={setClientsOffset}
+          />
         </CardContent>
       </Card>
 
@@ -437,7 +514,7 @@ const Clients = () => {
                   variant="outline"
                   size="sm"
                   onClick={exportMappingRules}
-                  disabled={mappings.length === 0}
+                  disabled={totalMappings === 0}
                 >
                   <Download className="h-4 w-4 mr-1" />
                   Export Rules
@@ -539,6 +616,25 @@ const Clients = () => {
                           placeholder="Value if source is missing"
                         />
                       </div>
+                      <div>
+                        <label className="block text-sm font-medium mb-2">
+                          Merge Strategy
+                        </label>
+                        <Select
+                          value={newMapping.merge_strategy}
+                          onValueChange={(value) => setNewMapping({...newMapping, merge_strategy: value})}
+                        >
+                          <SelectTrigger>
+                            <SelectValue />
+                          </SelectTrigger>
+                          <SelectContent>
+                            <SelectItem value="overwrite">Overwrite</SelectItem>
+                            <SelectItem value="keep-first">Keep first value</SelectItem>
+                            <SelectItem value="append-to-array">Append to array</SelectItem>
+                            <SelectItem value="deep-merge">Deep merge objects</SelectItem>
+                          </SelectContent>
+                        </Select>
+                      </div>
                     </div>
 
                     {newMapping.transform_type === 'expression' && (
@@ -625,7 +721,7 @@ const Clients = () => {
                     </Button>
                   </CardTitle>
                   <CardDescription>
-                    Import multiple mapping rules at once using JSON format. You can also export existing rules as a template.
+                    Import multiple mapping rules at once using JSON or YAML format. You can also export existing rules as a template.
                   </CardDescription>
                 </CardHeader>
                 <CardContent>
@@ -633,12 +729,12 @@ const Clients = () => {
                     <div>
                       <div className="flex items-center justify-between mb-2">
                         <label className="block text-sm font-medium">
-                          Mapping Rules JSON <span className="text-red-500">*</span>
+                          Mapping Rules JSON / YAML <span className="text-red-500">*</span>
                         </label>
                         <div className="flex space-x-2">
                           <input
                             type="file"
-                            accept=".json"
+                            accept=".json,.yaml,.yml"
                             onChange={handleFileUpload}
                             ref={fileInputRef}
                             className="hidden"
@@ -666,14 +762,14 @@ const Clients = () => {
                       <Textarea
                         value={bulkMappingText}
                         onChange={(e) => setBulkMappingText(e.target.value)}
-                        placeholder="Paste your mapping rules JSON here..."
+                        placeholder="Paste your mapping rules JSON or YAML here..."
                         rows={15}
                         className="font-mono text-sm"
                         required
                       />
                       <p className="text-xs text-gray-500 mt-2">
                         Expected format: Array of objects with source_path, destination_path, transform_type, etc.
-                        You can upload a JSON file or paste the content directly.
+                        Rules are matched to existing ones by destination and source path. You can upload a JSON or YAML file or paste the content directly.
                       </p>
                     </div>
 
@@ -686,6 +782,7 @@ const Clients = () => {
                         <li>• <code>transform_logic</code> - Optional logic for expression transforms</li>
                         <li>• <code>default_value</code> - Optional default value</li>
                         <li>• <code>required</code> - Whether field is required (boolean)</li>
+                        <li>• <code>merge_strategy</code> - Optional: overwrite, keep-first, append-to-array or deep-merge</li>
                       </ul>
                     </div>
 
@@ -805,6 +902,13 @@ const Clients = () => {
                 </TableBody>
               </Table>
             )}
+            <Pager
+              offset={mappingsOffset}
+              pageSize={MAPPINGS_PAGE_SIZE}
+              total={totalMappings}
+              noun="rules"
+              onChange={(offset) => loadMappings(selectedClient.id, offset)}
+            />
           </div>
         </DialogContent>
       </Dialog>
@@ -19,10 +19,10 @@ const Dashboard = () => {
 
   const loadStats = async () => {
     try {
-      const clients = await clientsAPI.getAll();
+      const clients = await clientsAPI.getAll({ limit: 1 });
       setStats(prev => ({
         ...prev,
-        totalClients: clients.length
+        totalClients: clients.total
       }));
     } catch (error) {
       toast.error('Failed to load dashboard stats');
@@ -21,8 +21,8 @@ const Transform = () => {
 
   const loadClients = async () => {
     try {
-      const data = await clientsAPI.getAll();
-      setClients(data);
+      const page = await clientsAPI.getAll({ limit: 1000 });
+      setClients(page.data);
     } catch (error) {
       toast.error('Failed to load clients');
     } finally {
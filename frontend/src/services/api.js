@@ -52,8 +52,9 @@ export const authAPI = {
 
 // Clients API
 export const clientsAPI = {
-  getAll: async () => {
-    const response = await api.get('/clients');
+  // Returns a page of clients: { data, total, limit, offset }.
+  getAll: async (params = {}) => {
+    const response = await api.get('/clients', { params });
     return response.data;
   },
   
@@ -62,25 +63,64 @@ export const clientsAPI = {
     return response.data;
   },
   
+  get: async (id) => {
+    const response = await api.get(`/clients/${id}`);
+    return response.data;
+  },
+
+  update: async (id, changes) => {
+    const response = await api.patch(`/clients/${id}`, changes);
+    return response.data;
+  },
+
   delete: async (id) => {
     await api.delete(`/clients/${id}`);
+  },
+
+  restore: async (id) => {
+    const response = await api.post(`/clients/${id}/restore`);
+    return response.data;
   }
 };
 
 // Mapping Rules API
 export const mappingAPI = {
-  getByClient: async (clientId) => {
-    const response = await api.get(`/clients/${clientId}/mappings`);
+  // Returns a page of rules: { data, total, limit, offset }.
+  getByClient: async (clientId, params = {}) => {
+    const response = await api.get(`/clients/${clientId}/mappings`, { params });
     return response.data;
   },
   
-  create: async (clientId, rules) => {
-    const response = await api.post(`/clients/${clientId}/mappings`, rules);
+  create: async (clientId, rules, { dryRun = false } = {}) => {
+    const response = await api.post(`/clients/${clientId}/mappings`, rules, {
+      params: dryRun ? { dryRun: true } : undefined
+    });
     return response.data;
   },
   
   delete: async (mappingId) => {
     await api.delete(`/mappings/${mappingId}`);
+  },
+
+  restore: async (mappingId) => {
+    const response = await api.post(`/mappings/${mappingId}/restore`);
+    return response.data;
+  },
+
+  exportRules: async (clientId, format = 'json', notation = 'dotted') => {
+    const response = await api.get(`/clients/${clientId}/mappings/export`, {
+      params: { format, notation },
+      responseType: 'text'
+    });
+    return response.data;
+  },
+
+  importRules: async (clientId, content, { format = 'json', mode = 'merge', dryRun = false } = {}) => {
+    const response = await api.post(`/clients/${clientId}/mappings/import`, content, {
+      params: { format, mode, ...(dryRun ? { dryRun: true } : {}) },
+      headers: { 'Content-Type': format === 'yaml' ? 'application/yaml' : 'application/json' }
+    });
+    return response.data;
   }
 };
 
@@ -91,6 +131,13 @@ export const transformAPI = {
       input_data: inputData
     });
     return response.data;
+  },
+
+  reverse: async (clientId, targetData) => {
+    const response = await api.post(`/clients/${clientId}/transform/reverse`, {
+      input_data: targetData
+    });
+    return response.data;
   }
 };
 
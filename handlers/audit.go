@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"data_mapping/repository"
+	"data_mapping/services"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// recordAudit records a change made by the request c. See
+// services.RecordAudit.
+func recordAudit(audit repository.AuditRepository, c *gin.Context, clientID uint, entity string, entityID uint, action string, before, after interface{}) error {
+	return services.RecordAudit(audit, actorFrom(c), clientID, entity, entityID, action, before, after)
+}
+
+// actorFrom identifies the authenticated user making the request c.
+func actorFrom(c *gin.Context) services.Actor {
+	return services.Actor{User: c.GetString("user"), RequestID: c.GetString("request_id")}
+}
+
+// ListAuditEvents returns audit events, newest first, filtered by client,
+// actor, entity and time range.
+func ListAuditEvents(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := repository.AuditFilter{
+			Actor:  c.Query("actor"),
+			Entity: c.Query("entity"),
+			Action: c.Query("action"),
+		}
+
+		if clientID := c.Query("client_id"); clientID != "" {
+			id, err := strconv.Atoi(clientID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client_id"})
+				return
+			}
+			filter.ClientID = new(uint)
+			*filter.ClientID = uint(id)
+		}
+		if entityID := c.Query("entity_id"); entityID != "" {
+			id, err := strconv.Atoi(entityID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid entity_id"})
+				return
+			}
+			filter.EntityID = uint(id)
+		}
+		if from := c.Query("from"); from != "" {
+			t, err := time.Parse(time.RFC3339, from)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'from' time, expected RFC3339"})
+				return
+			}
+			filter.From = t
+		}
+		if to := c.Query("to"); to != "" {
+			t, err := time.Parse(time.RFC3339, to)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'to' time, expected RFC3339"})
+				return
+			}
+			filter.To = t
+		}
+
+		limit, offset, err := parseLimitOffset(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		events, total, err := store.Audit().List(filter, limit, offset)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    events,
+			"total":   total,
+			"limit":   limit,
+			"offset":  offset,
+		})
+	}
+}
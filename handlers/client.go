@@ -2,15 +2,16 @@ package handlers
 
 import (
 	"data_mapping/models"
-	"data_mapping/utils"
+	"data_mapping/repository"
+	"data_mapping/services"
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
-func CreateClient(db *gorm.DB) gin.HandlerFunc {
+func CreateClient(store repository.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req models.CreateClientRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
@@ -21,23 +22,19 @@ func CreateClient(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Validate the request
-		if err := utils.ValidateStruct(req); err != nil {
+		client, err := services.CreateClient(store, actorFrom(c), req)
+		var inputErr *services.InputError
+		if errors.As(err, &inputErr) {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"error":   "Validation failed",
 				"details": err.Error(),
 			})
 			return
 		}
-
-		client := models.Client{
-			Name: req.Name,
-		}
-
-		if result := db.Create(&client); result.Error != nil {
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error":   "Failed to create client",
-				"details": result.Error.Error(),
+				"details": err.Error(),
 			})
 			return
 		}
@@ -49,32 +46,211 @@ func CreateClient(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-func ListClients(db *gorm.DB) gin.HandlerFunc {
+// ListClients returns a page of clients. search matches names containing it;
+// status and partner_code filter exactly.
+func ListClients(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter := repository.ClientFilter{
+			Name:        c.Query("search"),
+			Status:      c.Query("status"),
+			PartnerCode: c.Query("partner_code"),
+		}
+		var err error
+		if filter.Sort, err = parseSort(c, repository.ClientSortFields); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		limit, offset, err := parseLimitOffset(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		clients, total, err := store.Clients().Search(filter, limit, offset)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    clients,
+			"total":   total,
+			"limit":   limit,
+			"offset":  offset,
+		})
+	}
+}
+
+func GetClient(store repository.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var clients []models.Client
-		if result := db.Find(&clients); result.Error != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		id, err := strconv.Atoi(c.Param("client_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		client, err := store.Clients().Get(uint(id))
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
 			return
 		}
-		c.JSON(http.StatusOK, clients)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    client,
+		})
+	}
+}
+
+// UpdateClient changes a client's name, status, metadata or settings. Fields
+// missing from the body keep their value.
+func UpdateClient(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("client_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+		var req models.UpdateClientRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		client, err := services.UpdateClient(store, actorFrom(c), uint(id), req)
+		var inputErr *services.InputError
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
+		case errors.As(err, &inputErr):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": err.Error(),
+			})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to update client",
+				"details": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusOK, gin.H{
+				"success": true,
+				"data":    client,
+			})
+		}
 	}
 }
 
-func DeleteClient(db *gorm.DB) gin.HandlerFunc {
+func DeleteClient(store repository.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id, err := strconv.Atoi(c.Param("id"))
+		id, err := strconv.Atoi(c.Param("client_id"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
 			return
 		}
-		if result := db.Where("client_id = ?", id).Delete(&models.MappingRule{}); result.Error != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+
+		err = services.DeleteClient(store, actorFrom(c), uint(id))
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
 			return
 		}
-		if result := db.Delete(&models.Client{}, id); result.Error != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 		c.Status(http.StatusNoContent)
 	}
 }
+
+// CloneClient creates a client from a copy of another client's rules,
+// layouts and input schema, optionally rewriting path prefixes.
+func CloneClient(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("client_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+		var req models.CloneClientRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		result, err := services.CloneClient(store, actorFrom(c), uint(id), req)
+		var inputErr *services.InputError
+		var validationErr *services.ValidationError
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
+		case errors.As(err, &inputErr):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": err.Error(),
+			})
+		case errors.As(err, &validationErr):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Rewritten mapping rules are invalid",
+				"details": validationErr.Issues,
+			})
+		case errors.Is(err, services.ErrRuleConflicts):
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "Rewritten mapping rules conflict",
+				"details": result.Conflicts,
+			})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to clone client",
+				"details": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusCreated, gin.H{
+				"success": true,
+				"data":    result,
+			})
+		}
+	}
+}
+
+// RestoreClient takes a client and the mapping rules deleted with it out of
+// the trash.
+func RestoreClient(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("client_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+			return
+		}
+
+		client, rules, err := services.RestoreClient(store, actorFrom(c), uint(id))
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Deleted client not found"})
+		case errors.Is(err, services.ErrClientNameTaken):
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "Client name is taken",
+				"details": "rename or delete the client named " + strconv.Quote(client.Name) + " first",
+			})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to restore client",
+				"details": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusOK, gin.H{
+				"success":       true,
+				"data":          client,
+				"mapping_rules": rules,
+			})
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"bufio"
+	"data_mapping/models"
+	"data_mapping/utils"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	formatJSON       = "json"
+	formatNDJSON     = "ndjson"
+	formatCSV        = "csv"
+	formatXML        = "xml"
+	formatFixedWidth = "fixed-width"
+)
+
+// issuesHeader carries per-field fixed-width issues. It is sent as a trailer
+// when the output is streamed.
+const issuesHeader = "X-Transform-Issues"
+
+// streamErrorHeader is the trailer reporting an error that ended a streamed
+// response after its status was sent.
+const streamErrorHeader = "X-Transform-Error"
+
+// droppedRecordsHeader is the trailer counting the failed records left out
+// of streamed CSV without an error column.
+const droppedRecordsHeader = "X-Dropped-Records"
+
+var formatContentTypes = map[string]string{
+	formatJSON:       "application/json",
+	formatNDJSON:     "application/x-ndjson",
+	formatCSV:        "text/csv",
+	formatXML:        "application/xml",
+	formatFixedWidth: "application/x-fixed-width",
+}
+
+// formatOptions carries the format-specific settings of one transform call.
+type formatOptions struct {
+	CSV        utils.CSVOptions
+	XML        models.XMLLayout
+	FixedWidth models.FixedWidthLayout
+}
+
+// requestFormat returns the input format named by the Content-Type header.
+func requestFormat(c *gin.Context) (string, error) {
+	switch c.ContentType() {
+	case "", "application/json":
+		return formatJSON, nil
+	case "application/x-ndjson":
+		return formatNDJSON, nil
+	case "text/csv":
+		return formatCSV, nil
+	case "application/xml", "text/xml":
+		return formatXML, nil
+	default:
+		return "", fmt.Errorf("unsupported Content-Type %q", c.ContentType())
+	}
+}
+
+// responseFormat picks the output format from the Accept header, falling back
+// to fallback when the caller accepts anything.
+func responseFormat(c *gin.Context, fallback string) (string, error) {
+	accept := c.GetHeader("Accept")
+	if accept == "" {
+		return fallback, nil
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		switch mediaType {
+		case "*/*":
+			return fallback, nil
+		case "application/json":
+			return formatJSON, nil
+		case "application/x-ndjson":
+			return formatNDJSON, nil
+		case "text/csv":
+			return formatCSV, nil
+		case "application/xml", "text/xml":
+			return formatXML, nil
+		case "application/x-fixed-width":
+			return formatFixedWidth, nil
+		}
+	}
+	return "", fmt.Errorf("none of the accepted media types %q are supported", accept)
+}
+
+// csvOptionsFromRequest reads CSV options from the delimiter, quote, columns,
+// column_types and error_column query parameters.
+func csvOptionsFromRequest(c *gin.Context) (utils.CSVOptions, error) {
+	opts := utils.DefaultCSVOptions()
+
+	if delimiter := c.Query("delimiter"); delimiter != "" {
+		switch delimiter {
+		case "tab", "\\t":
+			opts.Delimiter = '\t'
+		default:
+			r, size := utf8.DecodeRuneInString(delimiter)
+			if size != len(delimiter) || r == '"' || r == '\n' || r == '\r' {
+				return opts, fmt.Errorf("delimiter must be a single character other than a quote or newline")
+			}
+			opts.Delimiter = r
+		}
+	}
+	if quote := c.Query("quote"); quote != "" {
+		if quote != utils.CSVQuoteMinimal && quote != utils.CSVQuoteAll {
+			return opts, fmt.Errorf("quote must be 'minimal' or 'all'")
+		}
+		opts.Quote = quote
+	}
+	if columns := c.Query("columns"); columns != "" {
+		for _, column := range strings.Split(columns, ",") {
+			if column = strings.TrimSpace(column); column != "" {
+				opts.Columns = append(opts.Columns, column)
+			}
+		}
+	}
+	types, err := utils.ParseCSVColumnTypes(c.Query("column_types"))
+	if err != nil {
+		return opts, err
+	}
+	opts.ColumnTypes = types
+	opts.ErrorColumn = c.Query("error_column")
+	return opts, nil
+}
+
+// newRecordDecoder returns a decoder for a streamed body. JSON input must be
+// an array of records.
+func newRecordDecoder(body io.Reader, format string, opts formatOptions) (utils.RecordDecoder, error) {
+	switch format {
+	case formatCSV:
+		return utils.NewCSVDecoder(body, opts.CSV), nil
+	case formatXML:
+		return utils.NewXMLDecoder(body), nil
+	case formatNDJSON:
+		return utils.NewRecordDecoder(body, utils.RecordFormatNDJSON), nil
+	default:
+		br := bufio.NewReader(body)
+		detected, err := utils.DetectRecordFormat(br)
+		if err != nil || detected != utils.RecordFormatJSONArray {
+			return nil, fmt.Errorf("streamed JSON input must be an array of records for this output format")
+		}
+		return utils.NewRecordDecoder(br, utils.RecordFormatJSONArray), nil
+	}
+}
+
+func newRecordWriter(w io.Writer, format string, rules []models.MappingRule, opts formatOptions) utils.RecordWriter {
+	switch format {
+	case formatCSV:
+		return utils.NewCSVRecordWriter(w, rules, opts.CSV)
+	case formatXML:
+		return utils.NewXMLRecordWriter(w, rules, opts.XML)
+	case formatFixedWidth:
+		return utils.NewFixedWidthRecordWriter(w, opts.FixedWidth)
+	case formatNDJSON:
+		return utils.NewNDJSONRecordWriter(w)
+	default:
+		return utils.NewJSONArrayRecordWriter(w)
+	}
+}
+
+// encodeIssues renders fixed-width issues for the issues header, keeping the
+// first few so that the header stays small.
+func encodeIssues(issues []utils.FieldIssue) string {
+	const maxIssues = 50
+	if len(issues) > maxIssues {
+		issues = issues[:maxIssues]
+	}
+	data, _ := json.Marshal(issues)
+	return string(data)
+}
@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"bytes"
+	"data_mapping/config"
+	"data_mapping/database"
+	"data_mapping/database/migrations"
+	"data_mapping/models"
+	"data_mapping/repository"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB opens a migrated SQLite database in a temporary directory.
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := database.Connect(config.Config{DBDriver: "sqlite", SQLitePath: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db = db.Session(&gorm.Session{Logger: logger.Discard})
+	if _, err := migrations.Up(db); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func newTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user", "tester")
+		c.Next()
+	})
+	return router
+}
+
+// doJSON sends body as JSON and decodes the JSON response into a map.
+func doJSON(t *testing.T, router http.Handler, method, path string, body interface{}) (int, map[string]interface{}) {
+	t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("%s %s: invalid JSON response %q", method, path, rec.Body.String())
+	}
+	return rec.Code, response
+}
+
+func createTestClient(t *testing.T, store repository.Store, name, status string) models.Client {
+	t.Helper()
+	client := models.Client{Name: name, Status: status}
+	if err := store.Clients().Create(&client); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func TestCreateClient(t *testing.T) {
+	store := repository.New(newTestDB(t))
+	router := newTestRouter()
+	router.POST("/clients", CreateClient(store))
+
+	code, response := doJSON(t, router, http.MethodPost, "/clients", map[string]interface{}{"name": "Acme", "tags": []string{"bank"}})
+	if code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d: %v", code, http.StatusCreated, response)
+	}
+	data := response["data"].(map[string]interface{})
+	if data["name"] != "Acme" || data["status"] != models.ClientStatusActive {
+		t.Errorf("unexpected client %v", data)
+	}
+	if _, err := store.Clients().Get(uint(data["id"].(float64))); err != nil {
+		t.Errorf("client was not stored: %v", err)
+	}
+
+	code, response = doJSON(t, router, http.MethodPost, "/clients", map[string]interface{}{"status": "draft"})
+	if code != http.StatusBadRequest {
+		t.Errorf("missing name: status = %d, want %d: %v", code, http.StatusBadRequest, response)
+	}
+}
+
+func TestCreateMappingsUpserts(t *testing.T) {
+	store := repository.New(newTestDB(t))
+	client := createTestClient(t, store, "Acme", models.ClientStatusActive)
+	router := newTestRouter()
+	router.POST("/clients/:client_id/mappings", CreateMappings(store))
+	path := "/clients/" + strconv.Itoa(int(client.ID)) + "/mappings"
+
+	rules := []map[string]interface{}{
+		{"source_path": "applicant.name", "destination_path": "name", "transform_type": "copy"},
+		{"source_path": "applicant.age", "destination_path": "age", "transform_type": "copy"},
+	}
+	code, response := doJSON(t, router, http.MethodPost, path, rules)
+	if code != http.StatusCreated {
+		t.Fatalf("create: status = %d, want %d: %v", code, http.StatusCreated, response)
+	}
+
+	code, response = doJSON(t, router, http.MethodPost, path, rules)
+	if code != http.StatusOK {
+		t.Fatalf("repeat: status = %d, want %d: %v", code, http.StatusOK, response)
+	}
+	if unchanged := response["changes"].(map[string]interface{})["unchanged"]; unchanged != float64(2) {
+		t.Errorf("repeat: unchanged = %v, want 2", unchanged)
+	}
+
+	// Only the merge strategy changes, in both directions.
+	for _, strategy := range []string{models.MergeKeepFirst, models.MergeOverwrite} {
+		rules[1]["merge_strategy"] = strategy
+		code, response = doJSON(t, router, http.MethodPost, path, rules[1:])
+		if code != http.StatusOK {
+			t.Fatalf("update to %s: status = %d, want %d: %v", strategy, code, http.StatusOK, response)
+		}
+		stored, err := store.Mappings().ListByClient(client.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stored) != 2 || stored[1].Strategy() != strategy {
+			t.Errorf("stored rules = %+v, want age updated in place to %s", stored, strategy)
+		}
+	}
+
+	duplicate := []map[string]interface{}{
+		{"source_path": "a", "destination_path": "x", "transform_type": "copy"},
+		{"source_path": "a", "destination_path": "x", "transform_type": "copy", "merge_strategy": "keep-first"},
+	}
+	if code, response = doJSON(t, router, http.MethodPost, path, duplicate); code != http.StatusBadRequest {
+		t.Errorf("duplicate rule: status = %d, want %d: %v", code, http.StatusBadRequest, response)
+	}
+
+	rules[1]["source_path"] = "applicant.years"
+	if code, response = doJSON(t, router, http.MethodPost, path, rules[1:]); code != http.StatusConflict {
+		t.Errorf("second overwrite rule for age: status = %d, want %d: %v", code, http.StatusConflict, response)
+	}
+}
+
+func TestUnifiedTransformHandler(t *testing.T) {
+	db := newTestDB(t)
+	store := repository.New(db)
+	router := newTestRouter()
+	router.POST("/clients/:client_id/transform", UnifiedTransformHandler(store, config.Config{}))
+
+	client := createTestClient(t, store, "Acme", models.ClientStatusActive)
+	rules := []models.MappingRule{
+		{ClientID: client.ID, SourcePath: models.JSONStringList{"applicant", "name"}, DestinationPath: models.JSONStringList{"customer", "name"}, TransformType: "copy"},
+		{ClientID: client.ID, SourcePath: models.JSONStringList{"gender"}, DestinationPath: models.JSONStringList{"gender_code"}, TransformType: "lookup", LookupTable: models.JSONStringMap{"FEMALE": "F"}},
+	}
+	for i := range rules {
+		if err := store.Mappings().Create(&rules[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	input := map[string]interface{}{"input_data": map[string]interface{}{"applicant": map[string]interface{}{"name": "Asha"}, "gender": "FEMALE"}}
+	code, response := doJSON(t, router, http.MethodPost, "/clients/"+strconv.Itoa(int(client.ID))+"/transform", input)
+	if code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %v", code, http.StatusOK, response)
+	}
+	data, _ := json.Marshal(response["data"])
+	if want := `{"customer":{"name":"Asha"},"gender_code":"F"}`; string(data) != want {
+		t.Errorf("data = %s, want %s", data, want)
+	}
+
+	suspended := createTestClient(t, store, "Dormant", models.ClientStatusSuspended)
+	if code, response = doJSON(t, router, http.MethodPost, "/clients/"+strconv.Itoa(int(suspended.ID))+"/transform", input); code != http.StatusForbidden {
+		t.Errorf("suspended client: status = %d, want %d: %v", code, http.StatusForbidden, response)
+	}
+	if code, response = doJSON(t, router, http.MethodPost, "/clients/999/transform", input); code != http.StatusNotFound {
+		t.Errorf("unknown client: status = %d, want %d: %v", code, http.StatusNotFound, response)
+	}
+
+	// A body without a length is capped as it is read.
+	large := `{"input_data": {"applicant": {"name": "` + strings.Repeat("x", 11<<20) + `"}}}`
+	req := httptest.NewRequest(http.MethodPost, "/clients/"+strconv.Itoa(int(client.ID))+"/transform", io.MultiReader(strings.NewReader(large)))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("chunked 11MB body: status = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestUnifiedTransformHandlerCSVStream(t *testing.T) {
+	store := repository.New(newTestDB(t))
+	router := newTestRouter()
+	router.POST("/clients/:client_id/transform", UnifiedTransformHandler(store, config.Config{}))
+
+	client := createTestClient(t, store, "Acme", models.ClientStatusActive)
+	rule := models.MappingRule{ClientID: client.ID, SourcePath: models.JSONStringList{"age"}, DestinationPath: models.JSONStringList{"age"}, TransformType: "copy"}
+	if err := store.Mappings().Create(&rule); err != nil {
+		t.Fatal(err)
+	}
+	path := "/clients/" + strconv.Itoa(int(client.ID)) + "/transform?column_types=age:integer"
+
+	post := func(body io.Reader) *http.Response {
+		req := httptest.NewRequest(http.MethodPost, path, body)
+		req.Header.Set("Content-Type", "text/csv")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec.Result()
+	}
+
+	res := post(strings.NewReader("age\n41\nold\n"))
+	data, _ := io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK || string(data) != "age\n41\n" {
+		t.Errorf("status = %d, body %q, want the valid row", res.StatusCode, data)
+	}
+	if got := res.Trailer.Get("X-Dropped-Records"); got != "1" {
+		t.Errorf("X-Dropped-Records = %q, want 1", got)
+	}
+
+	res = post(io.MultiReader(strings.NewReader("age\n41\n"), iotest.ErrReader(errors.New("connection reset"))))
+	data, _ = io.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK || string(data) != "age\n41\n" {
+		t.Errorf("status = %d, body %q, want the rows before the failure", res.StatusCode, data)
+	}
+	if got := res.Trailer.Get("X-Transform-Error"); got != "connection reset" {
+		t.Errorf("X-Transform-Error = %q, want the read error", got)
+	}
+
+	res = post(strings.NewReader(""))
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("empty body: status = %d, want %d", res.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestTransformRunInputHash(t *testing.T) {
+	store := repository.New(newTestDB(t))
+	router := newTestRouter()
+	router.POST("/clients/:client_id/transform", UnifiedTransformHandler(store, config.Config{RecordTransformRuns: true}))
+
+	client := createTestClient(t, store, "Acme", models.ClientStatusActive)
+	rule := models.MappingRule{ClientID: client.ID, SourcePath: models.JSONStringList{"name"}, DestinationPath: models.JSONStringList{"customer"}, TransformType: "copy"}
+	if err := store.Mappings().Create(&rule); err != nil {
+		t.Fatal(err)
+	}
+
+	// The same record sent in one request, streamed as NDJSON and streamed
+	// as a JSON array gets the same hash.
+	requests := []struct{ contentType, stream, body string }{
+		{"application/json", "", `{"input_data": {"name": "Asha", "age": 41}}`},
+		{"application/x-ndjson", "", "{\"age\":41,\"name\":\"Asha\"}\n"},
+		{"application/json", "true", `[{"name":"Asha","age":41}]`},
+	}
+	for _, r := range requests {
+		req := httptest.NewRequest(http.MethodPost, "/clients/"+strconv.Itoa(int(client.ID))+"/transform", strings.NewReader(r.body))
+		req.Header.Set("Content-Type", r.contentType)
+		req.Header.Set("X-Stream-Transform", r.stream)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, body %s", r.contentType, rec.Code, rec.Body.String())
+		}
+	}
+
+	runs, total, err := store.Runs().Search(client.ID, repository.RunFilter{}, 10, 0)
+	if err != nil || total != 3 || runs[0].InputHash == "" {
+		t.Fatalf("Search = %+v, %v, want 3 hashed runs", runs, err)
+	}
+	for _, run := range runs[1:] {
+		if run.InputHash != runs[0].InputHash {
+			t.Errorf("input hashes = %q and %q, want them equal", runs[0].InputHash, run.InputHash)
+		}
+	}
+}
+
+func TestCreateBatchJobChecksClient(t *testing.T) {
+	store := repository.New(newTestDB(t))
+	router := newTestRouter()
+	router.POST("/clients/:client_id/jobs", CreateBatchJob(store, nil, config.Config{BatchMaxUploadMB: 1}))
+
+	suspended := createTestClient(t, store, "Dormant", models.ClientStatusSuspended)
+	if code, response := doJSON(t, router, http.MethodPost, "/clients/"+strconv.Itoa(int(suspended.ID))+"/jobs", []interface{}{}); code != http.StatusForbidden {
+		t.Errorf("suspended client: status = %d, want %d: %v", code, http.StatusForbidden, response)
+	}
+	if code, response := doJSON(t, router, http.MethodPost, "/clients/999/jobs", []interface{}{}); code != http.StatusNotFound {
+		t.Errorf("unknown client: status = %d, want %d: %v", code, http.StatusNotFound, response)
+	}
+}
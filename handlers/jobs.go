@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"bufio"
+	"data_mapping/config"
+	"data_mapping/jobs"
+	"data_mapping/models"
+	"data_mapping/repository"
+	"data_mapping/services"
+	"data_mapping/utils"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CreateBatchJob accepts an NDJSON or JSON array upload, either as the raw
+// request body or as the "file" field of a multipart form, and queues it for
+// asynchronous transformation.
+func CreateBatchJob(store repository.Store, runner *jobs.BatchRunner, cfg config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientID, err := strconv.Atoi(c.Param("client_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
+			return
+		}
+
+		// Loading the transform options rejects suspended clients and
+		// settings the worker could not apply before anything is queued.
+		client, _, err := services.ClientTransformOptions(store, uint(clientID))
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
+			return
+		}
+		if errors.Is(err, services.ErrClientSuspended) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "Client is suspended",
+				"details": "reactivate client " + strconv.Quote(client.Name) + " to transform its data",
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to load client settings",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		outputFormat := c.DefaultQuery("output_format", models.JobOutputNDJSON)
+		switch outputFormat {
+		case models.JobOutputNDJSON:
+		case models.JobOutputFixedWidth:
+			if _, err := loadFixedWidthLayout(store, client.ID); err != nil {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+				return
+			}
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "output_format must be 'ndjson' or 'fixed-width'"})
+			return
+		}
+
+		maxBytes := int64(cfg.BatchMaxUploadMB) * 1024 * 1024
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+
+		var body io.Reader = c.Request.Body
+		contentType := c.ContentType()
+		if strings.HasPrefix(contentType, "multipart/form-data") {
+			fileHeader, err := c.FormFile("file")
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error":   "Missing upload",
+					"details": err.Error(),
+				})
+				return
+			}
+			file, err := fileHeader.Open()
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error":   "Failed to read upload",
+					"details": err.Error(),
+				})
+				return
+			}
+			defer file.Close()
+			body = file
+			if strings.HasSuffix(fileHeader.Filename, ".ndjson") || strings.HasSuffix(fileHeader.Filename, ".jsonl") {
+				contentType = "application/x-ndjson"
+			}
+		}
+
+		reader := bufio.NewReader(body)
+		format := c.Query("format")
+		if format == "" && contentType == "application/x-ndjson" {
+			format = utils.RecordFormatNDJSON
+		}
+		if format == "" {
+			format, err = utils.DetectRecordFormat(reader)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error":   "Empty or unreadable upload",
+					"details": err.Error(),
+				})
+				return
+			}
+		}
+		if format != utils.RecordFormatNDJSON && format != utils.RecordFormatJSONArray {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "format must be 'ndjson' or 'json'"})
+			return
+		}
+
+		user, _ := c.Get("user")
+		userStr, _ := user.(string)
+		job := models.BatchJob{
+			ClientID:     client.ID,
+			Status:       models.JobStatusQueued,
+			InputFormat:  format,
+			OutputFormat: outputFormat,
+			CreatedBy:    userStr,
+		}
+		// The job and its upload are stored together so that no runner
+		// claims a job whose upload is incomplete.
+		upload := &uploadReader{r: reader}
+		err = store.Transaction(func(tx repository.Store) error {
+			if err := tx.Jobs().Create(&job); err != nil {
+				return err
+			}
+			input, err := tx.Jobs().WriteBody(job.ID, models.JobBodyInput)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(input, upload); err != nil {
+				return err
+			}
+			return input.Close()
+		})
+		if upload.err != nil {
+			var maxBytesErr *http.MaxBytesError
+			status := http.StatusBadRequest
+			if errors.As(upload.err, &maxBytesErr) {
+				status = http.StatusRequestEntityTooLarge
+			}
+			c.JSON(status, gin.H{
+				"error":   "Failed to read upload",
+				"details": upload.err.Error(),
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to create batch job",
+				"details": err.Error(),
+			})
+			return
+		}
+		runner.Enqueue(job.ID)
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"success": true,
+			"data":    batchJobResponse(job),
+		})
+	}
+}
+
+// ListClientJobs returns a client's batch jobs, newest first.
+func ListClientJobs(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientID, err := strconv.Atoi(c.Param("client_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
+			return
+		}
+
+		limit, offset, err := parseLimitOffset(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		batchJobs, total, err := store.Jobs().Search(uint(clientID), c.Query("status"), limit, offset)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		data := make([]gin.H, len(batchJobs))
+		for i, job := range batchJobs {
+			data[i] = batchJobResponse(job)
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    data,
+			"total":   total,
+			"limit":   limit,
+			"offset":  offset,
+		})
+	}
+}
+
+// GetBatchJob returns a job's status and progress.
+func GetBatchJob(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		job, ok := loadBatchJob(store, c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    batchJobResponse(*job),
+		})
+	}
+}
+
+// DownloadBatchJobOutput returns the transformed records of a completed job:
+// NDJSON with one {"index","data"} object per successful input record, or one
+// line per record for fixed-width jobs.
+func DownloadBatchJobOutput(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		job, ok := loadCompletedBatchJob(store, c)
+		if !ok {
+			return
+		}
+		if job.OutputFormat == models.JobOutputFixedWidth {
+			serveBatchJobBody(c, store, job.ID, models.JobBodyOutput, "job-"+strconv.Itoa(int(job.ID))+"-output.txt", formatContentTypes[formatFixedWidth])
+			return
+		}
+		serveBatchJobBody(c, store, job.ID, models.JobBodyOutput, "job-"+strconv.Itoa(int(job.ID))+"-output.ndjson", "application/x-ndjson")
+	}
+}
+
+// DownloadBatchJobErrors returns per-record errors and warnings as NDJSON.
+func DownloadBatchJobErrors(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		job, ok := loadCompletedBatchJob(store, c)
+		if !ok {
+			return
+		}
+		serveBatchJobBody(c, store, job.ID, models.JobBodyErrors, "job-"+strconv.Itoa(int(job.ID))+"-errors.ndjson", "application/x-ndjson")
+	}
+}
+
+// uploadReader remembers why reading an upload failed, telling a bad or
+// oversized upload apart from a failure to store it.
+type uploadReader struct {
+	r   io.Reader
+	err error
+}
+
+func (u *uploadReader) Read(p []byte) (int, error) {
+	n, err := u.r.Read(p)
+	if err != nil && err != io.EOF {
+		u.err = err
+	}
+	return n, err
+}
+
+// serveBatchJobBody streams a body of a job as a download. Its size is not
+// known up front, so the response is chunked.
+func serveBatchJobBody(c *gin.Context, store repository.Store, jobID uint, body, filename, contentType string) {
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.DataFromReader(http.StatusOK, -1, contentType, store.Jobs().ReadBody(jobID, body), nil)
+}
+
+func loadCompletedBatchJob(store repository.Store, c *gin.Context) (*models.BatchJob, bool) {
+	job, ok := loadBatchJob(store, c)
+	if !ok {
+		return nil, false
+	}
+	if job.Status != models.JobStatusCompleted {
+		c.JSON(http.StatusConflict, gin.H{"error": "Batch job has not completed", "status": job.Status})
+		return nil, false
+	}
+	return job, true
+}
+
+// loadBatchJob loads the job named by the request.
+func loadBatchJob(store repository.Store, c *gin.Context) (*models.BatchJob, bool) {
+	jobID, err := strconv.Atoi(c.Param("job_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return nil, false
+	}
+	job, err := store.Jobs().Get(uint(jobID))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Batch job not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return &job, true
+}
+
+func batchJobResponse(job models.BatchJob) gin.H {
+	return gin.H{
+		"job":      job,
+		"progress": job.Progress(),
+	}
+}
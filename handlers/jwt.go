@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"data_mapping/repository"
+	"data_mapping/services"
 	"net/http"
 	"time"
 
@@ -8,8 +10,6 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtSecret = []byte("your_secret_key")
-
 type LoginRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
@@ -19,18 +19,21 @@ type LoginResponse struct {
 	Token string `json:"token"`
 }
 
-func AuthenticateUser(username, password string) bool {
-	return username == "admin" && password == "password"
-}
-
-func LoginHandler() gin.HandlerFunc {
+// LoginHandler checks credentials against users and issues tokens signed
+// with secret.
+func LoginHandler(secret []byte, users repository.UserRepository) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var req LoginRequest
 		if err := c.ShouldBindJSON(&req); err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
-		if !AuthenticateUser(req.Username, req.Password) {
+		ok, err := services.Authenticate(users, req.Username, req.Password)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not check credentials"})
+			return
+		}
+		if !ok {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
 			return
 		}
@@ -38,7 +41,7 @@ func LoginHandler() gin.HandlerFunc {
 			"username": req.Username,
 			"exp":      time.Now().Add(time.Hour * 24).Unix(),
 		})
-		tokenString, err := token.SignedString(jwtSecret)
+		tokenString, err := token.SignedString(secret)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "could not generate token"})
 			return
@@ -47,7 +50,7 @@ func LoginHandler() gin.HandlerFunc {
 	}
 }
 
-func JWTAuthMiddleware() gin.HandlerFunc {
+func JWTAuthMiddleware(secret []byte) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		header := c.GetHeader("Authorization")
 		if header == "" {
@@ -63,13 +66,18 @@ func JWTAuthMiddleware() gin.HandlerFunc {
 			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 				return nil, jwt.ErrSignatureInvalid
 			}
-			return jwtSecret, nil
+			return secret, nil
 		})
 		if err != nil || !token.Valid {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
 			c.Abort()
 			return
 		}
+		if claims, ok := token.Claims.(jwt.MapClaims); ok {
+			if username, ok := claims["username"].(string); ok {
+				c.Set("user", username)
+			}
+		}
 		c.Next()
 	}
 }
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"data_mapping/models"
+	"data_mapping/repository"
+	"data_mapping/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// decodeLayout parses and validates a layout definition for format.
+func decodeLayout(format string, definition []byte) (interface{}, error) {
+	switch format {
+	case models.LayoutFormatXML:
+		return utils.DecodeXMLLayout(definition)
+	case models.LayoutFormatFixedWidth:
+		return utils.DecodeFixedWidthLayout(definition)
+	default:
+		return nil, fmt.Errorf("unsupported layout format %q", format)
+	}
+}
+
+// loadLayoutDefinition returns the stored layout definition of a client for
+// format, or nil when none is configured.
+func loadLayoutDefinition(store repository.Store, clientID uint, format string) ([]byte, error) {
+	stored, err := store.Layouts().Get(clientID, format)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stored.Definition, nil
+}
+
+// loadXMLLayout returns the client's XML layout, or the default layout when
+// none is configured.
+func loadXMLLayout(store repository.Store, clientID uint) (models.XMLLayout, error) {
+	definition, err := loadLayoutDefinition(store, clientID, models.LayoutFormatXML)
+	if err != nil || definition == nil {
+		return utils.DefaultXMLLayout(), err
+	}
+	return utils.DecodeXMLLayout(definition)
+}
+
+// loadFixedWidthLayout returns the client's fixed-width layout. There is no
+// default, so a client without one cannot produce fixed-width output.
+func loadFixedWidthLayout(store repository.Store, clientID uint) (models.FixedWidthLayout, error) {
+	definition, err := loadLayoutDefinition(store, clientID, models.LayoutFormatFixedWidth)
+	if err != nil {
+		return models.FixedWidthLayout{}, err
+	}
+	if definition == nil {
+		return models.FixedWidthLayout{}, errNoFixedWidthLayout
+	}
+	return utils.DecodeFixedWidthLayout(definition)
+}
+
+var errNoFixedWidthLayout = errors.New("no fixed-width layout is configured for this client")
+
+// GetLayout returns a client's layout for one output format.
+func GetLayout(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientID, err := strconv.Atoi(c.Param("client_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
+			return
+		}
+		layout, err := store.Layouts().Get(uint(clientID), c.Param("format"))
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Layout not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    layout,
+		})
+	}
+}
+
+// PutLayout creates or replaces a client's layout for one output format.
+func PutLayout(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientID, err := strconv.Atoi(c.Param("client_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
+			return
+		}
+		format := c.Param("format")
+
+		var definition json.RawMessage
+		if err := c.ShouldBindJSON(&definition); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+			return
+		}
+		if _, err := decodeLayout(format, definition); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid layout",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		client, err := store.Clients().Get(uint(clientID))
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		layout := models.OutputLayout{
+			ClientID:   client.ID,
+			Format:     format,
+			Definition: models.JSONDocument(definition),
+		}
+		if err := store.Layouts().Save(&layout); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to save layout",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    layout,
+		})
+	}
+}
+
+// DeleteLayout removes a client's layout for one output format.
+func DeleteLayout(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientID, err := strconv.Atoi(c.Param("client_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
+			return
+		}
+		err = store.Layouts().Delete(uint(clientID), c.Param("format"))
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Layout not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"data_mapping/models"
+	"data_mapping/repository"
+	"data_mapping/services"
+	"data_mapping/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LintMappings statically checks a client's rule set without running it. A
+// JSON array of rules in the body is merged into the stored rules first, the
+// same way CreateMappings would save them, so rules can be checked before
+// they are saved. Rules inherited from the client's templates are checked too.
+func LintMappings(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientID, err := strconv.Atoi(c.Param("client_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
+			return
+		}
+
+		var incoming []models.MappingRule
+		if c.Request.ContentLength != 0 {
+			if err := c.ShouldBindJSON(&incoming); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error":   "Invalid request body",
+					"details": err.Error(),
+				})
+				return
+			}
+		}
+		for i := range incoming {
+			incoming[i].ID = 0
+			incoming[i].ClientID = uint(clientID)
+		}
+
+		existing, err := store.Mappings().ListByClient(uint(clientID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to load mapping rules",
+				"details": err.Error(),
+			})
+			return
+		}
+		templates, err := store.Templates().ListByClient(uint(clientID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to load rule templates",
+				"details": err.Error(),
+			})
+			return
+		}
+		plan := utils.PlanMappingChanges(existing, incoming, false)
+		planned, _ := utils.PlannedRules(existing, plan)
+		rules := services.MappingRules(services.ResolveRules(uint(clientID), templates, planned))
+
+		issues := utils.LintRules(rules)
+		if issues == nil {
+			issues = []utils.LintIssue{}
+		}
+		conflicts, _ := services.PlannedConflicts(uint(clientID), templates, existing, plan)
+
+		var errorCount, warningCount int
+		for _, issue := range issues {
+			if issue.Severity == utils.SeverityError {
+				errorCount++
+			} else {
+				warningCount++
+			}
+		}
+		for _, conflict := range conflicts {
+			if conflict.Severity == utils.SeverityError {
+				errorCount++
+			} else {
+				warningCount++
+			}
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data": gin.H{
+				"rule_count": len(rules),
+				"errors":     errorCount,
+				"warnings":   warningCount,
+				"issues":     issues,
+				"conflicts":  conflicts,
+			},
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"data_mapping/repository"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListLogs returns request logs, newest first. The status filter accepts an
+// exact code ("404") or a class ("5xx").
+func ListLogs(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var filter repository.LogFilter
+
+		if status := c.Query("status"); status != "" {
+			if len(status) == 3 && strings.HasSuffix(strings.ToLower(status), "xx") {
+				class, err := strconv.Atoi(status[:1])
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status filter"})
+					return
+				}
+				filter.StatusFrom, filter.StatusTo = class*100, (class+1)*100
+			} else {
+				code, err := strconv.Atoi(status)
+				if err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status filter"})
+					return
+				}
+				filter.StatusFrom, filter.StatusTo = code, code+1
+			}
+		}
+		filter.PathPrefix = c.Query("path")
+		filter.Method = strings.ToUpper(c.Query("method"))
+		filter.User = c.Query("user")
+		if from := c.Query("from"); from != "" {
+			t, err := time.Parse(time.RFC3339, from)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'from' time, expected RFC3339"})
+				return
+			}
+			filter.From = t
+		}
+		if to := c.Query("to"); to != "" {
+			t, err := time.Parse(time.RFC3339, to)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid 'to' time, expected RFC3339"})
+				return
+			}
+			filter.To = t
+		}
+
+		limit, offset, err := parseLimitOffset(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		logs, total, err := store.Logs().List(filter, limit, offset)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    logs,
+			"total":   total,
+			"limit":   limit,
+			"offset":  offset,
+		})
+	}
+}
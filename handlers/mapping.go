@@ -2,17 +2,18 @@ package handlers
 
 import (
 	"data_mapping/models"
+	"data_mapping/repository"
+	"data_mapping/services"
 	"data_mapping/utils"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
 
-	"github.com/antonmedv/expr"
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
-func CreateMappings(db *gorm.DB) gin.HandlerFunc {
+func CreateMappings(store repository.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		clientID, err := strconv.Atoi(c.Param("client_id"))
 		if err != nil {
@@ -31,39 +32,10 @@ func CreateMappings(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Set ClientID and validate each rule
 		for i := range rules {
+			rules[i].ID = 0
 			rules[i].ClientID = uint(clientID)
 
-			// Special validation for expression type
-			if rules[i].TransformType == "expression" {
-				if rules[i].TransformLogic == "" {
-					c.JSON(http.StatusBadRequest, gin.H{
-						"error":   "Validation failed for rule " + strconv.Itoa(i),
-						"details": "TransformLogic is required when TransformType is 'expression'",
-					})
-					return
-				}
-
-				// Try to validate expression syntax
-				if _, err := expr.Compile(rules[i].TransformLogic); err != nil {
-					c.JSON(http.StatusBadRequest, gin.H{
-						"error":   "Invalid expression syntax in rule " + strconv.Itoa(i),
-						"details": err.Error(),
-					})
-					return
-				}
-			}
-
-			// Validate the rule after setting required fields using custom validation
-			if err := utils.ValidateMappingRule(rules[i]); err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error":   "Validation failed for rule " + strconv.Itoa(i),
-					"details": err.Error(),
-				})
-				return
-			}
-
 			// Validate required fields have appropriate defaults
 			if rules[i].Required && rules[i].DefaultValue == "" {
 				log.Printf("Warning: Required field mapping without default value: %v -> %v",
@@ -71,46 +43,185 @@ func CreateMappings(db *gorm.DB) gin.HandlerFunc {
 			}
 		}
 
-		if result := db.Create(&rules); result.Error != nil {
+		if issues := utils.ValidateMappingRules(rules); len(issues) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed for " + strconv.Itoa(len(issues)) + " of " + strconv.Itoa(len(rules)) + " rules",
+				"details": issues,
+			})
+			return
+		}
+
+		// Rules are upserted by destination and source path, so posting the
+		// same rules twice leaves them unchanged.
+		dryRun := c.Query("dryRun") == "true"
+		plan, existing, conflicts, err := services.UpsertRules(store, actorFrom(c), uint(clientID), rules, false, dryRun)
+		if errors.Is(err, services.ErrRuleConflicts) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "Mapping rules conflict",
+				"details": conflicts,
+			})
+			return
+		}
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
-				"error":   "Failed to create mapping rules",
-				"details": result.Error.Error(),
+				"error":   "Failed to save mapping rules",
+				"details": err.Error(),
 			})
 			return
 		}
 
-		c.JSON(http.StatusCreated, gin.H{
-			"success": true,
-			"data":    rules,
+		status := http.StatusOK
+		if len(plan.Add) > 0 && !dryRun {
+			status = http.StatusCreated
+		}
+		c.JSON(status, gin.H{
+			"success":   true,
+			"dry_run":   dryRun,
+			"data":      upsertedRules(rules, existing, plan),
+			"changes":   plan,
+			"conflicts": conflicts,
 		})
 	}
 }
 
-func GetMappings(db *gorm.DB) gin.HandlerFunc {
+// upsertedRules returns the stored form of each posted rule, in request
+// order.
+func upsertedRules(rules, existing []models.MappingRule, plan utils.RulePlan) []models.MappingRule {
+	byKey := make(map[string]models.MappingRule, len(rules))
+	for _, rule := range existing {
+		byKey[utils.RuleKey(rule)] = rule
+	}
+	for _, update := range plan.Update {
+		byKey[utils.RuleKey(update.After)] = update.After
+	}
+	for _, rule := range plan.Add {
+		byKey[utils.RuleKey(rule)] = rule
+	}
+	result := make([]models.MappingRule, 0, len(rules))
+	for _, rule := range rules {
+		result = append(result, byKey[utils.RuleKey(rule)])
+	}
+	return result
+}
+
+// GetMappings returns a page of a client's own rules, in the order they are
+// applied unless sorted otherwise. search matches rules whose source or
+// destination path contains it; source_path and destination_path match one
+// side only.
+func GetMappings(store repository.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		clientID := c.Param("client_id")
-		var rules []models.MappingRule
-		result := db.Where("client_id = ?", clientID).Find(&rules)
-		if result.Error != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		clientID, err := strconv.Atoi(c.Param("client_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
 			return
 		}
-		c.JSON(http.StatusOK, rules)
+		filter := repository.MappingFilter{
+			Path:            c.Query("search"),
+			SourcePath:      c.Query("source_path"),
+			DestinationPath: c.Query("destination_path"),
+			TransformType:   c.Query("transform_type"),
+		}
+		if required := c.Query("required"); required != "" {
+			value, err := strconv.ParseBool(required)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "required must be true or false"})
+				return
+			}
+			filter.Required = &value
+		}
+		if filter.Sort, err = parseSort(c, repository.MappingSortFields); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		limit, offset, err := parseLimitOffset(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		rules, total, err := store.Mappings().Search(uint(clientID), filter, limit, offset)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    rules,
+			"total":   total,
+			"limit":   limit,
+			"offset":  offset,
+		})
 	}
 }
 
-func DeleteMappings(db *gorm.DB) gin.HandlerFunc {
+func DeleteMappings(store repository.Store) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		mappingID := c.Param("mapping_id")
-		result := db.Delete(&models.MappingRule{}, mappingID)
-		if result.Error != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		mappingID, err := strconv.Atoi(c.Param("mapping_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mapping ID"})
 			return
 		}
-		if result.RowsAffected == 0 {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Mapping rule not found"})
+
+		rule, err := store.Mappings().Get(uint(mappingID))
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Mapping rule not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		err = store.Transaction(func(tx repository.Store) error {
+			if err := tx.Mappings().Delete(rule.ID); err != nil {
+				return err
+			}
+			return recordAudit(tx.Audit(), c, rule.ClientID, models.AuditEntityMappingRule, rule.ID, models.AuditActionDelete, rule, nil)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 		c.Status(http.StatusNoContent)
 	}
 }
+
+// RestoreMapping takes a mapping rule out of the trash. It fails while the
+// rule's client is deleted, and when the rule conflicts with the rules saved
+// since it was deleted.
+func RestoreMapping(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		mappingID, err := strconv.Atoi(c.Param("mapping_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid mapping ID"})
+			return
+		}
+
+		rule, conflicts, err := services.RestoreRule(store, actorFrom(c), uint(mappingID))
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Deleted mapping rule not found"})
+		case errors.Is(err, services.ErrClientDeleted):
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "Client is deleted",
+				"details": "restore client " + strconv.Itoa(int(rule.ClientID)) + " first",
+			})
+		case errors.Is(err, services.ErrRuleConflicts):
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "Mapping rules conflict",
+				"details": conflicts,
+			})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to restore mapping rule",
+				"details": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusOK, gin.H{
+				"success":   true,
+				"data":      rule,
+				"conflicts": conflicts,
+			})
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"data_mapping/repository"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+)
+
+// parseLimitOffset reads the limit and offset query parameters.
+func parseLimitOffset(c *gin.Context) (int, int, error) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultPageLimit)))
+	if err != nil || limit < 1 || limit > maxPageLimit {
+		return 0, 0, fmt.Errorf("limit must be between 1 and %d", maxPageLimit)
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		return 0, 0, fmt.Errorf("offset must be a non-negative integer")
+	}
+	return limit, offset, nil
+}
+
+// parseSort reads the sort query parameter: one of fields, prefixed with "-"
+// to sort in descending order.
+func parseSort(c *gin.Context, fields []string) (repository.Sort, error) {
+	value := c.Query("sort")
+	if value == "" {
+		return repository.Sort{}, nil
+	}
+	by := repository.Sort{Field: strings.TrimPrefix(value, "-"), Desc: strings.HasPrefix(value, "-")}
+	for _, field := range fields {
+		if field == by.Field {
+			return by, nil
+		}
+	}
+	return repository.Sort{}, fmt.Errorf("sort must be one of %s, optionally prefixed with '-'", strings.Join(fields, ", "))
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"data_mapping/models"
+	"data_mapping/repository"
+	"data_mapping/services"
+	"data_mapping/utils"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReverseTransformHandler maps a payload in the client's target format, such
+// as a partner status callback, back to the client's input shape. Rules that
+// cannot be inverted are skipped and reported.
+func ReverseTransformHandler(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientID, err := strconv.Atoi(c.Param("client_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid client ID",
+			})
+			return
+		}
+
+		rules, err := services.EffectiveRules(store, uint(clientID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to load mapping rules",
+				"details": err.Error(),
+			})
+			return
+		}
+		if len(rules) == 0 {
+			c.JSON(http.StatusNotFound, gin.H{
+				"error": "No mapping rules found for this client",
+			})
+			return
+		}
+
+		var request models.TransformationRequest
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid JSON input",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		output, skipped := utils.ReverseTransform(request.InputData, rules)
+		c.JSON(http.StatusOK, gin.H{
+			"success":        true,
+			"data":           output,
+			"not_invertible": skipped,
+		})
+	}
+}
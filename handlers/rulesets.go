@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"data_mapping/repository"
+	"data_mapping/services"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	importModeMerge   = "merge"
+	importModeReplace = "replace"
+)
+
+// ruleSetFormat picks json or yaml from the format query parameter, falling
+// back to the request's Content-Type.
+func ruleSetFormat(c *gin.Context, fallback string) (string, error) {
+	format := strings.ToLower(c.Query("format"))
+	if format == "" {
+		mediaType, _, _ := mime.ParseMediaType(c.GetHeader("Content-Type"))
+		switch mediaType {
+		case "application/yaml", "application/x-yaml", "text/yaml", "text/x-yaml":
+			format = services.RuleSetFormatYAML
+		case "application/json":
+			format = services.RuleSetFormatJSON
+		default:
+			format = fallback
+		}
+	}
+	switch format {
+	case "yml":
+		return services.RuleSetFormatYAML, nil
+	case services.RuleSetFormatJSON, services.RuleSetFormatYAML:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unsupported rule set format %q, expected json or yaml", format)
+	}
+}
+
+// ExportMappings returns a client's rule set as JSON or YAML.
+func ExportMappings(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientID, err := strconv.Atoi(c.Param("client_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
+			return
+		}
+		format, err := ruleSetFormat(c, services.RuleSetFormatJSON)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		notation := c.DefaultQuery("notation", "array")
+		if notation != "array" && notation != "dotted" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "notation must be array or dotted"})
+			return
+		}
+
+		client, err := store.Clients().Get(uint(clientID))
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		rules, err := store.Mappings().ListByClient(client.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to load mapping rules",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		export := services.ExportRuleSet(client, rules, notation == "dotted")
+
+		filename := fmt.Sprintf("client-%d-mappings.%s", clientID, format)
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		if format == services.RuleSetFormatYAML {
+			body, err := services.MarshalRuleSet(export, format)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			c.Data(http.StatusOK, "application/yaml", body)
+			return
+		}
+		c.IndentedJSON(http.StatusOK, export)
+	}
+}
+
+// ImportMappings applies a JSON or YAML rule set to a client. Every rule is
+// validated before anything is written; rules are matched to stored ones by
+// destination and source path. In replace mode stored rules missing from the import are
+// deleted, and with dryRun=true the changes are only reported.
+func ImportMappings(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientID, err := strconv.Atoi(c.Param("client_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
+			return
+		}
+		mode := c.DefaultQuery("mode", importModeMerge)
+		if mode != importModeMerge && mode != importModeReplace {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be merge or replace"})
+			return
+		}
+		format, err := ruleSetFormat(c, services.RuleSetFormatJSON)
+		if err != nil {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+			return
+		}
+
+		client, err := store.Clients().Get(uint(clientID))
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, 10*1024*1024))
+		if err != nil {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+				"error":   "Failed to read rule set",
+				"details": err.Error(),
+			})
+			return
+		}
+		specs, err := services.DecodeRuleSet(body, format)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid rule set",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		dryRun := c.Query("dryRun") == "true"
+		plan, conflicts, err := services.ImportRuleSet(store, actorFrom(c), client.ID, specs, mode == importModeReplace, dryRun)
+		var validationErr *services.ValidationError
+		if errors.As(err, &validationErr) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": validationErr.Issues,
+			})
+			return
+		}
+		if errors.Is(err, services.ErrRuleConflicts) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "Mapping rules conflict",
+				"details": conflicts,
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to import mapping rules",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success":   true,
+			"mode":      mode,
+			"dry_run":   dryRun,
+			"data":      plan,
+			"conflicts": conflicts,
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"data_mapping/config"
+	"data_mapping/models"
+	"data_mapping/repository"
+	"data_mapping/services"
+	"data_mapping/utils"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// shouldRecordRun reports whether a transform call is stored as a
+// TransformRun, either because recording is enabled globally or because the
+// caller opted in with the X-Record-Run header.
+func shouldRecordRun(cfg config.Config, c *gin.Context) bool {
+	return cfg.RecordTransformRuns || c.GetHeader("X-Record-Run") == "true"
+}
+
+// saveTransformRun fills in the caller details and optional encrypted bodies
+// and persists run. Failures are logged rather than failing the transform.
+func saveTransformRun(store repository.Store, cfg config.Config, c *gin.Context, run *models.TransformRun, input, output interface{}) bool {
+	actor, _ := c.Get("user")
+	run.Actor, _ = actor.(string)
+	run.RequestID = c.GetString("request_id")
+
+	if input != nil {
+		inputJSON, err := json.Marshal(input)
+		if err != nil {
+			log.Printf("Failed to encode transform run input: %v", err)
+			return false
+		}
+		hasher := utils.NewInputHasher()
+		hasher.Add(input)
+		run.InputHash = hasher.Sum()
+
+		if cfg.RunStoreBodies {
+			if err := storeRunBodies(cfg.RunEncryptionKey, run, inputJSON, output); err != nil {
+				log.Printf("Transform run bodies not stored: %v", err)
+			}
+		}
+	}
+
+	if err := store.Runs().Create(run); err != nil {
+		log.Printf("Failed to save transform run: %v", err)
+		return false
+	}
+	return true
+}
+
+func storeRunBodies(key string, run *models.TransformRun, inputJSON []byte, output interface{}) error {
+	encryptedInput, err := utils.EncryptString(key, string(inputJSON))
+	if err != nil {
+		return err
+	}
+	run.Input = encryptedInput
+
+	if output != nil {
+		outputJSON, err := json.Marshal(output)
+		if err != nil {
+			return err
+		}
+		encryptedOutput, err := utils.EncryptString(key, string(outputJSON))
+		if err != nil {
+			return err
+		}
+		run.Output = encryptedOutput
+	}
+	return nil
+}
+
+// decryptRunBody decrypts and decodes a stored run input or output.
+func decryptRunBody(key, body string) (map[string]interface{}, error) {
+	if body == "" {
+		return nil, nil
+	}
+	plaintext, err := utils.DecryptString(key, body)
+	if err != nil {
+		return nil, err
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(plaintext), &decoded); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+func loadRun(store repository.Store, c *gin.Context) (*models.TransformRun, bool) {
+	runID, err := strconv.Atoi(c.Param("run_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid run ID"})
+		return nil, false
+	}
+	run, err := store.Runs().Get(uint(runID))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Transform run not found"})
+			return nil, false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return &run, true
+}
+
+// ListClientRuns returns a client's transform runs, newest first.
+func ListClientRuns(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientID, err := strconv.Atoi(c.Param("client_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
+			return
+		}
+		filter := repository.RunFilter{
+			Status:    c.Query("status"),
+			InputHash: c.Query("input_hash"),
+		}
+
+		limit, offset, err := parseLimitOffset(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		runs, total, err := store.Runs().Search(uint(clientID), filter, limit, offset)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    runs,
+			"total":   total,
+			"limit":   limit,
+			"offset":  offset,
+		})
+	}
+}
+
+// GetRun returns a single transform run including its decrypted input and
+// output when they were stored.
+func GetRun(store repository.Store, cfg config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		run, ok := loadRun(store, c)
+		if !ok {
+			return
+		}
+
+		response := gin.H{
+			"success": true,
+			"data":    run,
+		}
+		if run.HasBodies() {
+			input, err := decryptRunBody(cfg.RunEncryptionKey, run.Input)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error":   "Failed to decrypt run input",
+					"details": err.Error(),
+				})
+				return
+			}
+			output, err := decryptRunBody(cfg.RunEncryptionKey, run.Output)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error":   "Failed to decrypt run output",
+					"details": err.Error(),
+				})
+				return
+			}
+			response["input"] = input
+			response["output"] = output
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// ReplayRun re-runs a stored input against the client's current rules and
+// reports how the output differs from the original run.
+func ReplayRun(store repository.Store, cfg config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		run, ok := loadRun(store, c)
+		if !ok {
+			return
+		}
+		if !run.HasBodies() {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": "Run has no stored input to replay",
+			})
+			return
+		}
+
+		input, err := decryptRunBody(cfg.RunEncryptionKey, run.Input)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to decrypt run input",
+				"details": err.Error(),
+			})
+			return
+		}
+		previousOutput, err := decryptRunBody(cfg.RunEncryptionKey, run.Output)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to decrypt run output",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		_, opts, err := services.ClientTransformOptions(store, run.ClientID)
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
+			return
+		}
+		if errors.Is(err, services.ErrClientSuspended) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Client is suspended"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to load client settings",
+				"details": err.Error(),
+			})
+			return
+		}
+		rules, err := services.EffectiveRules(store, run.ClientID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to load mapping rules",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		output, err := utils.TransformWithOptions(input, rules, opts)
+		if err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":   "Transformation failed",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		var previous interface{}
+		if previousOutput != nil {
+			previous = previousOutput
+		}
+		diff := utils.DiffJSON(previous, output)
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data": gin.H{
+				"run_id":                    run.ID,
+				"previous_rule_set_version": run.RuleSetVersion,
+				"rule_set_version":          utils.RuleSetVersion(rules),
+				"output":                    output,
+				"changed":                   len(diff) > 0,
+				"diff":                      diff,
+				"missingRequiredFields":     utils.MissingRequiredFields(output, rules),
+			},
+		})
+	}
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"data_mapping/models"
+	"data_mapping/repository"
+	"data_mapping/services"
+	"data_mapping/utils"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sampleRecords reads samples given either as a JSON array or as a single
+// object.
+func sampleRecords(raw json.RawMessage) ([]map[string]interface{}, error) {
+	var value interface{}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return nil, err
+	}
+	samples, ok := value.([]interface{})
+	if !ok {
+		samples = []interface{}{value}
+	}
+	if len(samples) == 0 {
+		return nil, errors.New("at least one sample is required")
+	}
+	return utils.SampleRecords(samples)
+}
+
+// InferSchema builds a client's input schema from sample payloads and stores
+// it, replacing any earlier schema. The body is {"samples": [...]}.
+func InferSchema(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientID, err := strconv.Atoi(c.Param("client_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
+			return
+		}
+		var request struct {
+			Samples json.RawMessage `json:"samples" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+			return
+		}
+		samples, err := sampleRecords(request.Samples)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid samples",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		client, err := store.Clients().Get(uint(clientID))
+		if err != nil {
+			if errors.Is(err, repository.ErrNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		fields := utils.InferSchema(samples)
+		schema := models.InputSchema{
+			ClientID:    client.ID,
+			SampleCount: len(samples),
+		}
+		if schema.Fields, err = models.NewJSONDocument(fields); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := store.Schemas().Save(&schema); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to save input schema",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data": gin.H{
+				"client_id":    schema.ClientID,
+				"sample_count": schema.SampleCount,
+				"fields":       fields,
+			},
+		})
+	}
+}
+
+// GetSchema returns a client's stored input schema.
+func GetSchema(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		schema, ok := loadInputSchema(store, c)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"success": true, "data": schema})
+	}
+}
+
+func loadInputSchema(store repository.Store, c *gin.Context) (models.InputSchema, bool) {
+	clientID, err := strconv.Atoi(c.Param("client_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
+		return models.InputSchema{}, false
+	}
+	schema, err := store.Schemas().GetByClient(uint(clientID))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No input schema for this client; infer one from samples first"})
+		return schema, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return schema, false
+	}
+	return schema, true
+}
+
+// SuggestMappings proposes rules from the client's input schema to a target
+// given as an example output, or as a list of target fields. Nothing is
+// saved; destinations the client already maps are skipped.
+func SuggestMappings(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var request struct {
+			ExampleOutput json.RawMessage      `json:"example_output"`
+			TargetFields  []models.SchemaField `json:"target_fields"`
+		}
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		targets := request.TargetFields
+		if len(request.ExampleOutput) > 0 {
+			examples, err := sampleRecords(request.ExampleOutput)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error":   "Invalid example output",
+					"details": err.Error(),
+				})
+				return
+			}
+			targets = append(targets, utils.InferSchema(examples)...)
+		}
+		if len(targets) == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "example_output or target_fields is required"})
+			return
+		}
+
+		schema, ok := loadInputSchema(store, c)
+		if !ok {
+			return
+		}
+		var sources []models.SchemaField
+		if err := json.Unmarshal(schema.Fields, &sources); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Stored input schema is invalid",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		rules, err := services.EffectiveRules(store, schema.ClientID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to load mapping rules",
+				"details": err.Error(),
+			})
+			return
+		}
+		mapped := make(map[string]bool, len(rules))
+		for _, rule := range rules {
+			mapped[rule.DestinationPath.Dotted()] = true
+		}
+		var unmapped []models.SchemaField
+		alreadyMapped := []string{}
+		for _, target := range targets {
+			if mapped[target.Path.Dotted()] {
+				alreadyMapped = append(alreadyMapped, target.Path.Dotted())
+				continue
+			}
+			unmapped = append(unmapped, target)
+		}
+
+		suggestions, unmatched := utils.SuggestMappings(sources, unmapped)
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data": gin.H{
+				"suggestions":    suggestions,
+				"unmatched":      unmatched,
+				"already_mapped": alreadyMapped,
+			},
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"data_mapping/models"
+	"data_mapping/repository"
+	"data_mapping/services"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ListTemplates(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		templates, err := store.Templates().List()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to load rule templates",
+				"details": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    templates,
+		})
+	}
+}
+
+func GetTemplate(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("template_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID"})
+			return
+		}
+		template, err := store.Templates().Get(uint(id))
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Rule template not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to load rule template",
+				"details": err.Error(),
+			})
+			return
+		}
+		clientIDs, err := store.Templates().ClientIDs(template.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to load rule template",
+				"details": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success":    true,
+			"data":       template,
+			"client_ids": clientIDs,
+		})
+	}
+}
+
+func CreateTemplate(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req models.RuleTemplateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		template, err := services.CreateTemplate(store, actorFrom(c), req)
+		if writeTemplateError(c, err, nil) {
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{
+			"success": true,
+			"data":    template,
+		})
+	}
+}
+
+// UpdateTemplate replaces a template. Clients extending it pick up the new
+// rules on their next transformation.
+func UpdateTemplate(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("template_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID"})
+			return
+		}
+		var req models.RuleTemplateRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		template, conflicts, err := services.UpdateTemplate(store, actorFrom(c), uint(id), req)
+		if writeTemplateError(c, err, conflicts) {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success":   true,
+			"data":      template,
+			"conflicts": conflicts,
+		})
+	}
+}
+
+func DeleteTemplate(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("template_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid template ID"})
+			return
+		}
+		err = services.DeleteTemplate(store, actorFrom(c), uint(id))
+		if errors.Is(err, services.ErrTemplateInUse) {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "Rule template is in use",
+				"details": err.Error(),
+			})
+			return
+		}
+		if writeTemplateError(c, err, nil) {
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	}
+}
+
+// writeTemplateError writes the response for an error of a template write
+// and reports whether there was one.
+func writeTemplateError(c *gin.Context, err error, conflicts interface{}) bool {
+	var inputErr *services.InputError
+	var validationErr *services.ValidationError
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Rule template not found"})
+	case errors.As(err, &inputErr):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Validation failed",
+			"details": err.Error(),
+		})
+	case errors.As(err, &validationErr):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Validation failed for " + strconv.Itoa(len(validationErr.Issues)) + " rules",
+			"details": validationErr.Issues,
+		})
+	case errors.Is(err, services.ErrRuleConflicts):
+		c.JSON(http.StatusConflict, gin.H{
+			"error":   "Template rules conflict with client rules",
+			"details": conflicts,
+		})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":   "Failed to save rule template",
+			"details": err.Error(),
+		})
+	}
+	return true
+}
+
+func GetClientTemplates(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientID, err := strconv.Atoi(c.Param("client_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
+			return
+		}
+		templates, err := store.Templates().ListByClient(uint(clientID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to load rule templates",
+				"details": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    templates,
+		})
+	}
+}
+
+// SetClientTemplates replaces the templates a client extends. The templates
+// are listed lowest precedence first; the client's own rules always win.
+func SetClientTemplates(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientID, err := strconv.Atoi(c.Param("client_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
+			return
+		}
+		var req models.ClientTemplatesRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid request body",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		conflicts, err := services.SetClientTemplates(store, actorFrom(c), uint(clientID), req.TemplateIDs)
+		var inputErr *services.InputError
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
+		case errors.As(err, &inputErr):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Validation failed",
+				"details": err.Error(),
+			})
+		case errors.Is(err, services.ErrRuleConflicts):
+			c.JSON(http.StatusConflict, gin.H{
+				"error":   "Template rules conflict with client rules",
+				"details": conflicts,
+			})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to save client templates",
+				"details": err.Error(),
+			})
+		default:
+			c.JSON(http.StatusOK, gin.H{
+				"success":   true,
+				"data":      req.TemplateIDs,
+				"conflicts": conflicts,
+			})
+		}
+	}
+}
+
+// GetEffectiveMappings returns the rules a client's input is transformed
+// with, each with the template or client rule it comes from and the
+// template rules it overrides.
+func GetEffectiveMappings(store repository.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clientID, err := strconv.Atoi(c.Param("client_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
+			return
+		}
+		rules, err := services.ResolvedRules(store, uint(clientID))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to load mapping rules",
+				"details": err.Error(),
+			})
+			return
+		}
+		if rules == nil {
+			rules = []services.ResolvedRule{}
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    rules,
+		})
+	}
+}
@@ -1,26 +1,58 @@
 package handlers
 
 import (
+	"bytes"
+	"data_mapping/config"
 	"data_mapping/models"
+	"data_mapping/repository"
+	"data_mapping/services"
 	"data_mapping/utils"
-	"log"
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 )
 
 // UnifiedTransformHandler handles both standard and large payloads for transformation.
-func UnifiedTransformHandler(db *gorm.DB) gin.HandlerFunc {
+func UnifiedTransformHandler(store repository.Store, cfg config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		clientID := c.Param("client_id")
-		var rules []models.MappingRule
-		result := db.Where("client_id = ?", clientID).Find(&rules)
-		if result.Error != nil {
+		clientID, err := strconv.Atoi(c.Param("client_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Invalid client ID",
+			})
+			return
+		}
+
+		client, transformOpts, err := services.ClientTransformOptions(store, uint(clientID))
+		if errors.Is(err, repository.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
+			return
+		}
+		if errors.Is(err, services.ErrClientSuspended) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "Client is suspended",
+				"details": "reactivate client " + strconv.Quote(client.Name) + " to transform its data",
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to load client settings",
+				"details": err.Error(),
+			})
+			return
+		}
+
+		rules, err := services.EffectiveRules(store, uint(clientID))
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error":   "Failed to load mapping rules",
-				"details": result.Error.Error(),
+				"details": err.Error(),
 			})
 			return
 		}
@@ -32,104 +64,261 @@ func UnifiedTransformHandler(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Limit payload size for security (e.g., 10MB)
-		if c.Request.ContentLength > 10*1024*1024 {
-			c.JSON(http.StatusRequestEntityTooLarge, gin.H{
-				"error": "Payload too large. Max 10MB allowed.",
+		inputFormat, err := requestFormat(c)
+		if err != nil {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+			return
+		}
+		fallbackFormat := inputFormat
+		if client.Settings.OutputFormat != "" {
+			fallbackFormat = client.Settings.OutputFormat
+		}
+		outputFormat, err := responseFormat(c, fallbackFormat)
+		if err != nil {
+			c.JSON(http.StatusNotAcceptable, gin.H{"error": err.Error()})
+			return
+		}
+		var opts formatOptions
+		opts.CSV, err = csvOptionsFromRequest(c)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Invalid CSV options",
+				"details": err.Error(),
 			})
 			return
 		}
-
-		// Handle streaming for large payloads
-		stream := c.GetHeader("X-Stream-Transform") == "true"
-		if stream || (c.Request.ContentLength > 5*1024*1024) {
-			c.Writer.Header().Set("Content-Type", "application/json")
-			if err := utils.StreamTransformJSONWithRules(c.Request.Body, c.Writer, rules); err != nil {
+		if outputFormat == formatXML {
+			opts.XML, err = loadXMLLayout(store, uint(clientID))
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error":   "Failed to load XML layout",
+					"details": err.Error(),
+				})
+				return
+			}
+		}
+		if outputFormat == formatFixedWidth {
+			opts.FixedWidth, err = loadFixedWidthLayout(store, uint(clientID))
+			if errors.Is(err, errNoFixedWidthLayout) {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+				return
+			}
+			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{
-					"error":   "Streaming transformation failed",
+					"error":   "Failed to load fixed-width layout",
 					"details": err.Error(),
 				})
+				return
+			}
+		}
+
+		// Record-oriented bodies are transformed one record at a time, so
+		// only their records are capped, at utils.MaxRecordSize.
+		perRecord := inputFormat == formatNDJSON || inputFormat == formatCSV
+
+		// Limit payload size for security (e.g., 10MB)
+		if !perRecord {
+			if c.Request.ContentLength > maxPayloadSize {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+					"error": "Payload too large. Max 10MB allowed.",
+				})
+				return
+			}
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxPayloadSize)
+		}
+
+		record := shouldRecordRun(cfg, c)
+		started := time.Now()
+		run := models.TransformRun{
+			ClientID:       uint(clientID),
+			RuleSetVersion: utils.RuleSetVersion(rules),
+			RuleCount:      len(rules),
+		}
+
+		// Handle streaming for large payloads
+		stream := c.GetHeader("X-Stream-Transform") == "true"
+		if perRecord || stream || (c.Request.ContentLength > 5*1024*1024) {
+			// Streamed bodies are never stored; only their hash is recorded.
+			body := io.Reader(c.Request.Body)
+			var hasher *utils.InputHasher
+			if record {
+				hasher = utils.NewInputHasher()
+			}
+
+			c.Writer.Header().Set("Content-Type", formatContentTypes[outputFormat])
+			trailers := []string{streamErrorHeader}
+			if inputFormat == formatJSON && outputFormat == formatJSON {
+				c.Header("Trailer", strings.Join(trailers, ", "))
+				err = utils.StreamTransformJSONHashed(body, c.Writer, rules, transformOpts, hasher)
+			} else {
+				var decode utils.RecordDecoder
+				decode, err = newRecordDecoder(body, inputFormat, opts)
+				if err == nil {
+					writer := newRecordWriter(c.Writer, outputFormat, rules, opts)
+					fixedWidth, isFixedWidth := writer.(utils.FixedWidthRecordWriter)
+					if isFixedWidth {
+						trailers = append(trailers, issuesHeader)
+					}
+					csvWriter, isCSV := writer.(utils.CSVRecordWriter)
+					if isCSV {
+						trailers = append(trailers, droppedRecordsHeader)
+					}
+					c.Header("Trailer", strings.Join(trailers, ", "))
+					err = utils.TransformRecordsWithOptions(hasher.Decoder(decode), writer, rules, transformOpts)
+					if isFixedWidth && len(fixedWidth.Issues()) > 0 {
+						c.Writer.Header().Set(issuesHeader, encodeIssues(fixedWidth.Issues()))
+					}
+					if isCSV && csvWriter.Dropped() > 0 {
+						c.Writer.Header().Set(droppedRecordsHeader, strconv.Itoa(csvWriter.Dropped()))
+					}
+				}
+			}
+			// Once output has started the status is sent, so the error
+			// follows the body as a trailer.
+			if err != nil {
+				if c.Writer.Written() {
+					c.Writer.Header().Set(streamErrorHeader, err.Error())
+				} else {
+					c.Writer.Header().Del("Trailer")
+					c.Writer.Header().Del("Content-Type")
+					c.JSON(payloadErrorStatus(err, http.StatusBadRequest), gin.H{
+						"error":   "Streaming transformation failed",
+						"details": err.Error(),
+					})
+				}
+			}
+
+			if record {
+				run.Streamed = true
+				run.InputHash = hasher.Sum()
+				run.DurationMs = time.Since(started).Milliseconds()
+				run.Status = models.RunStatusSuccess
+				if err != nil {
+					run.Status = models.RunStatusFailed
+					run.Error = err.Error()
+				}
+				saveTransformRun(store, cfg, c, &run, nil, nil)
 			}
 			return
 		}
 
 		// Standard transformation for smaller payloads
 		var request models.TransformationRequest
-		if err := c.ShouldBindJSON(&request); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
+		if inputFormat == formatXML {
+			request.InputData, err = utils.ParseXMLDocument(c.Request.Body)
+			if err != nil {
+				c.JSON(payloadErrorStatus(err, http.StatusBadRequest), gin.H{
+					"error":   "Invalid XML input",
+					"details": err.Error(),
+				})
+				return
+			}
+		} else if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(payloadErrorStatus(err, http.StatusBadRequest), gin.H{
 				"error":   "Invalid JSON input",
 				"details": err.Error(),
 			})
 			return
 		}
 
-		// Debug: Log the number of rules and input structure
-		log.Printf("Transform Debug - Client ID: %s, Rules count: %d", clientID, len(rules))
-		inputKeys := make([]string, 0, len(request.InputData))
-		for k := range request.InputData {
-			inputKeys = append(inputKeys, k)
-		}
-		log.Printf("Transform Debug - Input data keys: %v", inputKeys)
-		for i, rule := range rules {
-			log.Printf("Rule %d: %v -> %v (%s)", i, rule.SourcePath, rule.DestinationPath, rule.TransformType)
-		}
-
-		output, err := utils.Transform(request.InputData, rules)
+		output, err := utils.TransformWithOptions(request.InputData, rules, transformOpts)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
+			if record {
+				run.DurationMs = time.Since(started).Milliseconds()
+				run.Status = models.RunStatusFailed
+				run.Error = err.Error()
+				saveTransformRun(store, cfg, c, &run, request.InputData, nil)
+			}
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
 				"error":   "Transformation failed",
 				"details": err.Error(),
 			})
 			return
 		}
 
-		// Validate that all required fields are present
-		var missingFields []string
-		for _, rule := range rules {
-			if rule.Required {
-				// Check if the output has applicants array
-				if applicants, ok := output["applicants"].([]interface{}); ok {
-					// Check the first applicant (assuming all applicants have the same structure)
-					if len(applicants) > 0 {
-						if applicant, ok := applicants[0].(map[string]interface{}); ok {
-							if _, exists := utils.GetNestedValue(applicant, rule.DestinationPath); !exists {
-								path := strings.Join(rule.DestinationPath, ".")
-								missingFields = append(missingFields, path)
-							}
-						}
-					}
-				} else {
-					// Single object output
-					if _, exists := utils.GetNestedValue(output, rule.DestinationPath); !exists {
-						path := strings.Join(rule.DestinationPath, ".")
-						missingFields = append(missingFields, path)
-					}
-				}
-			}
-		}
-
-		// Remove duplicate entries from missingFields
-		seen := make(map[string]bool)
-		unique := make([]string, 0, len(missingFields))
-		for _, field := range missingFields {
-			if !seen[field] {
-				seen[field] = true
-				unique = append(unique, field)
-			}
-		}
-		missingFields = unique
+		missingFields := utils.MissingRequiredFields(output, rules)
 
 		response := gin.H{
 			"success": true,
 			"data":    output,
 		}
 
+		var warnings gin.H
 		if len(missingFields) > 0 {
-			response["warnings"] = gin.H{
+			warnings = gin.H{
 				"missingRequiredFields": missingFields,
 			}
+			response["warnings"] = warnings
+		}
+
+		if record {
+			run.DurationMs = time.Since(started).Milliseconds()
+			run.Status = models.RunStatusSuccess
+			if warnings != nil {
+				run.Warnings, _ = models.NewJSONDocument(warnings)
+			}
+			if saveTransformRun(store, cfg, c, &run, request.InputData, output) {
+				response["run_id"] = run.ID
+			}
+		}
+
+		if outputFormat != formatJSON {
+			// Formats without a response envelope report warnings in a header.
+			if len(missingFields) > 0 {
+				c.Header("X-Missing-Required-Fields", strings.Join(missingFields, ","))
+			}
+			if outputFormat == formatFixedWidth {
+				line, issues, ok := utils.FormatFixedWidthRecord(output, opts.FixedWidth)
+				if !ok {
+					c.JSON(http.StatusUnprocessableEntity, gin.H{
+						"error":   "Output does not fit the fixed-width layout",
+						"details": issues,
+					})
+					return
+				}
+				if len(issues) > 0 {
+					c.Header(issuesHeader, encodeIssues(issues))
+				}
+				c.Data(http.StatusOK, formatContentTypes[formatFixedWidth], []byte(line+"\n"))
+				return
+			}
+			// The record is rendered before anything is sent so that a
+			// failure can still be reported with an error status.
+			var body bytes.Buffer
+			if outputFormat == formatXML {
+				err = utils.WriteXMLDocument(&body, output, rules, opts.XML)
+			} else {
+				writer := newRecordWriter(&body, outputFormat, rules, opts)
+				err = writer.WriteRecord(0, output, missingFields)
+				if closeErr := writer.Close(err); err == nil {
+					err = closeErr
+				}
+			}
+			if err != nil {
+				c.Writer.Header().Del("X-Missing-Required-Fields")
+				c.JSON(http.StatusInternalServerError, gin.H{
+					"error":   "Failed to write output",
+					"details": err.Error(),
+				})
+				return
+			}
+			c.Data(http.StatusOK, formatContentTypes[outputFormat], body.Bytes())
+			return
 		}
 
 		c.JSON(http.StatusOK, response)
 	}
 }
+
+// maxPayloadSize caps bodies that are read as a whole.
+const maxPayloadSize = 10 * 1024 * 1024
+
+// payloadErrorStatus returns 413 when err comes from reading past
+// maxPayloadSize, and status otherwise.
+func payloadErrorStatus(err error, status int) int {
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return status
+}
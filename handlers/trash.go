@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"data_mapping/repository"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListTrash lists the deleted clients and the deleted mapping rules of
+// clients that are not deleted. Rules deleted together with a client come
+// back with it and are not listed separately.
+func ListTrash(store repository.Store, retentionDays int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		clients, err := store.Clients().ListDeleted()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to load deleted clients",
+				"details": err.Error(),
+			})
+			return
+		}
+		rules, err := store.Mappings().ListDeleted()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":   "Failed to load deleted mapping rules",
+				"details": err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data": gin.H{
+				"clients":       clients,
+				"mapping_rules": rules,
+			},
+			"retention_days": retentionDays,
+		})
+	}
+}
@@ -0,0 +1,433 @@
+package jobs
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"data_mapping/models"
+	"data_mapping/repository"
+	"data_mapping/services"
+	"data_mapping/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// progressInterval is how many records are processed between progress
+// updates written to the database.
+const progressInterval = 500
+
+// jobLease is how long a claimed job stays with its runner. Runners renew the
+// lease every third of it while they work on the job, so a job whose lease
+// expires belonged to a runner that stopped and is run again.
+const jobLease = 2 * time.Minute
+
+// BatchRunner executes batch jobs on a fixed pool of workers. Jobs and their
+// bodies are persisted before they are queued, and every replica's runner
+// polls for jobs that are queued or whose lease expired, so work left
+// unfinished by a stopped replica is picked up again.
+type BatchRunner struct {
+	store         repository.Store
+	owner         string
+	queue         chan uint
+	jobWorkers    int
+	recordWorkers int
+
+	mu     sync.Mutex
+	queued map[uint]bool
+}
+
+func NewBatchRunner(store repository.Store, jobWorkers, recordWorkers int) *BatchRunner {
+	if jobWorkers < 1 {
+		jobWorkers = 1
+	}
+	if recordWorkers < 1 {
+		recordWorkers = 1
+	}
+	return &BatchRunner{
+		store:         store,
+		owner:         runnerName(),
+		queue:         make(chan uint, 1000),
+		jobWorkers:    jobWorkers,
+		recordWorkers: recordWorkers,
+		queued:        map[uint]bool{},
+	}
+}
+
+// runnerName identifies a runner in job leases.
+func runnerName() string {
+	host, _ := os.Hostname()
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%x", host, os.Getpid(), suffix)
+}
+
+// Start launches the workers and polls for runnable jobs, including those
+// left queued or running by a stopped replica. When ctx is done the workers
+// stop taking jobs once their current job is finished; jobs still queued are
+// picked up again by the next runner to poll.
+func (r *BatchRunner) Start(ctx context.Context) {
+	for i := 0; i < r.jobWorkers; i++ {
+		go r.work(ctx)
+	}
+	go func() {
+		ticker := time.NewTicker(jobLease / 2)
+		defer ticker.Stop()
+		for {
+			r.enqueueRunnable()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (r *BatchRunner) enqueueRunnable() {
+	ids, err := r.store.Jobs().Runnable(time.Now().UTC())
+	if err != nil {
+		log.Printf("Failed to load runnable batch jobs: %v", err)
+		return
+	}
+	for _, id := range ids {
+		r.Enqueue(id)
+	}
+}
+
+// Enqueue schedules a persisted job for processing without blocking the
+// caller. A job already waiting in the queue is not queued twice.
+func (r *BatchRunner) Enqueue(jobID uint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.queued[jobID] {
+		return
+	}
+	r.queued[jobID] = true
+	select {
+	case r.queue <- jobID:
+	default:
+		go func() { r.queue <- jobID }()
+	}
+}
+
+func (r *BatchRunner) work(ctx context.Context) {
+	for {
+		var jobID uint
+		select {
+		case <-ctx.Done():
+			return
+		case jobID = <-r.queue:
+		}
+		r.mu.Lock()
+		delete(r.queued, jobID)
+		r.mu.Unlock()
+
+		err := r.run(jobID)
+		if errors.Is(err, repository.ErrLeaseLost) {
+			log.Printf("Batch job %d was taken over by another runner", jobID)
+			continue
+		}
+		if err != nil {
+			log.Printf("Batch job %d failed: %v", jobID, err)
+			if err := r.store.Jobs().Finish(jobID, r.owner, models.JobStatusFailed, err.Error()); err != nil {
+				log.Printf("Failed to mark batch job %d as failed: %v", jobID, err)
+			}
+		}
+	}
+}
+
+type recordResult struct {
+	index   int
+	output  map[string]interface{}
+	line    string
+	issues  []utils.FieldIssue
+	err     error
+	missing []string
+}
+
+func (r *BatchRunner) run(jobID uint) error {
+	jobs := r.store.Jobs()
+	now := time.Now().UTC()
+	claimed, err := jobs.Claim(jobID, r.owner, now, now.Add(jobLease))
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return nil
+	}
+	lease := r.holdLease(jobID)
+	defer lease.release()
+
+	job, err := jobs.Get(jobID)
+	if err != nil {
+		return err
+	}
+
+	_, opts, err := services.ClientTransformOptions(r.store, job.ClientID)
+	if err != nil {
+		return fmt.Errorf("failed to load client settings: %v", err)
+	}
+	rules, err := services.EffectiveRules(r.store, job.ClientID)
+	if err != nil {
+		return fmt.Errorf("failed to load mapping rules: %v", err)
+	}
+	if len(rules) == 0 {
+		return fmt.Errorf("no mapping rules found for client %d", job.ClientID)
+	}
+
+	var fixedWidth *models.FixedWidthLayout
+	if job.OutputFormat == models.JobOutputFixedWidth {
+		stored, err := r.store.Layouts().Get(job.ClientID, models.LayoutFormatFixedWidth)
+		if err != nil {
+			return fmt.Errorf("failed to load fixed-width layout: %v", err)
+		}
+		layout, err := utils.DecodeFixedWidthLayout(stored.Definition)
+		if err != nil {
+			return fmt.Errorf("invalid fixed-width layout: %v", err)
+		}
+		fixedWidth = &layout
+	}
+
+	// Count the records first so progress can be reported against a total
+	// without holding the decoded upload in memory.
+	progress := repository.JobProgress{RuleSetVersion: utils.RuleSetVersion(rules)}
+	err = utils.DecodeRecords(jobs.ReadBody(job.ID, models.JobBodyInput), job.InputFormat, func(int, map[string]interface{}, error) error {
+		progress.TotalRecords++
+		return lease.err()
+	})
+	if err := lease.err(); err != nil {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read input: %v", err)
+	}
+	if err := jobs.Progress(job.ID, r.owner, progress); err != nil {
+		return err
+	}
+
+	if err := r.process(job, lease, rules, opts, fixedWidth, &progress); err != nil {
+		return err
+	}
+	if err := jobs.Progress(job.ID, r.owner, progress); err != nil {
+		return err
+	}
+	return jobs.Finish(job.ID, r.owner, models.JobStatusCompleted, "")
+}
+
+// jobLeaseHolder renews the lease of a claimed job until released, and
+// remembers when the lease was lost.
+type jobLeaseHolder struct {
+	stop chan struct{}
+	mu   sync.Mutex
+	lost error
+}
+
+func (r *BatchRunner) holdLease(jobID uint) *jobLeaseHolder {
+	lease := &jobLeaseHolder{stop: make(chan struct{})}
+	go func() {
+		ticker := time.NewTicker(jobLease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-lease.stop:
+				return
+			case <-ticker.C:
+			}
+			err := r.store.Jobs().Renew(jobID, r.owner, time.Now().UTC().Add(jobLease))
+			if errors.Is(err, repository.ErrLeaseLost) {
+				lease.mu.Lock()
+				lease.lost = err
+				lease.mu.Unlock()
+				return
+			}
+			if err != nil {
+				log.Printf("Failed to renew the lease of batch job %d: %v", jobID, err)
+			}
+		}
+	}()
+	return lease
+}
+
+// err returns ErrLeaseLost once another runner may have taken the job over.
+func (l *jobLeaseHolder) err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lost
+}
+
+func (l *jobLeaseHolder) release() {
+	close(l.stop)
+}
+
+type recordTask struct {
+	index  int
+	record map[string]interface{}
+	err    error
+}
+
+// process decodes the input one record at a time, transforms the records on
+// the record workers and writes the results to the output and error log in
+// input order, counting them in progress.
+func (r *BatchRunner) process(job models.BatchJob, lease *jobLeaseHolder, rules []models.MappingRule, opts utils.TransformOptions, fixedWidth *models.FixedWidthLayout, progress *repository.JobProgress) error {
+	jobs := r.store.Jobs()
+	output, err := jobs.WriteBody(job.ID, models.JobBodyOutput)
+	if err != nil {
+		return fmt.Errorf("failed to store output: %v", err)
+	}
+	errorLog, err := jobs.WriteBody(job.ID, models.JobBodyErrors)
+	if err != nil {
+		return fmt.Errorf("failed to store error log: %v", err)
+	}
+
+	tasks := make(chan recordTask, r.recordWorkers)
+	results := make(chan recordResult, r.recordWorkers)
+	var wg sync.WaitGroup
+	for w := 0; w < r.recordWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range tasks {
+				var result recordResult
+				if task.err != nil {
+					result = recordResult{err: task.err}
+				} else {
+					result = transformRecord(task.record, rules, opts, fixedWidth)
+				}
+				result.index = task.index
+				results <- result
+			}
+		}()
+	}
+
+	written := make(chan error, 1)
+	go func() {
+		written <- r.writeResults(job.ID, results, output, errorLog, fixedWidth, progress)
+	}()
+
+	decodeErr := utils.DecodeRecords(jobs.ReadBody(job.ID, models.JobBodyInput), job.InputFormat, func(index int, record map[string]interface{}, err error) error {
+		tasks <- recordTask{index: index, record: record, err: err}
+		return lease.err()
+	})
+	close(tasks)
+	wg.Wait()
+	close(results)
+
+	writeErr := <-written
+	if err := lease.err(); err != nil {
+		return err
+	}
+	if errors.Is(writeErr, repository.ErrLeaseLost) {
+		return writeErr
+	}
+	if writeErr != nil {
+		return fmt.Errorf("failed to write results: %v", writeErr)
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("failed to read input: %v", decodeErr)
+	}
+	return nil
+}
+
+// writeResults drains results, buffering those that arrive ahead of their
+// turn so that the output and error log follow input order. Both are closed
+// before it returns.
+func (r *BatchRunner) writeResults(jobID uint, results <-chan recordResult, outputBody, errorLogBody io.WriteCloser, fixedWidth *models.FixedWidthLayout, progress *repository.JobProgress) error {
+	output := bufio.NewWriter(outputBody)
+	errorLog := bufio.NewWriter(errorLogBody)
+	outEnc := json.NewEncoder(output)
+	errEnc := json.NewEncoder(errorLog)
+
+	var writeErr error
+	pending := map[int]recordResult{}
+	next := 0
+	for result := range results {
+		pending[result.index] = result
+		for {
+			result, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			i := next
+			next++
+			if writeErr != nil {
+				continue
+			}
+
+			progress.ProcessedRecords++
+			if result.err != nil {
+				progress.FailedRecords++
+			}
+			if progress.ProcessedRecords%progressInterval == 0 {
+				if err := r.store.Jobs().Progress(jobID, r.owner, *progress); err != nil {
+					writeErr = err
+					continue
+				}
+			}
+
+			for _, issue := range result.issues {
+				issue.Index = i
+				errEnc.Encode(issue)
+			}
+			if result.err != nil {
+				writeErr = errEnc.Encode(map[string]interface{}{"index": i, "error": result.err.Error()})
+				continue
+			}
+			if fixedWidth != nil {
+				_, writeErr = output.WriteString(result.line + "\n")
+			} else {
+				writeErr = outEnc.Encode(map[string]interface{}{"index": i, "data": result.output})
+			}
+			if writeErr == nil && len(result.missing) > 0 {
+				writeErr = errEnc.Encode(map[string]interface{}{"index": i, "warnings": map[string]interface{}{"missingRequiredFields": result.missing}})
+			}
+		}
+	}
+
+	if writeErr != nil {
+		return writeErr
+	}
+	for _, body := range []struct {
+		buffer *bufio.Writer
+		closer io.Closer
+	}{{output, outputBody}, {errorLog, errorLogBody}} {
+		if err := body.buffer.Flush(); err != nil {
+			return err
+		}
+		if err := body.closer.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transformRecord applies rules to one record, turning a panic in rule
+// evaluation into a per-record error. With a fixed-width layout the output is
+// also rendered as a line, and a field rejecting truncation fails the record.
+func transformRecord(record map[string]interface{}, rules []models.MappingRule, opts utils.TransformOptions, fixedWidth *models.FixedWidthLayout) (result recordResult) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			result = recordResult{err: fmt.Errorf("transformation panicked: %v", recovered)}
+		}
+	}()
+
+	output, err := utils.TransformWithOptions(record, rules, opts)
+	if err != nil {
+		return recordResult{err: err}
+	}
+	result = recordResult{output: output, missing: utils.MissingRequiredFields(output, rules)}
+	if fixedWidth != nil {
+		var ok bool
+		result.line, result.issues, ok = utils.FormatFixedWidthRecord(output, *fixedWidth)
+		if !ok {
+			result.err = fmt.Errorf("output does not fit the fixed-width layout")
+		}
+	}
+	return result
+}
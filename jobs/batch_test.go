@@ -0,0 +1,173 @@
+package jobs
+
+import (
+	"context"
+	"data_mapping/config"
+	"data_mapping/database"
+	"data_mapping/database/migrations"
+	"data_mapping/models"
+	"data_mapping/repository"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestStore(t *testing.T) repository.Store {
+	t.Helper()
+	db, err := database.Connect(config.Config{DBDriver: "sqlite", SQLitePath: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db = db.Session(&gorm.Session{Logger: logger.Discard})
+	if _, err := migrations.Up(db); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return repository.New(db)
+}
+
+// createTestJob stores a queued NDJSON job for a new client with a single
+// rule copying "name".
+func createTestJob(t *testing.T, store repository.Store, input string) models.BatchJob {
+	t.Helper()
+	client := models.Client{Name: "Acme", Status: models.ClientStatusActive}
+	if err := store.Clients().Create(&client); err != nil {
+		t.Fatal(err)
+	}
+	rule := models.MappingRule{ClientID: client.ID, SourcePath: models.JSONStringList{"name"}, DestinationPath: models.JSONStringList{"customer", "name"}, TransformType: "copy"}
+	if err := store.Mappings().Create(&rule); err != nil {
+		t.Fatal(err)
+	}
+
+	job := models.BatchJob{ClientID: client.ID, Status: models.JobStatusQueued, InputFormat: "ndjson", OutputFormat: models.JobOutputNDJSON}
+	if err := store.Jobs().Create(&job); err != nil {
+		t.Fatal(err)
+	}
+	w, err := store.Jobs().WriteBody(job.ID, models.JobBodyInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, input); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func readBody(t *testing.T, store repository.Store, jobID uint, body string) string {
+	t.Helper()
+	data, err := io.ReadAll(store.Jobs().ReadBody(jobID, body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestBatchRunnerRun(t *testing.T) {
+	store := newTestStore(t)
+	job := createTestJob(t, store, "{\"name\":\"Asha\"}\nnot json\n{\"name\":\"Ravi\"}\n")
+
+	runner := NewBatchRunner(store, 1, 2)
+	if err := runner.run(job.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Jobs().Get(job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != models.JobStatusCompleted || got.TotalRecords != 3 || got.ProcessedRecords != 3 || got.FailedRecords != 1 {
+		t.Errorf("job = %+v, want completed with 3 records and 1 failure", got)
+	}
+	if got.LeaseOwner != "" || got.LeaseExpiresAt != nil {
+		t.Errorf("lease of a completed job = %q until %v, want released", got.LeaseOwner, got.LeaseExpiresAt)
+	}
+
+	output := readBody(t, store, job.ID, models.JobBodyOutput)
+	if want := "{\"data\":{\"customer\":{\"name\":\"Asha\"}},\"index\":0}\n{\"data\":{\"customer\":{\"name\":\"Ravi\"}},\"index\":2}\n"; output != want {
+		t.Errorf("output = %q, want %q", output, want)
+	}
+	errorLog := readBody(t, store, job.ID, models.JobBodyErrors)
+	if strings.Count(errorLog, "\n") != 1 || !strings.Contains(errorLog, `"index":1`) {
+		t.Errorf("error log = %q, want the decode error of record 1", errorLog)
+	}
+
+	// A completed job is not claimed again.
+	if err := runner.run(job.ID); err != nil {
+		t.Fatal(err)
+	}
+	if again := readBody(t, store, job.ID, models.JobBodyOutput); again != output {
+		t.Errorf("output after a second run = %q, want it unchanged", again)
+	}
+}
+
+func TestBatchRunnerLease(t *testing.T) {
+	store := newTestStore(t)
+	job := createTestJob(t, store, "{\"name\":\"Asha\"}\n")
+	jobs := store.Jobs()
+	now := time.Now().UTC()
+
+	if claimed, err := jobs.Claim(job.ID, "other", now, now.Add(jobLease)); err != nil || !claimed {
+		t.Fatalf("Claim = %v, %v, want the queued job claimed", claimed, err)
+	}
+	runner := NewBatchRunner(store, 1, 1)
+	if ids, err := jobs.Runnable(now); err != nil || len(ids) != 0 {
+		t.Errorf("Runnable = %v, %v, want no jobs while the lease holds", ids, err)
+	}
+	if err := runner.run(job.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := jobs.Get(job.ID); got.Status != models.JobStatusRunning || got.LeaseOwner != "other" {
+		t.Errorf("job = %+v, want it left with the runner holding the lease", got)
+	}
+
+	later := now.Add(2 * jobLease)
+	if ids, err := jobs.Runnable(later); err != nil || len(ids) != 1 {
+		t.Errorf("Runnable = %v, %v, want the job once its lease expired", ids, err)
+	}
+	if err := jobs.Progress(job.ID, runner.owner, repository.JobProgress{}); err != repository.ErrLeaseLost {
+		t.Errorf("Progress without the lease = %v, want ErrLeaseLost", err)
+	}
+	if claimed, err := jobs.Claim(job.ID, runner.owner, later, later.Add(jobLease)); err != nil || !claimed {
+		t.Fatalf("Claim after expiry = %v, %v, want the job taken over", claimed, err)
+	}
+	if err := jobs.Finish(job.ID, "other", models.JobStatusCompleted, ""); err != repository.ErrLeaseLost {
+		t.Errorf("Finish by the previous owner = %v, want ErrLeaseLost", err)
+	}
+}
+
+func TestBatchRunnerStart(t *testing.T) {
+	store := newTestStore(t)
+	job := createTestJob(t, store, "{\"name\":\"Asha\"}\n")
+
+	// The job is never enqueued; the runner finds it by polling.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	NewBatchRunner(store, 1, 1).Start(ctx)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, err := store.Jobs().Get(job.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status == models.JobStatusCompleted {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job status = %q, want completed", got.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
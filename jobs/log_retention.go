@@ -0,0 +1,42 @@
+package jobs
+
+import (
+	"context"
+	"data_mapping/config"
+	"data_mapping/repository"
+	"log"
+	"time"
+)
+
+// StartLogRetention periodically prunes request logs older than
+// LogRetentionDays until ctx is done. It does nothing when retention is
+// disabled.
+func StartLogRetention(ctx context.Context, logs repository.LogRepository, cfg config.Config) {
+	if cfg.LogRetentionDays <= 0 {
+		return
+	}
+	interval := time.Duration(cfg.LogPruneInterval) * time.Minute
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	archive := cfg.LogRetentionMode == "archive"
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			cutoff := time.Now().UTC().AddDate(0, 0, -cfg.LogRetentionDays)
+			removed, err := logs.Prune(cutoff, archive)
+			if err != nil {
+				log.Printf("Log retention failed: %v", err)
+			} else if removed > 0 {
+				log.Printf("Log retention removed %d log entries older than %s", removed, cutoff.Format(time.RFC3339))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
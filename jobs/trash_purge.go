@@ -0,0 +1,43 @@
+package jobs
+
+import (
+	"context"
+	"data_mapping/config"
+	"data_mapping/repository"
+	"data_mapping/services"
+	"log"
+	"time"
+)
+
+// StartTrashPurge periodically removes clients and mapping rules that have
+// been in the trash for longer than TrashRetentionDays. It does nothing when
+// the retention is not positive, which keeps deleted records forever. The
+// purge stops when ctx is done.
+func StartTrashPurge(ctx context.Context, store repository.Store, cfg config.Config) {
+	if cfg.TrashRetentionDays <= 0 {
+		return
+	}
+	interval := time.Duration(cfg.TrashPurgeInterval) * time.Minute
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			cutoff := time.Now().UTC().AddDate(0, 0, -cfg.TrashRetentionDays)
+			clients, rules, err := services.PurgeTrash(store, cutoff)
+			if err != nil {
+				log.Printf("Trash purge failed: %v", err)
+			} else if clients > 0 || rules > 0 {
+				log.Printf("Trash purge removed %d clients and %d mapping rules deleted before %s", clients, rules, cutoff.Format(time.RFC3339))
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
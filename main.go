@@ -1,76 +1,107 @@
 package main
 
 import (
+	"context"
+	"data_mapping/app"
 	"data_mapping/config"
 	"data_mapping/database"
-	"data_mapping/handlers"
-	"data_mapping/middleware"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"os"
+	_ "time/tzdata"
 
 	"github.com/gin-gonic/gin"
 )
 
+const usage = `Usage:
+  data_mapping [serve]                          start the API server
+  data_mapping migrate up                       apply pending schema migrations
+  data_mapping migrate down [n]                 revert the last n migrations (default 1)
+  data_mapping migrate status                   list migrations and when they were applied
+  data_mapping client list                      list clients and their rule counts
+  data_mapping client create <name>             create a client
+  data_mapping client clone [flags] <id> <name> copy a client's rules, layouts and schema
+  data_mapping client delete <id>               move a client and its rules to the trash
+  data_mapping client restore <id>              take a client and its rules out of the trash
+  data_mapping mappings export [flags] <id>     export a client's rules (--all exports every client)
+  data_mapping mappings import [flags] <id> <file>
+                                                import rules with --mode merge|replace and --dry-run
+  data_mapping user add <username>              add a user, reading the password from stdin
+  data_mapping user reset <username>            set a user's password, read from stdin
+  data_mapping logs prune [--days n] [--archive]
+                                                remove old request logs
+  data_mapping trash list                       list deleted clients and mapping rules
+  data_mapping trash purge [--days n]           permanently remove old deleted records
+`
+
 func main() {
-	if config.AppConfig.LogLevel == "debug" {
-		gin.SetMode(gin.DebugMode)
-	} else {
-		gin.SetMode(gin.ReleaseMode)
+	command, args := "serve", os.Args[1:]
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
 	}
 
-	router := gin.New()
+	cfg := config.Load()
 
-	
-	router.Use(gin.Logger())
-	router.Use(middleware.ErrorHandlerMiddleware())
-	router.Use(middleware.SecurityMiddleware())
-	router.Use(middleware.CORSMiddleware())
-	router.Use(middleware.LoggingMiddleware())
-
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"status":  "healthy",
-			"service": "Data Mapping API",
-			"version": "1.0.0",
-		})
-	})
-
-	router.GET("/", func(c *gin.Context) {
-		c.JSON(200, gin.H{
-			"message": "Welcome to the Data Mapping API",
-			"version": "1.0.0",
-			"docs":    "/docs",
-		})
-	})
-
-	router.POST("/login", handlers.LoginHandler())
+	var err error
+	switch command {
+	case "serve":
+		err = serve(cfg)
+	case "migrate":
+		err = migrate(cfg, args)
+	case "client":
+		err = clientCommand(cfg, args)
+	case "mappings":
+		err = mappingsCommand(cfg, args)
+	case "user":
+		err = userCommand(cfg, args)
+	case "logs":
+		err = logsCommand(cfg, args)
+	case "trash":
+		err = trashCommand(cfg, args)
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
+		log.Fatal(err)
+	}
+}
 
-	// Protected routes
-	auth := router.Group("/")
-	auth.Use(handlers.JWTAuthMiddleware())
-	{
-		// Client management
-		auth.POST("/clients", handlers.CreateClient(database.DB))
-		auth.GET("/clients", handlers.ListClients(database.DB))
-		auth.DELETE("/clients/:id", handlers.DeleteClient(database.DB))
-		auth.POST("/clients/:client_id/mappings", handlers.CreateMappings(database.DB))
-		auth.GET("/clients/:client_id/mappings", handlers.GetMappings(database.DB))
-		auth.DELETE("/mappings/:mapping_id", handlers.DeleteMappings(database.DB))
+func serve(cfg config.Config) error {
+	if cfg.LogLevel == "debug" {
+		gin.SetMode(gin.DebugMode)
+	} else {
+		gin.SetMode(gin.ReleaseMode)
+	}
 
-		auth.POST("/clients/:client_id/transform", handlers.UnifiedTransformHandler(database.DB))
+	db, err := database.Connect(cfg)
+	if err != nil {
+		return err
 	}
+	if err := requireMigrated(db); err != nil {
+		return err
+	}
+
+	a := app.New(cfg, db)
+	a.Start(context.Background())
+	router := app.NewRouter(a)
 
-	serverAddr := ":" + config.AppConfig.ServerPort
+	serverAddr := ":" + cfg.ServerPort
 
-	if config.AppConfig.DevelopmentMode {
+	if cfg.DevelopmentMode {
 		fmt.Printf("Starting server in DEVELOPMENT mode on http://localhost%s\n", serverAddr)
 		if err := router.Run(serverAddr); err != nil {
-			log.Fatalf("Failed to start server: %v", err)
+			return fmt.Errorf("failed to start server: %w", err)
 		}
 	} else {
 		fmt.Printf("Starting server on https://localhost%s\n", serverAddr)
-		if err := router.RunTLS(serverAddr, config.AppConfig.CertFilePath, config.AppConfig.KeyFilePath); err != nil {
-			log.Fatalf("Failed to start server: %v", err)
+		if err := router.RunTLS(serverAddr, cfg.CertFilePath, cfg.KeyFilePath); err != nil {
+			return fmt.Errorf("failed to start server: %w", err)
 		}
 	}
+	return nil
 }
@@ -1,25 +1,30 @@
 package middleware
 
 import (
-	"data_mapping/database"
 	"data_mapping/models"
-	"encoding/json"
-	"fmt"
+	"data_mapping/repository"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
-func LoggingMiddleware() gin.HandlerFunc {
+// LoggingMiddleware stores every request, except those matching
+// excludePaths, in logs.
+func LoggingMiddleware(logs repository.LogRepository, excludePaths []string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		c.Next()
 
+		if isExcludedPath(c.Request.URL.Path, excludePaths) {
+			return
+		}
+
 		user, _ := c.Get("user")
 		userStr, _ := user.(string)
 
 		logEntry := models.Log{
-			Timestamp:   time.Now().Format("2006-01-02 15:04:05"),
+			Timestamp:   time.Now().UTC(),
 			Method:      c.Request.Method,
 			Path:        c.Request.URL.Path,
 			ClientIP:    c.ClientIP(),
@@ -29,13 +34,23 @@ func LoggingMiddleware() gin.HandlerFunc {
 			Error:       c.Errors.ByType(gin.ErrorTypePrivate).String(),
 		}
 
-		if err := database.DB.Create(&logEntry).Error; err != nil {
+		if err := logs.Create(&logEntry); err != nil {
 			log.Println("Failed to save log to database:", err)
-		} else {
-			log.Println("Log saved to database.")
 		}
+	}
+}
 
-		logJSON, _ := json.MarshalIndent(logEntry, "", "  ")
-		fmt.Println(string(logJSON))
+// isExcludedPath reports whether path matches one of the excluded entries.
+// Entries ending in "*" match by prefix.
+func isExcludedPath(path string, excluded []string) bool {
+	for _, p := range excluded {
+		if strings.HasSuffix(p, "*") {
+			if strings.HasPrefix(path, strings.TrimSuffix(p, "*")) {
+				return true
+			}
+		} else if path == p {
+			return true
+		}
 	}
+	return false
 }
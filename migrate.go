@@ -0,0 +1,64 @@
+package main
+
+import (
+	"data_mapping/config"
+	"data_mapping/database"
+	"data_mapping/database/migrations"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+func migrate(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New("migrate needs one of up, down or status")
+	}
+	db, err := database.Connect(cfg)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		applied, err := migrations.Up(db)
+		for _, m := range applied {
+			fmt.Printf("applied %04d %s\n", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("invalid number of migrations %q", args[1])
+			}
+		}
+		reverted, err := migrations.Down(db, steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %04d %s\n", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		statuses, err := migrations.List(db)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", status.Version, status.Name, applied)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up, down or status", args[0])
+	}
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+const (
+	AuditActionCreate  = "create"
+	AuditActionUpdate  = "update"
+	AuditActionDelete  = "delete"
+	AuditActionRestore = "restore"
+
+	AuditEntityClient       = "client"
+	AuditEntityMappingRule  = "mapping_rule"
+	AuditEntityRuleTemplate = "rule_template"
+)
+
+// AuditEvent records a single change to a client or mapping rule together with
+// who made it and the state of the entity before and after the change.
+type AuditEvent struct {
+	ID        uint         `gorm:"primaryKey" json:"id"`
+	Timestamp time.Time    `gorm:"not null;index" json:"timestamp"`
+	Actor     string       `gorm:"size:100;index" json:"actor"`
+	ClientID  uint         `gorm:"index" json:"client_id"`
+	Entity    string       `gorm:"size:50;not null;index" json:"entity"`
+	EntityID  uint         `json:"entity_id"`
+	Action    string       `gorm:"size:20;not null" json:"action"`
+	Before    JSONDocument `json:"before"`
+	After     JSONDocument `json:"after"`
+	RequestID string       `gorm:"size:64;index" json:"request_id,omitempty"`
+}
@@ -0,0 +1,69 @@
+package models
+
+import "time"
+
+const (
+	JobOutputNDJSON     = "ndjson"
+	JobOutputFixedWidth = "fixed-width"
+)
+
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusCompleted = "completed"
+	JobStatusFailed    = "failed"
+)
+
+// BatchJob is an asynchronous transformation of many input records. Its
+// upload, output and error log are stored as BatchJobChunk rows and only
+// returned through the download endpoints: the error log is newline-delimited
+// JSON, the output NDJSON or fixed-width lines depending on OutputFormat.
+type BatchJob struct {
+	ID           uint   `gorm:"primaryKey" json:"id"`
+	ClientID     uint   `gorm:"not null;index" json:"client_id"`
+	Status       string `gorm:"size:20;not null;index" json:"status"`
+	InputFormat  string `gorm:"size:20;not null" json:"input_format"`
+	OutputFormat string `gorm:"size:20;not null;default:ndjson" json:"output_format"`
+	// LeaseOwner is the runner working on a running job, which holds it
+	// until LeaseExpiresAt unless it renews the lease.
+	LeaseOwner       string     `gorm:"size:100" json:"-"`
+	LeaseExpiresAt   *time.Time `json:"-"`
+	RuleSetVersion   string     `gorm:"size:64" json:"rule_set_version,omitempty"`
+	TotalRecords     int        `json:"total_records"`
+	ProcessedRecords int        `json:"processed_records"`
+	FailedRecords    int        `json:"failed_records"`
+	Error            string     `gorm:"type:text" json:"error,omitempty"`
+	CreatedBy        string     `gorm:"size:100" json:"created_by,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	StartedAt        *time.Time `json:"started_at,omitempty"`
+	FinishedAt       *time.Time `json:"finished_at,omitempty"`
+}
+
+const (
+	JobBodyInput  = "input"
+	JobBodyOutput = "output"
+	JobBodyErrors = "errors"
+)
+
+// BatchJobChunk is one piece of the upload, output or error log of a batch
+// job. Bodies are split into chunks so that neither uploads nor workers hold
+// a whole body in memory.
+type BatchJobChunk struct {
+	ID    uint   `gorm:"primaryKey"`
+	JobID uint   `gorm:"not null;uniqueIndex:idx_batch_job_chunks_position"`
+	Body  string `gorm:"size:20;not null;uniqueIndex:idx_batch_job_chunks_position"`
+	Seq   int    `gorm:"not null;uniqueIndex:idx_batch_job_chunks_position"`
+	Data  []byte `gorm:"not null"`
+}
+
+// Progress returns the share of records processed, from 0 to 100.
+func (j BatchJob) Progress() float64 {
+	if j.TotalRecords == 0 {
+		if j.Status == JobStatusCompleted {
+			return 100
+		}
+		return 0
+	}
+	return float64(j.ProcessedRecords) * 100 / float64(j.TotalRecords)
+}
@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+const (
+	LayoutFormatXML        = "xml"
+	LayoutFormatFixedWidth = "fixed-width"
+)
+
+// OutputLayout stores a client's settings for one output format. Definition
+// holds the format-specific layout, such as an XMLLayout.
+type OutputLayout struct {
+	ID         uint         `gorm:"primaryKey" json:"id"`
+	ClientID   uint         `gorm:"not null;uniqueIndex:idx_output_layouts_client_format" json:"client_id"`
+	Format     string       `gorm:"size:20;not null;uniqueIndex:idx_output_layouts_client_format" json:"format"`
+	Definition JSONDocument `gorm:"not null" json:"definition"`
+	CreatedAt  time.Time    `json:"created_at"`
+	UpdatedAt  time.Time    `json:"updated_at"`
+}
+
+// XMLLayout describes how transformed records are serialized as XML.
+type XMLLayout struct {
+	// RootElement wraps the output document.
+	RootElement string `json:"root_element" validate:"required"`
+	// RecordElement wraps each record when several records are streamed.
+	RecordElement string `json:"record_element"`
+	// Namespaces maps prefixes to URIs declared on the root element. The
+	// empty prefix declares the default namespace.
+	Namespaces map[string]string `json:"namespaces"`
+	// Attributes lists destination paths, joined with ".", that are written
+	// as attributes of their parent element instead of child elements.
+	Attributes []string `json:"attributes"`
+}
+
+// FixedWidthLayout describes a fixed-width flat-file record.
+type FixedWidthLayout struct {
+	Fields []FixedWidthField `json:"fields" validate:"required,min=1,dive"`
+	// LineLength pads every line to this length. When zero, lines end at the
+	// last field.
+	LineLength int `json:"line_length" validate:"min=0"`
+}
+
+// FixedWidthField places one destination path in a fixed-width record.
+type FixedWidthField struct {
+	// Name is the DestinationPath joined with ".".
+	Name string `json:"name" validate:"required"`
+	// Start is the 1-based column where the field begins.
+	Start  int    `json:"start" validate:"min=1"`
+	Length int    `json:"length" validate:"min=1"`
+	Align  string `json:"align" validate:"omitempty,oneof=left right"`
+	// Pad is the fill character, a space by default.
+	Pad string `json:"pad" validate:"omitempty,len=1"`
+	// Format is a printf verb applied to numeric values, such as "%.2f".
+	Format string `json:"format"`
+	// ImpliedDecimals writes numbers scaled by 10^n without a decimal point.
+	ImpliedDecimals int `json:"implied_decimals" validate:"min=0,max=10"`
+	// OnTruncate is "warn" (the default) to cut values that do not fit, or
+	// "error" to reject the record.
+	OnTruncate string `json:"on_truncate" validate:"omitempty,oneof=warn error"`
+}
@@ -4,40 +4,256 @@ import (
 	"database/sql/driver"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Client statuses. Suspended clients cannot transform data.
+const (
+	ClientStatusDraft     = "draft"
+	ClientStatusActive    = "active"
+	ClientStatusSuspended = "suspended"
+)
+
+// Null policies decide what rules do with a source value that is null.
+const (
+	// NullPolicyKeep transforms null like any other value.
+	NullPolicyKeep = "keep"
+	// NullPolicyOmit treats null as a missing value, so only required
+	// rules write their destination, with their default.
+	NullPolicyOmit = "omit"
 )
 
+// Client names are unique among clients that are not deleted, so that a
+// deleted client's name can be reused while it waits in the trash.
 type Client struct {
-	ID        uint      `gorm:"primaryKey" json:"id"`
-	Name      string    `gorm:"unique;not null" json:"name" validate:"required,min=1,max=100"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	Name        string         `gorm:"not null;uniqueIndex:idx_clients_name_live,where:deleted_at IS NULL" json:"name" validate:"required,min=1,max=100"`
+	Status      string         `gorm:"size:20;not null;default:active" json:"status" validate:"required,oneof=draft active suspended"`
+	Contact     string         `gorm:"size:255" json:"contact" validate:"max=255"`
+	PartnerCode string         `gorm:"size:50;index" json:"partner_code" validate:"max=50"`
+	Tags        JSONStringList `json:"tags" validate:"dive,min=1,max=50"`
+	Settings    ClientSettings `gorm:"embedded;embeddedPrefix:settings_" json:"settings"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+}
+
+// ClientSettings change how a client's input is transformed. Zero values keep
+// the defaults.
+type ClientSettings struct {
+	// Timezone is the IANA zone that dates without a zone are read in and
+	// that the now and today expression helpers use.
+	Timezone string `gorm:"size:64" json:"timezone" validate:"omitempty,timezone"`
+	// DateLayouts are Go time layouts formatDate tries before the built-in
+	// ones.
+	DateLayouts JSONStringList `json:"date_layouts" validate:"dive,min=1"`
+	NullPolicy  string         `gorm:"size:20" json:"null_policy" validate:"omitempty,oneof=keep omit"`
+	// OutputFormat is the response format used when a transform request
+	// does not name one in its Accept header.
+	OutputFormat string `gorm:"size:20" json:"output_format" validate:"omitempty,oneof=json ndjson csv xml fixed-width"`
+	// StrictMode fails a record when one of its rules fails, e.g. on a
+	// missing lookup entry, instead of leaving the destination unset.
+	StrictMode bool `gorm:"not null;default:false" json:"strict_mode"`
 }
 
+// Merge strategies decide what a rule does when its destination already holds
+// a value written by an earlier rule.
+const (
+	MergeOverwrite     = "overwrite"
+	MergeKeepFirst     = "keep-first"
+	MergeAppendToArray = "append-to-array"
+	MergeDeepMerge     = "deep-merge"
+)
+
 type MappingRule struct {
 	ID              uint           `gorm:"primaryKey" json:"id"`
 	ClientID        uint           `gorm:"not null" json:"client_id"`
 	Client          Client         `gorm:"foreignKey:ClientID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-" validate:"-"`
-	SourcePath      JSONStringList `gorm:"type:jsonb;not null" json:"source_path" validate:"required,min=1"`
-	DestinationPath JSONStringList `gorm:"type:jsonb;not null" json:"destination_path" validate:"required,min=1"`
-	TransformType   string         `gorm:"not null" json:"transform_type" validate:"required,oneof=copy toString mapGender toBool formatDate toUpperCase toLowerCase capitalize expression"`
+	SourcePath      JSONStringList `gorm:"not null" json:"source_path" validate:"required,min=1"`
+	DestinationPath JSONStringList `gorm:"not null" json:"destination_path" validate:"required,min=1"`
+	TransformType   string         `gorm:"not null" json:"transform_type" validate:"required,oneof=copy toString mapGender toBool formatDate toUpperCase toLowerCase capitalize expression lookup"`
 	TransformLogic  string         `gorm:"type:text" json:"transform_logic"`
 	Required        bool           `gorm:"default:false" json:"required"`
 	DefaultValue    string         `gorm:"type:text" json:"default_value"`
+	LookupTable     JSONStringMap  `json:"lookup_table,omitempty"`
+	InverseLogic    string         `gorm:"type:text" json:"inverse_logic,omitempty"`
+	MergeStrategy   string         `gorm:"not null;default:overwrite" json:"merge_strategy" validate:"omitempty,oneof=overwrite keep-first append-to-array deep-merge"`
 	CreatedAt       time.Time      `json:"created_at"`
 	UpdatedAt       time.Time      `json:"updated_at"`
+	DeletedAt       gorm.DeletedAt `gorm:"index" json:"deleted_at,omitempty"`
+}
+
+// Strategy returns the rule's merge strategy, treating an unset strategy as
+// overwrite.
+func (r MappingRule) Strategy() string {
+	if r.MergeStrategy == "" {
+		return MergeOverwrite
+	}
+	return r.MergeStrategy
 }
 
 type JSONStringList []string
 
 func (j *JSONStringList) Scan(value interface{}) error {
-	bytes, ok := value.([]byte)
-	if !ok {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, j)
+	case string:
+		return json.Unmarshal([]byte(v), j)
+	default:
 		return fmt.Errorf("failed to unmarshal JSONB value")
 	}
-	return json.Unmarshal(bytes, j)
 }
 
 func (j JSONStringList) Value() (driver.Value, error) {
 	return json.Marshal(j)
 }
+
+// UnmarshalJSON accepts either an array of path segments or a dotted string
+// such as "applicant.address.city".
+func (j *JSONStringList) UnmarshalJSON(data []byte) error {
+	var dotted string
+	if err := json.Unmarshal(data, &dotted); err == nil {
+		*j = splitDottedPath(dotted)
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("path must be an array of strings or a dotted string")
+	}
+	*j = list
+	return nil
+}
+
+// UnmarshalYAML accepts the same notations as UnmarshalJSON.
+func (j *JSONStringList) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*j = splitDottedPath(node.Value)
+		return nil
+	}
+	var list []string
+	if err := node.Decode(&list); err != nil {
+		return fmt.Errorf("line %d: path must be a sequence of strings or a dotted string", node.Line)
+	}
+	*j = list
+	return nil
+}
+
+// Dotted returns the path joined with ".".
+func (j JSONStringList) Dotted() string {
+	return strings.Join(j, ".")
+}
+
+// JSONStringMap is a string to string map stored as a JSON object, used for
+// lookup tables.
+type JSONStringMap map[string]string
+
+func (m *JSONStringMap) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*m = nil
+		return nil
+	case []byte:
+		return json.Unmarshal(v, m)
+	case string:
+		return json.Unmarshal([]byte(v), m)
+	default:
+		return fmt.Errorf("failed to unmarshal JSONB value")
+	}
+}
+
+func (m JSONStringMap) Value() (driver.Value, error) {
+	if m == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(m)
+	return string(data), err
+}
+
+func splitDottedPath(dotted string) JSONStringList {
+	if dotted == "" {
+		return JSONStringList{}
+	}
+	return strings.Split(dotted, ".")
+}
+
+// JSONDocument holds an arbitrary JSON value, such as an entity snapshot.
+type JSONDocument json.RawMessage
+
+func NewJSONDocument(v interface{}) (JSONDocument, error) {
+	if v == nil {
+		return nil, nil
+	}
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return JSONDocument(bytes), nil
+}
+
+func (j *JSONDocument) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		*j = nil
+	case []byte:
+		*j = append((*j)[:0], v...)
+	case string:
+		*j = JSONDocument(v)
+	default:
+		return fmt.Errorf("failed to unmarshal JSON document")
+	}
+	return nil
+}
+
+func (j JSONDocument) Value() (driver.Value, error) {
+	if len(j) == 0 {
+		return nil, nil
+	}
+	return string(j), nil
+}
+
+func (j JSONDocument) MarshalJSON() ([]byte, error) {
+	if len(j) == 0 {
+		return []byte("null"), nil
+	}
+	return j, nil
+}
+
+func (j *JSONDocument) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*j = nil
+		return nil
+	}
+	*j = append((*j)[:0], data...)
+	return nil
+}
+
+// jsonColumnType stores JSON values as jsonb on Postgres and as text on
+// other databases such as SQLite.
+func jsonColumnType(db *gorm.DB) string {
+	if db.Dialector.Name() == "postgres" {
+		return "jsonb"
+	}
+	return "text"
+}
+
+func (JSONStringList) GormDataType() string { return "json" }
+func (JSONStringMap) GormDataType() string  { return "json" }
+func (JSONDocument) GormDataType() string   { return "json" }
+
+func (JSONStringList) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return jsonColumnType(db)
+}
+
+func (JSONStringMap) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return jsonColumnType(db)
+}
+
+func (JSONDocument) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	return jsonColumnType(db)
+}
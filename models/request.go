@@ -4,6 +4,83 @@ type TransformationRequest struct {
 	InputData map[string]interface{} `json:"input_data" binding:"required" validate:"required"`
 }
 
+// CreateClientRequest creates a client. Status defaults to active.
 type CreateClientRequest struct {
-	Name string `json:"name" binding:"required" validate:"required,min=1,max=100"`
+	Name        string         `json:"name" binding:"required" validate:"required,min=1,max=100"`
+	Status      string         `json:"status" validate:"omitempty,oneof=draft active suspended"`
+	Contact     string         `json:"contact"`
+	PartnerCode string         `json:"partner_code"`
+	Tags        JSONStringList `json:"tags"`
+	Settings    ClientSettings `json:"settings"`
+}
+
+// UpdateClientRequest changes the fields it sets; Settings replaces all
+// settings at once.
+type UpdateClientRequest struct {
+	Name        *string         `json:"name"`
+	Status      *string         `json:"status"`
+	Contact     *string         `json:"contact"`
+	PartnerCode *string         `json:"partner_code"`
+	Tags        *JSONStringList `json:"tags"`
+	Settings    *ClientSettings `json:"settings"`
+}
+
+// PathRewrite replaces the prefix From of source or destination paths with
+// To.
+type PathRewrite struct {
+	Target string         `json:"target" validate:"required,oneof=source destination"`
+	From   JSONStringList `json:"from" validate:"min=1"`
+	To     JSONStringList `json:"to"`
+}
+
+// CloneClientRequest names the copy of a client. Each path is rewritten by
+// the first rewrite whose prefix it starts with.
+type CloneClientRequest struct {
+	Name         string        `json:"name" binding:"required" validate:"required,min=1,max=100"`
+	PathRewrites []PathRewrite `json:"path_rewrites" validate:"dive"`
+}
+
+// MappingRuleSpec is the portable form of a mapping rule used to import and
+// export rule sets. Paths may be written as arrays or dotted strings.
+type MappingRuleSpec struct {
+	SourcePath      JSONStringList `json:"source_path" yaml:"source_path"`
+	DestinationPath JSONStringList `json:"destination_path" yaml:"destination_path"`
+	TransformType   string         `json:"transform_type" yaml:"transform_type"`
+	TransformLogic  string         `json:"transform_logic,omitempty" yaml:"transform_logic,omitempty"`
+	Required        bool           `json:"required" yaml:"required"`
+	DefaultValue    string         `json:"default_value,omitempty" yaml:"default_value,omitempty"`
+	LookupTable     JSONStringMap  `json:"lookup_table,omitempty" yaml:"lookup_table,omitempty"`
+	InverseLogic    string         `json:"inverse_logic,omitempty" yaml:"inverse_logic,omitempty"`
+	MergeStrategy   string         `json:"merge_strategy,omitempty" yaml:"merge_strategy,omitempty"`
+}
+
+// NewMappingRuleSpec returns the portable form of rule.
+func NewMappingRuleSpec(rule MappingRule) MappingRuleSpec {
+	return MappingRuleSpec{
+		SourcePath:      rule.SourcePath,
+		DestinationPath: rule.DestinationPath,
+		TransformType:   rule.TransformType,
+		TransformLogic:  rule.TransformLogic,
+		Required:        rule.Required,
+		DefaultValue:    rule.DefaultValue,
+		LookupTable:     rule.LookupTable,
+		InverseLogic:    rule.InverseLogic,
+		MergeStrategy:   rule.MergeStrategy,
+	}
+}
+
+// Rule converts the spec into a mapping rule for clientID.
+func (s MappingRuleSpec) Rule(clientID uint) MappingRule {
+	return MappingRule{
+		ClientID:        clientID,
+		SourcePath:      s.SourcePath,
+		DestinationPath: s.DestinationPath,
+		TransformType:   s.TransformType,
+		TransformLogic:  s.TransformLogic,
+		Required:        s.Required,
+		DefaultValue:    s.DefaultValue,
+		LookupTable:     s.LookupTable,
+		InverseLogic:    s.InverseLogic,
+		MergeStrategy:   s.MergeStrategy,
+	}
 }
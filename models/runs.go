@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+const (
+	RunStatusSuccess = "success"
+	RunStatusFailed  = "failed"
+)
+
+// TransformRun records one call to the transform endpoint so that a payload
+// can be inspected or replayed later. Input and Output are only populated
+// when body storage is enabled and are encrypted at rest.
+type TransformRun struct {
+	ID             uint         `gorm:"primaryKey" json:"id"`
+	ClientID       uint         `gorm:"not null;index" json:"client_id"`
+	RuleSetVersion string       `gorm:"size:64" json:"rule_set_version"`
+	RuleCount      int          `json:"rule_count"`
+	InputHash      string       `gorm:"size:64;index" json:"input_hash"`
+	Input          string       `gorm:"type:text" json:"-"`
+	Output         string       `gorm:"type:text" json:"-"`
+	Streamed       bool         `json:"streamed"`
+	DurationMs     int64        `json:"duration_ms"`
+	Warnings       JSONDocument `json:"warnings"`
+	Status         string       `gorm:"size:20;not null" json:"status"`
+	Error          string       `gorm:"type:text" json:"error,omitempty"`
+	Actor          string       `gorm:"size:100" json:"actor,omitempty"`
+	RequestID      string       `gorm:"size:64" json:"request_id,omitempty"`
+	CreatedAt      time.Time    `gorm:"index" json:"created_at"`
+}
+
+// HasBodies reports whether the run's input and output were stored.
+func (r TransformRun) HasBodies() bool {
+	return r.Input != ""
+}
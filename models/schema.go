@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// InputSchema is the path catalog inferred from a client's sample inputs.
+// Fields holds a []SchemaField. A client has at most one schema; inferring
+// again replaces it.
+type InputSchema struct {
+	ID          uint         `gorm:"primaryKey" json:"id"`
+	ClientID    uint         `gorm:"not null;uniqueIndex" json:"client_id"`
+	SampleCount int          `gorm:"not null" json:"sample_count"`
+	Fields      JSONDocument `gorm:"not null" json:"fields"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// SchemaCardinality values describe how often a path occurs in one record.
+const (
+	CardinalityOne  = "one"
+	CardinalityMany = "many"
+)
+
+// SchemaField describes one path found in sample records. Array elements are
+// written as a "*" segment, so "applicants.*.name" covers the name of every
+// applicant.
+type SchemaField struct {
+	Path JSONStringList `json:"path"`
+	// Types lists the JSON types seen at the path: string, number, integer,
+	// boolean, object, array or null.
+	Types []string `json:"types"`
+	// Cardinality is many when the path is inside an array.
+	Cardinality string `json:"cardinality"`
+	// Samples counts the sample records that contain the path.
+	Samples int `json:"samples"`
+	// Optional is set when some samples do not contain the path.
+	Optional bool `json:"optional"`
+	// MaxItems is the longest array seen, for array fields.
+	MaxItems int `json:"max_items,omitempty"`
+	// Examples holds up to three distinct scalar values.
+	Examples []interface{} `json:"examples,omitempty"`
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// RuleTemplate is a named set of mapping rules that clients extend. A
+// client's own rules override template rules with the same destination.
+type RuleTemplate struct {
+	ID          uint           `gorm:"primaryKey" json:"id"`
+	Name        string         `gorm:"size:100;not null;uniqueIndex" json:"name" validate:"required,min=1,max=100"`
+	Description string         `gorm:"type:text" json:"description"`
+	Rules       []TemplateRule `gorm:"foreignKey:TemplateID" json:"rules,omitempty" validate:"-"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+// TemplateRule is one rule of a RuleTemplate. Rules are applied in ID order.
+type TemplateRule struct {
+	ID              uint `gorm:"primaryKey" json:"id"`
+	TemplateID      uint `gorm:"not null;index" json:"template_id"`
+	MappingRuleSpec `gorm:"embedded"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// ClientTemplate records that a client extends a template. Templates with a
+// higher Position override those with a lower one.
+type ClientTemplate struct {
+	ClientID   uint `gorm:"primaryKey;autoIncrement:false" json:"client_id"`
+	TemplateID uint `gorm:"primaryKey;autoIncrement:false;index" json:"template_id"`
+	Position   int  `gorm:"not null" json:"position"`
+}
+
+// RuleTemplateRequest creates a template, or replaces its name, description
+// and rules.
+type RuleTemplateRequest struct {
+	Name        string            `json:"name" binding:"required" validate:"required,min=1,max=100"`
+	Description string            `json:"description"`
+	Rules       []MappingRuleSpec `json:"rules"`
+}
+
+// ClientTemplatesRequest sets the templates a client extends, lowest
+// precedence first.
+type ClientTemplatesRequest struct {
+	TemplateIDs []uint `json:"template_ids"`
+}
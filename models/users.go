@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// User is an account that can log in to the API. Passwords are stored as
+// bcrypt hashes.
+type User struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	Username     string    `gorm:"size:100;not null;uniqueIndex" json:"username"`
+	PasswordHash string    `gorm:"size:100;not null" json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
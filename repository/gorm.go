@@ -0,0 +1,808 @@
+package repository
+
+import (
+	"data_mapping/models"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// New returns a Store backed by db. It supports the postgres and sqlite
+// dialectors; column types that differ between them are chosen by the models.
+func New(db *gorm.DB) Store {
+	return gormStore{db: db}
+}
+
+type gormStore struct {
+	db *gorm.DB
+}
+
+func (s gormStore) Clients() ClientRepository     { return gormClients{s.db} }
+func (s gormStore) Mappings() MappingRepository   { return gormMappings{s.db} }
+func (s gormStore) Logs() LogRepository           { return gormLogs{s.db} }
+func (s gormStore) Audit() AuditRepository        { return gormAudit{s.db} }
+func (s gormStore) Users() UserRepository         { return gormUsers{s.db} }
+func (s gormStore) Layouts() LayoutRepository     { return gormLayouts{s.db} }
+func (s gormStore) Schemas() SchemaRepository     { return gormSchemas{s.db} }
+func (s gormStore) Templates() TemplateRepository { return gormTemplates{s.db} }
+func (s gormStore) Runs() RunRepository           { return gormRuns{s.db} }
+func (s gormStore) Jobs() JobRepository           { return gormJobs{s.db} }
+
+func (s gormStore) Transaction(fn func(tx Store) error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return fn(gormStore{db: tx})
+	})
+}
+
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+type gormClients struct {
+	db *gorm.DB
+}
+
+func (r gormClients) List() ([]models.Client, error) {
+	var clients []models.Client
+	err := r.db.Order("id").Find(&clients).Error
+	return clients, err
+}
+
+func (r gormClients) Search(filter ClientFilter, limit, offset int) ([]models.Client, int64, error) {
+	query := r.db.Model(&models.Client{})
+	if filter.Name != "" {
+		query = query.Where(`LOWER(name) LIKE ? ESCAPE '\'`, containsPattern(filter.Name))
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.PartnerCode != "" {
+		query = query.Where("partner_code = ?", filter.PartnerCode)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var clients []models.Client
+	err := query.Order(orderBy(filter.Sort, ClientSortFields)).Limit(limit).Offset(offset).Find(&clients).Error
+	return clients, total, err
+}
+
+func (r gormClients) Get(id uint) (models.Client, error) {
+	var client models.Client
+	err := r.db.First(&client, id).Error
+	return client, notFound(err)
+}
+
+func (r gormClients) Create(client *models.Client) error {
+	return r.db.Create(client).Error
+}
+
+func (r gormClients) Update(client *models.Client) error {
+	return r.db.Save(client).Error
+}
+
+func (r gormClients) Delete(id uint) error {
+	return r.db.Delete(&models.Client{}, id).Error
+}
+
+func (r gormClients) GetByName(name string) (models.Client, error) {
+	var client models.Client
+	err := r.db.Where("name = ?", name).First(&client).Error
+	return client, notFound(err)
+}
+
+func (r gormClients) ListDeleted() ([]models.Client, error) {
+	var clients []models.Client
+	err := r.db.Unscoped().Where("deleted_at IS NOT NULL").Order("deleted_at DESC").Find(&clients).Error
+	return clients, err
+}
+
+func (r gormClients) GetDeleted(id uint) (models.Client, error) {
+	var client models.Client
+	err := r.db.Unscoped().Where("deleted_at IS NOT NULL").First(&client, id).Error
+	return client, notFound(err)
+}
+
+func (r gormClients) Restore(id uint) error {
+	return r.db.Unscoped().Model(&models.Client{}).Where("id = ?", id).Update("deleted_at", nil).Error
+}
+
+func (r gormClients) Purge(cutoff time.Time) (int64, error) {
+	var purged int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		expired := tx.Unscoped().Model(&models.Client{}).Select("id").Where("deleted_at < ?", cutoff)
+		if err := tx.Unscoped().Where("client_id IN (?)", expired).Delete(&models.MappingRule{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("client_id IN (?)", expired).Delete(&models.ClientTemplate{}).Error; err != nil {
+			return err
+		}
+		result := tx.Unscoped().Where("deleted_at < ?", cutoff).Delete(&models.Client{})
+		purged = result.RowsAffected
+		return result.Error
+	})
+	return purged, err
+}
+
+type gormMappings struct {
+	db *gorm.DB
+}
+
+func (r gormMappings) ListByClient(clientID uint) ([]models.MappingRule, error) {
+	var rules []models.MappingRule
+	err := r.db.Where("client_id = ?", clientID).Order("id").Find(&rules).Error
+	return rules, err
+}
+
+// Search filters, sorts and pages in SQL unless the filter or sort involves
+// a path. Paths are stored as JSON whose text form differs between
+// databases, so those searches load the client's rules that match the other
+// filters and filter, sort and page them in memory. This is deliberate: a
+// client has at most a few hundred rules.
+func (r gormMappings) Search(clientID uint, filter MappingFilter, limit, offset int) ([]models.MappingRule, int64, error) {
+	query := r.db.Model(&models.MappingRule{}).Where("client_id = ?", clientID)
+	if filter.TransformType != "" {
+		query = query.Where("transform_type = ?", filter.TransformType)
+	}
+	if filter.Required != nil {
+		query = query.Where("required = ?", *filter.Required)
+	}
+
+	byPath := filter.Path != "" || filter.SourcePath != "" || filter.DestinationPath != "" ||
+		filter.Sort.Field == "source_path" || filter.Sort.Field == "destination_path"
+	if !byPath {
+		var total int64
+		if err := query.Count(&total).Error; err != nil {
+			return nil, 0, err
+		}
+		rules := []models.MappingRule{}
+		err := query.Order(orderBy(filter.Sort, MappingSortFields)).Limit(limit).Offset(offset).Find(&rules).Error
+		return rules, total, err
+	}
+
+	var candidates []models.MappingRule
+	if err := query.Order("id").Find(&candidates).Error; err != nil {
+		return nil, 0, err
+	}
+
+	rules := make([]models.MappingRule, 0, len(candidates))
+	for _, rule := range candidates {
+		source, destination := dottedPath(rule.SourcePath), dottedPath(rule.DestinationPath)
+		if filter.Path != "" && !containsFold(source, filter.Path) && !containsFold(destination, filter.Path) {
+			continue
+		}
+		if filter.SourcePath != "" && !containsFold(source, filter.SourcePath) {
+			continue
+		}
+		if filter.DestinationPath != "" && !containsFold(destination, filter.DestinationPath) {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	sortMappingRules(rules, filter.Sort)
+
+	total := int64(len(rules))
+	if offset >= len(rules) {
+		return []models.MappingRule{}, total, nil
+	}
+	rules = rules[offset:]
+	if limit < len(rules) {
+		rules = rules[:limit]
+	}
+	return rules, total, nil
+}
+
+func sortMappingRules(rules []models.MappingRule, by Sort) {
+	less := func(a, b models.MappingRule) bool { return a.ID < b.ID }
+	switch by.Field {
+	case "source_path":
+		less = func(a, b models.MappingRule) bool { return dottedPath(a.SourcePath) < dottedPath(b.SourcePath) }
+	case "destination_path":
+		less = func(a, b models.MappingRule) bool {
+			return dottedPath(a.DestinationPath) < dottedPath(b.DestinationPath)
+		}
+	case "transform_type":
+		less = func(a, b models.MappingRule) bool { return a.TransformType < b.TransformType }
+	case "required":
+		less = func(a, b models.MappingRule) bool { return !a.Required && b.Required }
+	case "created_at":
+		less = func(a, b models.MappingRule) bool { return a.CreatedAt.Before(b.CreatedAt) }
+	case "updated_at":
+		less = func(a, b models.MappingRule) bool { return a.UpdatedAt.Before(b.UpdatedAt) }
+	}
+	// Ties are broken by ID in the sort direction, as orderBy does.
+	sort.Slice(rules, func(i, j int) bool {
+		a, b := rules[i], rules[j]
+		if by.Desc {
+			a, b = b, a
+		}
+		if less(a, b) != less(b, a) {
+			return less(a, b)
+		}
+		return a.ID < b.ID
+	})
+}
+
+func (r gormMappings) Get(id uint) (models.MappingRule, error) {
+	var rule models.MappingRule
+	err := r.db.First(&rule, id).Error
+	return rule, notFound(err)
+}
+
+func (r gormMappings) Create(rule *models.MappingRule) error {
+	return r.db.Create(rule).Error
+}
+
+func (r gormMappings) Update(rule *models.MappingRule) error {
+	return r.db.Save(rule).Error
+}
+
+func (r gormMappings) Delete(id uint) error {
+	return r.db.Delete(&models.MappingRule{}, id).Error
+}
+
+func (r gormMappings) DeleteByClient(clientID uint) error {
+	return r.db.Where("client_id = ?", clientID).Delete(&models.MappingRule{}).Error
+}
+
+func (r gormMappings) ListDeleted() ([]models.MappingRule, error) {
+	var rules []models.MappingRule
+	err := r.db.Unscoped().
+		Where("deleted_at IS NOT NULL").
+		Where("client_id IN (?)", r.db.Model(&models.Client{}).Select("id")).
+		Order("deleted_at DESC").
+		Find(&rules).Error
+	return rules, err
+}
+
+func (r gormMappings) GetDeleted(id uint) (models.MappingRule, error) {
+	var rule models.MappingRule
+	err := r.db.Unscoped().Where("deleted_at IS NOT NULL").First(&rule, id).Error
+	return rule, notFound(err)
+}
+
+func (r gormMappings) Restore(id uint) error {
+	return r.db.Unscoped().Model(&models.MappingRule{}).Where("id = ?", id).Update("deleted_at", nil).Error
+}
+
+func (r gormMappings) RestoreByClient(clientID uint, since time.Time) ([]models.MappingRule, error) {
+	var rules []models.MappingRule
+	query := r.db.Unscoped().Where("client_id = ? AND deleted_at >= ?", clientID, since)
+	if err := query.Order("id").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return rules, nil
+	}
+	err := r.db.Unscoped().Model(&models.MappingRule{}).Where("client_id = ? AND deleted_at >= ?", clientID, since).Update("deleted_at", nil).Error
+	for i := range rules {
+		rules[i].DeletedAt = gorm.DeletedAt{}
+	}
+	return rules, err
+}
+
+func (r gormMappings) Purge(cutoff time.Time) (int64, error) {
+	result := r.db.Unscoped().Where("deleted_at < ?", cutoff).Delete(&models.MappingRule{})
+	return result.RowsAffected, result.Error
+}
+
+type gormLogs struct {
+	db *gorm.DB
+}
+
+func (r gormLogs) Create(entry *models.Log) error {
+	return r.db.Create(entry).Error
+}
+
+func (r gormLogs) List(filter LogFilter, limit, offset int) ([]models.Log, int64, error) {
+	query := r.db.Model(&models.Log{})
+	if filter.StatusFrom > 0 {
+		query = query.Where("status_code >= ?", filter.StatusFrom)
+	}
+	if filter.StatusTo > 0 {
+		query = query.Where("status_code < ?", filter.StatusTo)
+	}
+	if filter.PathPrefix != "" {
+		query = query.Where(`path LIKE ? ESCAPE '\'`, escapeLike(filter.PathPrefix)+"%")
+	}
+	if filter.Method != "" {
+		query = query.Where("method = ?", filter.Method)
+	}
+	if filter.User != "" {
+		query = query.Where(`"user" = ?`, filter.User)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("timestamp >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("timestamp < ?", filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var logs []models.Log
+	err := query.Order("timestamp DESC, id DESC").Limit(limit).Offset(offset).Find(&logs).Error
+	return logs, total, err
+}
+
+func (r gormLogs) Prune(cutoff time.Time, archive bool) (int64, error) {
+	var removed int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if archive {
+			err := tx.Exec(`INSERT INTO archived_logs (id, timestamp, method, path, client_ip, status_code, "user", query_params, error)
+				SELECT id, timestamp, method, path, client_ip, status_code, "user", query_params, error
+				FROM logs WHERE timestamp < ?`, cutoff).Error
+			if err != nil {
+				return err
+			}
+		}
+		result := tx.Where("timestamp < ?", cutoff).Delete(&models.Log{})
+		if result.Error != nil {
+			return result.Error
+		}
+		removed = result.RowsAffected
+		return nil
+	})
+	return removed, err
+}
+
+type gormAudit struct {
+	db *gorm.DB
+}
+
+func (r gormAudit) Record(event *models.AuditEvent) error {
+	return r.db.Create(event).Error
+}
+
+func (r gormAudit) List(filter AuditFilter, limit, offset int) ([]models.AuditEvent, int64, error) {
+	query := r.db.Model(&models.AuditEvent{})
+	if filter.ClientID != nil {
+		query = query.Where("client_id = ?", *filter.ClientID)
+	}
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	if filter.Entity != "" {
+		query = query.Where("entity = ?", filter.Entity)
+	}
+	if filter.EntityID != 0 {
+		query = query.Where("entity_id = ?", filter.EntityID)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("timestamp >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("timestamp < ?", filter.To)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var events []models.AuditEvent
+	err := query.Order("timestamp DESC, id DESC").Limit(limit).Offset(offset).Find(&events).Error
+	return events, total, err
+}
+
+type gormUsers struct {
+	db *gorm.DB
+}
+
+func (r gormUsers) Count() (int64, error) {
+	var count int64
+	err := r.db.Model(&models.User{}).Count(&count).Error
+	return count, err
+}
+
+func (r gormUsers) GetByUsername(username string) (models.User, error) {
+	var user models.User
+	err := r.db.Where("username = ?", username).First(&user).Error
+	return user, notFound(err)
+}
+
+func (r gormUsers) Create(user *models.User) error {
+	return r.db.Create(user).Error
+}
+
+func (r gormUsers) Update(user *models.User) error {
+	return r.db.Save(user).Error
+}
+
+type gormLayouts struct {
+	db *gorm.DB
+}
+
+func (r gormLayouts) ListByClient(clientID uint) ([]models.OutputLayout, error) {
+	var layouts []models.OutputLayout
+	err := r.db.Where("client_id = ?", clientID).Order("format").Find(&layouts).Error
+	return layouts, err
+}
+
+func (r gormLayouts) Get(clientID uint, format string) (models.OutputLayout, error) {
+	var layout models.OutputLayout
+	err := r.db.Where("client_id = ? AND format = ?", clientID, format).First(&layout).Error
+	return layout, notFound(err)
+}
+
+func (r gormLayouts) Create(layout *models.OutputLayout) error {
+	return r.db.Create(layout).Error
+}
+
+func (r gormLayouts) Save(layout *models.OutputLayout) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "client_id"}, {Name: "format"}},
+		DoUpdates: clause.AssignmentColumns([]string{"definition", "updated_at"}),
+	}).Create(layout).Error
+}
+
+func (r gormLayouts) Delete(clientID uint, format string) error {
+	result := r.db.Where("client_id = ? AND format = ?", clientID, format).Delete(&models.OutputLayout{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type gormSchemas struct {
+	db *gorm.DB
+}
+
+func (r gormSchemas) GetByClient(clientID uint) (models.InputSchema, error) {
+	var schema models.InputSchema
+	err := r.db.Where("client_id = ?", clientID).First(&schema).Error
+	return schema, notFound(err)
+}
+
+func (r gormSchemas) Create(schema *models.InputSchema) error {
+	return r.db.Create(schema).Error
+}
+
+func (r gormSchemas) Save(schema *models.InputSchema) error {
+	return r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "client_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"sample_count", "fields", "updated_at"}),
+	}).Create(schema).Error
+}
+
+type gormRuns struct {
+	db *gorm.DB
+}
+
+func (r gormRuns) Create(run *models.TransformRun) error {
+	return r.db.Create(run).Error
+}
+
+func (r gormRuns) Get(id uint) (models.TransformRun, error) {
+	var run models.TransformRun
+	err := r.db.First(&run, id).Error
+	return run, notFound(err)
+}
+
+func (r gormRuns) Search(clientID uint, filter RunFilter, limit, offset int) ([]models.TransformRun, int64, error) {
+	query := r.db.Model(&models.TransformRun{}).Where("client_id = ?", clientID)
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.InputHash != "" {
+		query = query.Where("input_hash = ?", filter.InputHash)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var runs []models.TransformRun
+	err := query.Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&runs).Error
+	return runs, total, err
+}
+
+type gormJobs struct {
+	db *gorm.DB
+}
+
+func (r gormJobs) Create(job *models.BatchJob) error {
+	return r.db.Create(job).Error
+}
+
+func (r gormJobs) Get(id uint) (models.BatchJob, error) {
+	var job models.BatchJob
+	err := r.db.First(&job, id).Error
+	return job, notFound(err)
+}
+
+func (r gormJobs) Search(clientID uint, status string, limit, offset int) ([]models.BatchJob, int64, error) {
+	query := r.db.Model(&models.BatchJob{}).Where("client_id = ?", clientID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var jobs []models.BatchJob
+	err := query.Order("created_at DESC, id DESC").Limit(limit).Offset(offset).Find(&jobs).Error
+	return jobs, total, err
+}
+
+// jobChunkSize is the size of the chunks job bodies are stored in.
+const jobChunkSize = 1 << 20
+
+func (r gormJobs) WriteBody(id uint, body string) (io.WriteCloser, error) {
+	if err := r.db.Where("job_id = ? AND body = ?", id, body).Delete(&models.BatchJobChunk{}).Error; err != nil {
+		return nil, err
+	}
+	return &jobBodyWriter{db: r.db, jobID: id, body: body}, nil
+}
+
+func (r gormJobs) ReadBody(id uint, body string) io.Reader {
+	return &jobBodyReader{db: r.db, jobID: id, body: body}
+}
+
+func (r gormJobs) Runnable(now time.Time) ([]uint, error) {
+	var ids []uint
+	err := r.db.Model(&models.BatchJob{}).
+		Where("status = ? OR (status = ? AND lease_expires_at < ?)", models.JobStatusQueued, models.JobStatusRunning, now).
+		Order("id").Pluck("id", &ids).Error
+	return ids, err
+}
+
+func (r gormJobs) Claim(id uint, owner string, now, leaseUntil time.Time) (bool, error) {
+	result := r.db.Model(&models.BatchJob{}).
+		Where("id = ? AND (status = ? OR (status = ? AND lease_expires_at < ?))", id, models.JobStatusQueued, models.JobStatusRunning, now).
+		Updates(map[string]interface{}{
+			"status":            models.JobStatusRunning,
+			"lease_owner":       owner,
+			"lease_expires_at":  leaseUntil,
+			"started_at":        now,
+			"processed_records": 0,
+			"failed_records":    0,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r gormJobs) Renew(id uint, owner string, leaseUntil time.Time) error {
+	return r.updateLeased(id, owner, map[string]interface{}{"lease_expires_at": leaseUntil})
+}
+
+func (r gormJobs) Progress(id uint, owner string, progress JobProgress) error {
+	return r.updateLeased(id, owner, map[string]interface{}{
+		"rule_set_version":  progress.RuleSetVersion,
+		"total_records":     progress.TotalRecords,
+		"processed_records": progress.ProcessedRecords,
+		"failed_records":    progress.FailedRecords,
+	})
+}
+
+func (r gormJobs) Finish(id uint, owner, status, message string) error {
+	return r.updateLeased(id, owner, map[string]interface{}{
+		"status":           status,
+		"error":            message,
+		"finished_at":      time.Now().UTC(),
+		"lease_owner":      "",
+		"lease_expires_at": nil,
+	})
+}
+
+// updateLeased updates a running job if owner still holds its lease.
+func (r gormJobs) updateLeased(id uint, owner string, updates map[string]interface{}) error {
+	result := r.db.Model(&models.BatchJob{}).
+		Where("id = ? AND status = ? AND lease_owner = ?", id, models.JobStatusRunning, owner).
+		Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// jobBodyWriter buffers a body and stores every full chunk as it fills up.
+type jobBodyWriter struct {
+	db    *gorm.DB
+	jobID uint
+	body  string
+	seq   int
+	buf   []byte
+}
+
+func (w *jobBodyWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if w.buf == nil {
+			w.buf = make([]byte, 0, jobChunkSize)
+		}
+		n := min(len(p), jobChunkSize-len(w.buf))
+		w.buf = append(w.buf, p[:n]...)
+		p = p[n:]
+		written += n
+		if len(w.buf) == jobChunkSize {
+			if err := w.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+func (w *jobBodyWriter) Close() error {
+	return w.flush()
+}
+
+func (w *jobBodyWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	chunk := models.BatchJobChunk{JobID: w.jobID, Body: w.body, Seq: w.seq, Data: w.buf}
+	if err := w.db.Create(&chunk).Error; err != nil {
+		return err
+	}
+	w.seq++
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// jobBodyReader loads a body one chunk at a time.
+type jobBodyReader struct {
+	db    *gorm.DB
+	jobID uint
+	body  string
+	seq   int
+	buf   []byte
+	done  bool
+}
+
+func (r *jobBodyReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		var chunks []models.BatchJobChunk
+		err := r.db.Where("job_id = ? AND body = ? AND seq = ?", r.jobID, r.body, r.seq).Limit(1).Find(&chunks).Error
+		if err != nil {
+			return 0, err
+		}
+		if len(chunks) == 0 {
+			r.done = true
+			continue
+		}
+		r.buf = chunks[0].Data
+		r.seq++
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+type gormTemplates struct {
+	db *gorm.DB
+}
+
+func (r gormTemplates) withRules() *gorm.DB {
+	return r.db.Preload("Rules", func(db *gorm.DB) *gorm.DB { return db.Order("id") })
+}
+
+func (r gormTemplates) List() ([]models.RuleTemplate, error) {
+	var templates []models.RuleTemplate
+	err := r.withRules().Order("id").Find(&templates).Error
+	return templates, err
+}
+
+func (r gormTemplates) Get(id uint) (models.RuleTemplate, error) {
+	var template models.RuleTemplate
+	err := r.withRules().First(&template, id).Error
+	return template, notFound(err)
+}
+
+func (r gormTemplates) Create(template *models.RuleTemplate) error {
+	return r.db.Create(template).Error
+}
+
+func (r gormTemplates) Update(template *models.RuleTemplate) error {
+	if err := r.db.Omit("Rules").Save(template).Error; err != nil {
+		return err
+	}
+	if err := r.db.Where("template_id = ?", template.ID).Delete(&models.TemplateRule{}).Error; err != nil {
+		return err
+	}
+	for i := range template.Rules {
+		template.Rules[i].ID = 0
+		template.Rules[i].TemplateID = template.ID
+	}
+	if len(template.Rules) == 0 {
+		return nil
+	}
+	return r.db.Create(&template.Rules).Error
+}
+
+func (r gormTemplates) Delete(id uint) error {
+	return r.db.Delete(&models.RuleTemplate{}, id).Error
+}
+
+func (r gormTemplates) ListByClient(clientID uint) ([]models.RuleTemplate, error) {
+	var templates []models.RuleTemplate
+	err := r.withRules().
+		Joins("JOIN client_templates ON client_templates.template_id = rule_templates.id").
+		Joins("JOIN clients ON clients.id = client_templates.client_id AND clients.deleted_at IS NULL").
+		Where("client_templates.client_id = ?", clientID).
+		Order("client_templates.position").
+		Find(&templates).Error
+	return templates, err
+}
+
+func (r gormTemplates) SetForClient(clientID uint, templateIDs []uint) error {
+	if err := r.db.Where("client_id = ?", clientID).Delete(&models.ClientTemplate{}).Error; err != nil {
+		return err
+	}
+	for i, templateID := range templateIDs {
+		link := models.ClientTemplate{ClientID: clientID, TemplateID: templateID, Position: i}
+		if err := r.db.Create(&link).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r gormTemplates) ClientIDs(templateID uint) ([]uint, error) {
+	var ids []uint
+	err := r.db.Model(&models.ClientTemplate{}).Where("template_id = ?", templateID).Order("client_id").Pluck("client_id", &ids).Error
+	return ids, err
+}
+
+// orderBy returns the ORDER BY clause for by, falling back to ID when its
+// field is not one of fields. Fields are column names.
+func orderBy(by Sort, fields []string) string {
+	column := "id"
+	for _, field := range fields {
+		if field == by.Field {
+			column = field
+		}
+	}
+	direction := ""
+	if by.Desc {
+		direction = " DESC"
+	}
+	if column == "id" {
+		return "id" + direction
+	}
+	return column + direction + ", id" + direction
+}
+
+// containsPattern returns a LIKE pattern, to be compared with a lowercased
+// column, matching values that contain s.
+func containsPattern(s string) string {
+	return "%" + escapeLike(strings.ToLower(s)) + "%"
+}
+
+// escapeLike escapes the LIKE wildcards in s, for patterns using
+// ESCAPE '\'.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+func dottedPath(path models.JSONStringList) string {
+	return strings.Join(path, ".")
+}
@@ -0,0 +1,453 @@
+package repository
+
+import (
+	"bytes"
+	"data_mapping/config"
+	"data_mapping/database"
+	"data_mapping/database/migrations"
+	"data_mapping/models"
+	"encoding/json"
+	"errors"
+	"io"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestStore returns a Store over a migrated SQLite database in a
+// temporary directory.
+func newTestStore(t *testing.T) Store {
+	t.Helper()
+	db, err := database.Connect(config.Config{DBDriver: "sqlite", SQLitePath: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db = db.Session(&gorm.Session{Logger: logger.Discard})
+	if _, err := migrations.Up(db); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return New(db)
+}
+
+func createClient(t *testing.T, store Store, name, status string) models.Client {
+	t.Helper()
+	client := models.Client{Name: name, Status: status}
+	if err := store.Clients().Create(&client); err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func createRule(t *testing.T, store Store, clientID uint, source, destination, transformType string, required bool) models.MappingRule {
+	t.Helper()
+	rule := models.MappingRule{
+		ClientID:        clientID,
+		SourcePath:      models.JSONStringList{source},
+		DestinationPath: models.JSONStringList{destination},
+		TransformType:   transformType,
+		Required:        required,
+	}
+	if err := store.Mappings().Create(&rule); err != nil {
+		t.Fatal(err)
+	}
+	return rule
+}
+
+func ruleIDs(rules []models.MappingRule) []uint {
+	ids := []uint{}
+	for _, rule := range rules {
+		ids = append(ids, rule.ID)
+	}
+	return ids
+}
+
+func TestClients(t *testing.T) {
+	store := newTestStore(t)
+	clients := store.Clients()
+	acme := createClient(t, store, "Acme Bank", models.ClientStatusActive)
+	createClient(t, store, "Beta 100%", models.ClientStatusDraft)
+	createClient(t, store, "acme_two", models.ClientStatusActive)
+
+	if got, err := clients.GetByName("Acme Bank"); err != nil || got.ID != acme.ID {
+		t.Errorf("GetByName = %+v, %v, want client %d", got, err, acme.ID)
+	}
+	if _, err := clients.Get(999); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a missing client = %v, want ErrNotFound", err)
+	}
+
+	tests := []struct {
+		filter ClientFilter
+		limit  int
+		offset int
+		names  []string
+		total  int64
+	}{
+		{ClientFilter{Name: "ACME"}, 10, 0, []string{"Acme Bank", "acme_two"}, 2},
+		{ClientFilter{Name: "%"}, 10, 0, []string{"Beta 100%"}, 1},
+		{ClientFilter{Name: "e_t"}, 10, 0, []string{"acme_two"}, 1},
+		{ClientFilter{Status: models.ClientStatusActive, Sort: Sort{Field: "name", Desc: true}}, 10, 0, []string{"acme_two", "Acme Bank"}, 2},
+		{ClientFilter{}, 1, 1, []string{"Beta 100%"}, 3},
+	}
+	for _, tt := range tests {
+		got, total, err := clients.Search(tt.filter, tt.limit, tt.offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, client := range got {
+			names = append(names, client.Name)
+		}
+		if !reflect.DeepEqual(names, tt.names) || total != tt.total {
+			t.Errorf("Search(%+v, %d, %d) = %v, %d, want %v, %d", tt.filter, tt.limit, tt.offset, names, total, tt.names, tt.total)
+		}
+	}
+}
+
+func TestClientsTrash(t *testing.T) {
+	store := newTestStore(t)
+	clients := store.Clients()
+	acme := createClient(t, store, "Acme", models.ClientStatusActive)
+	createRule(t, store, acme.ID, "name", "customer_name", "copy", false)
+
+	if err := clients.Delete(acme.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clients.Get(acme.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a deleted client = %v, want ErrNotFound", err)
+	}
+	// A deleted client's name can be used again.
+	createClient(t, store, "Acme", models.ClientStatusActive)
+	if deleted, err := clients.ListDeleted(); err != nil || len(deleted) != 1 || deleted[0].ID != acme.ID {
+		t.Errorf("ListDeleted = %+v, %v, want client %d", deleted, err, acme.ID)
+	}
+
+	if purged, err := clients.Purge(time.Now().Add(-time.Hour)); err != nil || purged != 0 {
+		t.Errorf("Purge before the deletion = %d, %v, want nothing purged", purged, err)
+	}
+	if purged, err := clients.Purge(time.Now().Add(time.Hour)); err != nil || purged != 1 {
+		t.Errorf("Purge = %d, %v, want 1", purged, err)
+	}
+	if _, err := clients.GetDeleted(acme.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetDeleted of a purged client = %v, want ErrNotFound", err)
+	}
+	if rules, err := store.Mappings().ListByClient(acme.ID); err != nil || len(rules) != 0 {
+		t.Errorf("rules of a purged client = %+v, %v, want none", rules, err)
+	}
+}
+
+func TestMappingsSearch(t *testing.T) {
+	store := newTestStore(t)
+	client := createClient(t, store, "Acme", models.ClientStatusActive)
+	other := createClient(t, store, "Other", models.ClientStatusActive)
+	name := createRule(t, store, client.ID, "applicant.name", "customer_name", "copy", true)
+	gender := createRule(t, store, client.ID, "gender", "gender_code", "lookup", false)
+	city := createRule(t, store, client.ID, "address.city", "city", "copy", false)
+	createRule(t, store, other.ID, "name", "name", "copy", false)
+
+	required := true
+	tests := []struct {
+		filter MappingFilter
+		limit  int
+		offset int
+		ids    []uint
+		total  int64
+	}{
+		{MappingFilter{}, 10, 0, []uint{name.ID, gender.ID, city.ID}, 3},
+		{MappingFilter{}, 2, 1, []uint{gender.ID, city.ID}, 3},
+		{MappingFilter{TransformType: "copy"}, 1, 0, []uint{name.ID}, 2},
+		{MappingFilter{Required: &required}, 10, 0, []uint{name.ID}, 1},
+		{MappingFilter{Path: "NAME"}, 10, 0, []uint{name.ID}, 1},
+		{MappingFilter{Path: "city"}, 10, 0, []uint{city.ID}, 1},
+		{MappingFilter{SourcePath: "gender", DestinationPath: "code"}, 10, 0, []uint{gender.ID}, 1},
+		{MappingFilter{Sort: Sort{Field: "destination_path"}}, 10, 0, []uint{city.ID, name.ID, gender.ID}, 3},
+		{MappingFilter{Path: "a", Sort: Sort{Field: "source_path"}}, 1, 1, []uint{name.ID}, 2},
+		{MappingFilter{Sort: Sort{Field: "transform_type", Desc: true}}, 10, 0, []uint{gender.ID, city.ID, name.ID}, 3},
+		{MappingFilter{}, 10, 5, []uint{}, 3},
+	}
+	for _, tt := range tests {
+		got, total, err := store.Mappings().Search(client.ID, tt.filter, tt.limit, tt.offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := ruleIDs(got); !reflect.DeepEqual(ids, tt.ids) || total != tt.total {
+			t.Errorf("Search(%+v, %d, %d) = %v, %d, want %v, %d", tt.filter, tt.limit, tt.offset, ids, total, tt.ids, tt.total)
+		}
+	}
+}
+
+func TestMappingsTrash(t *testing.T) {
+	store := newTestStore(t)
+	mappings := store.Mappings()
+	client := createClient(t, store, "Acme", models.ClientStatusActive)
+	early := createRule(t, store, client.ID, "a", "a", "copy", false)
+	if err := mappings.Delete(early.ID); err != nil {
+		t.Fatal(err)
+	}
+	since := time.Now()
+	rule := createRule(t, store, client.ID, "b", "b", "copy", false)
+	if err := mappings.DeleteByClient(client.ID); err != nil {
+		t.Fatal(err)
+	}
+	if deleted, err := mappings.ListDeleted(); err != nil || len(deleted) != 2 {
+		t.Errorf("ListDeleted = %+v, %v, want both rules", deleted, err)
+	}
+
+	restored, err := mappings.RestoreByClient(client.ID, since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := ruleIDs(restored); !reflect.DeepEqual(ids, []uint{rule.ID}) {
+		t.Errorf("RestoreByClient = %v, want only the rule deleted with the client", ids)
+	}
+	if rules, err := mappings.ListByClient(client.ID); err != nil || !reflect.DeepEqual(ruleIDs(rules), []uint{rule.ID}) {
+		t.Errorf("ListByClient = %v, %v, want rule %d", ruleIDs(rules), err, rule.ID)
+	}
+
+	if err := mappings.Restore(early.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mappings.GetDeleted(early.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetDeleted of a restored rule = %v, want ErrNotFound", err)
+	}
+}
+
+func TestLogs(t *testing.T) {
+	store := newTestStore(t)
+	logs := store.Logs()
+	now := time.Now().UTC()
+	entries := []models.Log{
+		{Timestamp: now.Add(-48 * time.Hour), Method: "GET", Path: "/clients", StatusCode: 200, User: "admin"},
+		{Timestamp: now.Add(-time.Hour), Method: "POST", Path: "/clients/1/transform", StatusCode: 422, User: "admin"},
+		{Timestamp: now, Method: "GET", Path: "/clients_%", StatusCode: 500},
+	}
+	for i := range entries {
+		if err := logs.Create(&entries[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, total, err := logs.List(LogFilter{StatusFrom: 400, StatusTo: 500}, 10, 0)
+	if err != nil || total != 1 || len(got) != 1 || got[0].ID != entries[1].ID {
+		t.Errorf("List of 4xx = %+v, %d, %v, want entry %d", got, total, err, entries[1].ID)
+	}
+	got, total, err = logs.List(LogFilter{PathPrefix: "/clients_"}, 10, 0)
+	if err != nil || total != 1 || len(got) != 1 || got[0].ID != entries[2].ID {
+		t.Errorf("List with a path prefix = %+v, %d, %v, want entry %d", got, total, err, entries[2].ID)
+	}
+	got, total, err = logs.List(LogFilter{User: "admin"}, 1, 0)
+	if err != nil || total != 2 || len(got) != 1 || got[0].ID != entries[1].ID {
+		t.Errorf("List by user = %+v, %d, %v, want the newest of 2 entries", got, total, err)
+	}
+
+	if removed, err := logs.Prune(now.Add(-24*time.Hour), true); err != nil || removed != 1 {
+		t.Errorf("Prune = %d, %v, want 1", removed, err)
+	}
+	if _, total, _ := logs.List(LogFilter{}, 10, 0); total != 2 {
+		t.Errorf("logs after pruning = %d, want 2", total)
+	}
+	var archived int64
+	if err := store.(gormStore).db.Model(&models.ArchivedLog{}).Count(&archived).Error; err != nil || archived != 1 {
+		t.Errorf("archived logs = %d, %v, want 1", archived, err)
+	}
+}
+
+func TestAuditList(t *testing.T) {
+	store := newTestStore(t)
+	audit := store.Audit()
+	clientID := uint(1)
+	now := time.Now().UTC()
+	events := []models.AuditEvent{
+		{Timestamp: now.Add(-time.Minute), Actor: "admin", Entity: "client", EntityID: 1, ClientID: 1, Action: "create"},
+		{Timestamp: now, Actor: "admin", Entity: "mapping_rule", EntityID: 7, ClientID: 1, Action: "update"},
+		{Timestamp: now, Actor: "ops", Entity: "user", EntityID: 2, Action: "create"},
+	}
+	for i := range events {
+		if err := audit.Record(&events[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, total, err := audit.List(AuditFilter{ClientID: &clientID}, 10, 0)
+	if err != nil || total != 2 || len(got) != 2 || got[0].ID != events[1].ID {
+		t.Errorf("List by client = %+v, %d, %v, want the 2 events of client 1, newest first", got, total, err)
+	}
+	noClient := uint(0)
+	if _, total, err := audit.List(AuditFilter{ClientID: &noClient, Action: "create"}, 10, 0); err != nil || total != 1 {
+		t.Errorf("List of events without a client = %d, %v, want 1", total, err)
+	}
+}
+
+func TestLayoutsAndSchemas(t *testing.T) {
+	store := newTestStore(t)
+	client := createClient(t, store, "Acme", models.ClientStatusActive)
+	layouts := store.Layouts()
+
+	for _, root := range []string{"Loan", "Application"} {
+		definition, err := models.NewJSONDocument(models.XMLLayout{RootElement: root})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := layouts.Save(&models.OutputLayout{ClientID: client.ID, Format: "xml", Definition: definition}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	saved, err := layouts.ListByClient(client.ID)
+	if err != nil || len(saved) != 1 {
+		t.Fatalf("ListByClient = %+v, %v, want one layout", saved, err)
+	}
+	var layout models.XMLLayout
+	if err := json.Unmarshal(saved[0].Definition, &layout); err != nil || layout.RootElement != "Application" {
+		t.Errorf("layout = %+v, %v, want the definition replaced", layout, err)
+	}
+	if err := layouts.Delete(client.ID, "fixed-width"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete of a missing layout = %v, want ErrNotFound", err)
+	}
+	if err := layouts.Delete(client.ID, "xml"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := layouts.Get(client.ID, "xml"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a deleted layout = %v, want ErrNotFound", err)
+	}
+
+	schemas := store.Schemas()
+	for count := 1; count <= 2; count++ {
+		if err := schemas.Save(&models.InputSchema{ClientID: client.ID, SampleCount: count, Fields: models.JSONDocument("[]")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if schema, err := schemas.GetByClient(client.ID); err != nil || schema.SampleCount != 2 {
+		t.Errorf("GetByClient = %+v, %v, want the second schema", schema, err)
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	store := newTestStore(t)
+	templates := store.Templates()
+	spec := func(source string) models.TemplateRule {
+		return models.TemplateRule{MappingRuleSpec: models.MappingRuleSpec{
+			SourcePath:      models.JSONStringList{source},
+			DestinationPath: models.JSONStringList{source},
+			TransformType:   "copy",
+		}}
+	}
+	base := models.RuleTemplate{Name: "base", Rules: []models.TemplateRule{spec("a"), spec("b")}}
+	extra := models.RuleTemplate{Name: "extra"}
+	for _, template := range []*models.RuleTemplate{&base, &extra} {
+		if err := templates.Create(template); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	base.Description = "shared"
+	base.Rules = []models.TemplateRule{spec("c")}
+	if err := templates.Update(&base); err != nil {
+		t.Fatal(err)
+	}
+	got, err := templates.Get(base.ID)
+	if err != nil || got.Description != "shared" || len(got.Rules) != 1 || got.Rules[0].SourcePath[0] != "c" {
+		t.Errorf("Get = %+v, %v, want the updated template with its rules replaced", got, err)
+	}
+
+	client := createClient(t, store, "Acme", models.ClientStatusActive)
+	if err := templates.SetForClient(client.ID, []uint{extra.ID, base.ID}); err != nil {
+		t.Fatal(err)
+	}
+	linked, err := templates.ListByClient(client.ID)
+	if err != nil || len(linked) != 2 || linked[0].ID != extra.ID || linked[1].ID != base.ID {
+		t.Errorf("ListByClient = %+v, %v, want extra then base", linked, err)
+	}
+
+	if err := store.Clients().Delete(client.ID); err != nil {
+		t.Fatal(err)
+	}
+	if linked, err := templates.ListByClient(client.ID); err != nil || len(linked) != 0 {
+		t.Errorf("ListByClient of a deleted client = %+v, %v, want none", linked, err)
+	}
+	if ids, err := templates.ClientIDs(base.ID); err != nil || !reflect.DeepEqual(ids, []uint{client.ID}) {
+		t.Errorf("ClientIDs = %v, %v, want the deleted client", ids, err)
+	}
+}
+
+func TestRunsSearch(t *testing.T) {
+	store := newTestStore(t)
+	runs := store.Runs()
+	for _, status := range []string{models.RunStatusSuccess, models.RunStatusFailed, models.RunStatusSuccess} {
+		if err := runs.Create(&models.TransformRun{ClientID: 1, Status: status, InputHash: "abc"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := runs.Create(&models.TransformRun{ClientID: 2, Status: models.RunStatusSuccess}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, total, err := runs.Search(1, RunFilter{Status: models.RunStatusSuccess}, 1, 0)
+	if err != nil || total != 2 || len(got) != 1 || got[0].ID != 3 {
+		t.Errorf("Search = %+v, %d, %v, want the newest of 2 successful runs", got, total, err)
+	}
+	if _, err := runs.Get(99); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a missing run = %v, want ErrNotFound", err)
+	}
+}
+
+func TestJobBodies(t *testing.T) {
+	store := newTestStore(t)
+	jobs := store.Jobs()
+	job := models.BatchJob{ClientID: 1, Status: models.JobStatusQueued, InputFormat: "ndjson", OutputFormat: models.JobOutputNDJSON}
+	if err := jobs.Create(&job); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(data []byte) {
+		t.Helper()
+		w, err := jobs.WriteBody(job.ID, models.JobBodyOutput)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Bodies larger than a chunk are split and read back in order.
+	large := bytes.Repeat([]byte("0123456789abcdef"), jobChunkSize/16*2+100)
+	write(large)
+	got, err := io.ReadAll(jobs.ReadBody(job.ID, models.JobBodyOutput))
+	if err != nil || !bytes.Equal(got, large) {
+		t.Errorf("ReadBody returned %d bytes, %v, want the %d bytes written", len(got), err, len(large))
+	}
+
+	write([]byte("short"))
+	if got, err := io.ReadAll(jobs.ReadBody(job.ID, models.JobBodyOutput)); err != nil || string(got) != "short" {
+		t.Errorf("ReadBody after rewriting = %q, %v, want the body replaced", got, err)
+	}
+	if got, err := io.ReadAll(jobs.ReadBody(job.ID, models.JobBodyErrors)); err != nil || len(got) != 0 {
+		t.Errorf("ReadBody of an unwritten body = %q, %v, want it empty", got, err)
+	}
+}
+
+func TestTransactionRollsBack(t *testing.T) {
+	store := newTestStore(t)
+	failure := errors.New("stop")
+	err := store.Transaction(func(tx Store) error {
+		createClient(t, tx, "Acme", models.ClientStatusActive)
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("Transaction = %v, want the error of fn", err)
+	}
+	if _, err := store.Clients().GetByName("Acme"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("client created in a rolled back transaction: %v, want ErrNotFound", err)
+	}
+}
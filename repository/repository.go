@@ -0,0 +1,263 @@
+package repository
+
+import (
+	"data_mapping/models"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrNotFound is returned when a requested record does not exist.
+var ErrNotFound = errors.New("record not found")
+
+// ErrLeaseLost is returned when a runner updates a batch job it no longer
+// holds the lease of.
+var ErrLeaseLost = errors.New("batch job lease lost")
+
+// Store gives access to the repositories of one database.
+type Store interface {
+	Clients() ClientRepository
+	Mappings() MappingRepository
+	Logs() LogRepository
+	Audit() AuditRepository
+	Users() UserRepository
+	Layouts() LayoutRepository
+	Schemas() SchemaRepository
+	Templates() TemplateRepository
+	Runs() RunRepository
+	Jobs() JobRepository
+
+	// Transaction runs fn with a Store whose repositories share a single
+	// transaction, committed when fn returns nil and rolled back otherwise.
+	Transaction(fn func(tx Store) error) error
+}
+
+// Sort orders a list by one of the fields the list supports, descending when
+// Desc is set. Ties are broken by ID.
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// ClientSortFields are the fields clients can be sorted by.
+var ClientSortFields = []string{"id", "name", "status", "created_at", "updated_at"}
+
+// ClientFilter selects clients. Zero fields do not filter.
+type ClientFilter struct {
+	// Name matches names containing it, ignoring case.
+	Name        string
+	Status      string
+	PartnerCode string
+	Sort        Sort
+}
+
+// MappingSortFields are the fields mapping rules can be sorted by. Paths sort
+// by their dotted form.
+var MappingSortFields = []string{"id", "source_path", "destination_path", "transform_type", "required", "created_at", "updated_at"}
+
+// MappingFilter selects mapping rules. Zero fields do not filter. Paths match
+// in their dotted form, ignoring case.
+type MappingFilter struct {
+	// Path matches rules whose source or destination path contains it.
+	Path            string
+	SourcePath      string
+	DestinationPath string
+	TransformType   string
+	Required        *bool
+	// Sort defaults to ID, the order rules are applied in.
+	Sort Sort
+}
+
+// ClientRepository stores clients. Delete moves a client to the trash; the
+// other methods ignore clients in the trash unless their name says otherwise.
+type ClientRepository interface {
+	List() ([]models.Client, error)
+	// Search returns a page of matching clients and the number of clients
+	// matching filter.
+	Search(filter ClientFilter, limit, offset int) ([]models.Client, int64, error)
+	Get(id uint) (models.Client, error)
+	GetByName(name string) (models.Client, error)
+	Create(client *models.Client) error
+	Update(client *models.Client) error
+	Delete(id uint) error
+
+	// ListDeleted returns the clients in the trash, most recently deleted
+	// first.
+	ListDeleted() ([]models.Client, error)
+	GetDeleted(id uint) (models.Client, error)
+	Restore(id uint) error
+	// Purge permanently removes the clients deleted before cutoff together
+	// with their mapping rules and template links.
+	Purge(cutoff time.Time) (int64, error)
+}
+
+// MappingRepository stores mapping rules. Rules are listed in the order they
+// were created, which is the order they are applied in. Like clients, deleted
+// rules stay in the trash until purged.
+type MappingRepository interface {
+	ListByClient(clientID uint) ([]models.MappingRule, error)
+	// Search returns a page of a client's matching rules and the number of
+	// its rules matching filter.
+	Search(clientID uint, filter MappingFilter, limit, offset int) ([]models.MappingRule, int64, error)
+	Get(id uint) (models.MappingRule, error)
+	Create(rule *models.MappingRule) error
+	Update(rule *models.MappingRule) error
+	Delete(id uint) error
+	DeleteByClient(clientID uint) error
+
+	// ListDeleted returns the rules in the trash whose client is not,
+	// most recently deleted first.
+	ListDeleted() ([]models.MappingRule, error)
+	GetDeleted(id uint) (models.MappingRule, error)
+	Restore(id uint) error
+	// RestoreByClient restores the rules of a client deleted at or after
+	// since, which are the rules deleted together with the client.
+	RestoreByClient(clientID uint, since time.Time) ([]models.MappingRule, error)
+	// Purge permanently removes the rules deleted before cutoff.
+	Purge(cutoff time.Time) (int64, error)
+}
+
+// LogFilter selects request logs. Zero fields do not filter.
+type LogFilter struct {
+	// StatusFrom and StatusTo bound the status code; StatusTo is exclusive.
+	StatusFrom int
+	StatusTo   int
+	PathPrefix string
+	Method     string
+	User       string
+	From       time.Time
+	To         time.Time
+}
+
+type LogRepository interface {
+	Create(entry *models.Log) error
+	// List returns a page of matching logs, newest first, and the number of
+	// logs matching filter.
+	List(filter LogFilter, limit, offset int) ([]models.Log, int64, error)
+	// Prune removes logs older than cutoff, copying them to archived_logs
+	// first when archive is true.
+	Prune(cutoff time.Time, archive bool) (int64, error)
+}
+
+// AuditFilter selects audit events. Zero fields do not filter; ClientID is a
+// pointer because events that belong to no client have client ID 0.
+type AuditFilter struct {
+	ClientID *uint
+	Actor    string
+	Entity   string
+	EntityID uint
+	Action   string
+	From     time.Time
+	To       time.Time
+}
+
+type AuditRepository interface {
+	Record(event *models.AuditEvent) error
+	// List returns a page of matching events, newest first, and the number
+	// of events matching filter.
+	List(filter AuditFilter, limit, offset int) ([]models.AuditEvent, int64, error)
+}
+
+type UserRepository interface {
+	Count() (int64, error)
+	GetByUsername(username string) (models.User, error)
+	Create(user *models.User) error
+	Update(user *models.User) error
+}
+
+type LayoutRepository interface {
+	ListByClient(clientID uint) ([]models.OutputLayout, error)
+	Get(clientID uint, format string) (models.OutputLayout, error)
+	Create(layout *models.OutputLayout) error
+	// Save creates the layout or replaces the definition of the client's
+	// layout for the same format.
+	Save(layout *models.OutputLayout) error
+	Delete(clientID uint, format string) error
+}
+
+type SchemaRepository interface {
+	GetByClient(clientID uint) (models.InputSchema, error)
+	Create(schema *models.InputSchema) error
+	// Save creates the schema or replaces the client's schema.
+	Save(schema *models.InputSchema) error
+}
+
+// RunFilter selects transform runs. Zero fields do not filter.
+type RunFilter struct {
+	Status    string
+	InputHash string
+}
+
+type RunRepository interface {
+	Create(run *models.TransformRun) error
+	Get(id uint) (models.TransformRun, error)
+	// Search returns a page of a client's matching runs, newest first, and
+	// the number of its runs matching filter.
+	Search(clientID uint, filter RunFilter, limit, offset int) ([]models.TransformRun, int64, error)
+}
+
+// JobProgress is how far a running batch job got.
+type JobProgress struct {
+	RuleSetVersion   string
+	TotalRecords     int
+	ProcessedRecords int
+	FailedRecords    int
+}
+
+// JobRepository stores batch jobs and their bodies, the upload, output and
+// error log named by models.JobBody*.
+//
+// A runner claims a job under a lease it renews while working on it. Claim,
+// Renew, Progress and Finish take the runner's owner name, and the last
+// three return ErrLeaseLost once another runner has claimed the job after
+// the lease expired.
+type JobRepository interface {
+	Create(job *models.BatchJob) error
+	Get(id uint) (models.BatchJob, error)
+	// Search returns a page of a client's jobs, newest first, and the
+	// number of its jobs with status, or of all its jobs when status is
+	// empty.
+	Search(clientID uint, status string, limit, offset int) ([]models.BatchJob, int64, error)
+
+	// WriteBody returns a writer replacing a body of a job. The body is
+	// complete once the writer is closed.
+	WriteBody(id uint, body string) (io.WriteCloser, error)
+	// ReadBody returns a reader over a body of a job, which is empty when
+	// nothing was written.
+	ReadBody(id uint, body string) io.Reader
+
+	// Runnable returns the IDs of queued jobs and of running jobs whose
+	// lease expired before now, oldest first.
+	Runnable(now time.Time) ([]uint, error)
+	// Claim marks a runnable job as running under owner's lease until
+	// leaseUntil and resets its progress. It reports false if the job is
+	// not runnable.
+	Claim(id uint, owner string, now, leaseUntil time.Time) (bool, error)
+	Renew(id uint, owner string, leaseUntil time.Time) error
+	Progress(id uint, owner string, progress JobProgress) error
+	// Finish ends a running job with status and an error message, which is
+	// empty unless the job failed, and releases its lease.
+	Finish(id uint, owner, status, message string) error
+}
+
+// TemplateRepository stores rule templates and the templates each client
+// extends. Templates are returned with their rules, in ID order.
+type TemplateRepository interface {
+	List() ([]models.RuleTemplate, error)
+	Get(id uint) (models.RuleTemplate, error)
+	// Create saves a template together with its rules.
+	Create(template *models.RuleTemplate) error
+	// Update saves a template's name and description, and replaces its
+	// rules with template.Rules.
+	Update(template *models.RuleTemplate) error
+	Delete(id uint) error
+
+	// ListByClient returns the templates clientID extends, lowest
+	// precedence first, or none while the client is in the trash.
+	ListByClient(clientID uint) ([]models.RuleTemplate, error)
+	// SetForClient replaces the templates clientID extends.
+	SetForClient(clientID uint, templateIDs []uint) error
+	// ClientIDs returns the clients extending a template, including clients
+	// in the trash.
+	ClientIDs(templateID uint) ([]uint, error)
+}
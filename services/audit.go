@@ -0,0 +1,41 @@
+package services
+
+import (
+	"data_mapping/models"
+	"data_mapping/repository"
+	"time"
+)
+
+// Actor identifies who makes a change. Handlers take it from the
+// authenticated request; the admin commands use the operating system user.
+type Actor struct {
+	User      string
+	RequestID string
+}
+
+// RecordAudit writes an audit event through the repository of the
+// transaction making the change, so that it commits or rolls back together
+// with the change it describes.
+func RecordAudit(audit repository.AuditRepository, actor Actor, clientID uint, entity string, entityID uint, action string, before, after interface{}) error {
+	beforeDoc, err := models.NewJSONDocument(before)
+	if err != nil {
+		return err
+	}
+	afterDoc, err := models.NewJSONDocument(after)
+	if err != nil {
+		return err
+	}
+
+	event := models.AuditEvent{
+		Timestamp: time.Now().UTC(),
+		Actor:     actor.User,
+		ClientID:  clientID,
+		Entity:    entity,
+		EntityID:  entityID,
+		Action:    action,
+		Before:    beforeDoc,
+		After:     afterDoc,
+		RequestID: actor.RequestID,
+	}
+	return audit.Record(&event)
+}
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"data_mapping/models"
+	"data_mapping/repository"
+	"data_mapping/utils"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrClientSuspended is returned when transforming data for a suspended
+// client.
+var ErrClientSuspended = errors.New("client is suspended")
+
+// InputError reports input rejected by validation.
+type InputError struct {
+	Err error
+}
+
+func (e *InputError) Error() string { return e.Err.Error() }
+func (e *InputError) Unwrap() error { return e.Err }
+
+// CreateClient validates req and creates the client.
+func CreateClient(store repository.Store, actor Actor, req models.CreateClientRequest) (models.Client, error) {
+	if err := utils.ValidateStruct(req); err != nil {
+		return models.Client{}, &InputError{Err: err}
+	}
+	client := models.Client{
+		Name:        req.Name,
+		Status:      req.Status,
+		Contact:     req.Contact,
+		PartnerCode: req.PartnerCode,
+		Tags:        req.Tags,
+		Settings:    req.Settings,
+	}
+	if client.Status == "" {
+		client.Status = models.ClientStatusActive
+	}
+	if err := validateClient(&client); err != nil {
+		return models.Client{}, err
+	}
+	err := store.Transaction(func(tx repository.Store) error {
+		if err := tx.Clients().Create(&client); err != nil {
+			return err
+		}
+		return RecordAudit(tx.Audit(), actor, client.ID, models.AuditEntityClient, client.ID, models.AuditActionCreate, nil, client)
+	})
+	return client, err
+}
+
+// DeleteClient moves a client and its mapping rules to the trash, in one
+// transaction. The client keeps its template links, so RestoreClient brings
+// it back as it was. It returns repository.ErrNotFound when there is no such
+// client.
+func DeleteClient(store repository.Store, actor Actor, id uint) error {
+	return store.Transaction(func(tx repository.Store) error {
+		client, err := tx.Clients().Get(id)
+		if err != nil {
+			return err
+		}
+		rules, err := tx.Mappings().ListByClient(client.ID)
+		if err != nil {
+			return err
+		}
+		// The client goes first: RestoreClient restores the rules deleted
+		// at or after the client.
+		if err := tx.Clients().Delete(client.ID); err != nil {
+			return err
+		}
+		if err := tx.Mappings().DeleteByClient(client.ID); err != nil {
+			return err
+		}
+		before := map[string]interface{}{"client": client, "mapping_rules": rules}
+		return RecordAudit(tx.Audit(), actor, client.ID, models.AuditEntityClient, client.ID, models.AuditActionDelete, before, nil)
+	})
+}
+
+// UpdateClient changes the fields req sets. It returns repository.ErrNotFound
+// when there is no such client, and an InputError when the new name belongs
+// to another client.
+func UpdateClient(store repository.Store, actor Actor, id uint, req models.UpdateClientRequest) (models.Client, error) {
+	var client models.Client
+	err := store.Transaction(func(tx repository.Store) error {
+		before, err := tx.Clients().Get(id)
+		if err != nil {
+			return err
+		}
+		client = before
+		if req.Name != nil {
+			client.Name = *req.Name
+		}
+		if req.Status != nil {
+			client.Status = *req.Status
+		}
+		if req.Contact != nil {
+			client.Contact = *req.Contact
+		}
+		if req.PartnerCode != nil {
+			client.PartnerCode = *req.PartnerCode
+		}
+		if req.Tags != nil {
+			client.Tags = *req.Tags
+		}
+		if req.Settings != nil {
+			client.Settings = *req.Settings
+		}
+		if err := validateClient(&client); err != nil {
+			return err
+		}
+		if client.Name != before.Name {
+			other, err := tx.Clients().GetByName(client.Name)
+			if err == nil && other.ID != client.ID {
+				return &InputError{Err: fmt.Errorf("client name %q is taken", client.Name)}
+			}
+			if err != nil && !errors.Is(err, repository.ErrNotFound) {
+				return err
+			}
+		}
+		if err := tx.Clients().Update(&client); err != nil {
+			return err
+		}
+		return RecordAudit(tx.Audit(), actor, client.ID, models.AuditEntityClient, client.ID, models.AuditActionUpdate, before, client)
+	})
+	return client, err
+}
+
+// validateClient checks a client before it is saved, storing empty lists
+// rather than null.
+func validateClient(client *models.Client) error {
+	if client.Tags == nil {
+		client.Tags = models.JSONStringList{}
+	}
+	if client.Settings.DateLayouts == nil {
+		client.Settings.DateLayouts = models.JSONStringList{}
+	}
+	if err := utils.ValidateStruct(client); err != nil {
+		return &InputError{Err: err}
+	}
+	return nil
+}
+
+// TransformOptions returns the options a client's input is transformed with.
+// It returns ErrClientSuspended for a suspended client.
+func TransformOptions(client models.Client) (utils.TransformOptions, error) {
+	if client.Status == models.ClientStatusSuspended {
+		return utils.TransformOptions{}, ErrClientSuspended
+	}
+	opts := utils.TransformOptions{
+		DateLayouts: client.Settings.DateLayouts,
+		NullPolicy:  client.Settings.NullPolicy,
+		Strict:      client.Settings.StrictMode,
+	}
+	if client.Settings.Timezone != "" {
+		location, err := time.LoadLocation(client.Settings.Timezone)
+		if err != nil {
+			return utils.TransformOptions{}, err
+		}
+		opts.Location = location
+	}
+	return opts, nil
+}
+
+// ClientTransformOptions loads a client and returns the options its input is
+// transformed with, as TransformOptions does.
+func ClientTransformOptions(store repository.Store, clientID uint) (models.Client, utils.TransformOptions, error) {
+	client, err := store.Clients().Get(clientID)
+	if err != nil {
+		return models.Client{}, utils.TransformOptions{}, err
+	}
+	opts, err := TransformOptions(client)
+	return client, opts, err
+}
@@ -0,0 +1,251 @@
+package services
+
+import (
+	"data_mapping/models"
+	"data_mapping/repository"
+	"data_mapping/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	RewriteSource      = "source"
+	RewriteDestination = "destination"
+)
+
+// CloneResult describes a client created by CloneClient.
+type CloneResult struct {
+	Client         models.Client    `json:"client"`
+	Rules          int              `json:"rules"`
+	Layouts        int              `json:"layouts"`
+	Templates      int              `json:"templates"`
+	Schema         bool             `json:"schema"`
+	RewrittenRules int              `json:"rewritten_rules"`
+	Conflicts      []ConflictReport `json:"conflicts"`
+}
+
+// CloneClient creates an active client named req.Name with a copy of the
+// metadata and settings, the mapping rules, lookup tables included, the
+// output layouts, the input schema and the template links of the client
+// sourceID, in one transaction.
+//
+// req.PathRewrites change path prefixes while copying: source rewrites apply
+// to rule source paths and the input schema, destination rewrites to rule
+// destination paths and the layouts. The copied rules are validated like any
+// other change; a rewrite that makes rules collide fails with
+// ErrRuleConflicts.
+func CloneClient(store repository.Store, actor Actor, sourceID uint, req models.CloneClientRequest) (CloneResult, error) {
+	if err := utils.ValidateStruct(req); err != nil {
+		return CloneResult{}, &InputError{Err: err}
+	}
+	result := CloneResult{
+		Client:    models.Client{Name: req.Name},
+		Conflicts: []ConflictReport{},
+	}
+	err := store.Transaction(func(tx repository.Store) error {
+		source, err := tx.Clients().Get(sourceID)
+		if err != nil {
+			return err
+		}
+		rules, err := tx.Mappings().ListByClient(source.ID)
+		if err != nil {
+			return err
+		}
+		templates, err := tx.Templates().ListByClient(source.ID)
+		if err != nil {
+			return err
+		}
+		layouts, err := tx.Layouts().ListByClient(source.ID)
+		if err != nil {
+			return err
+		}
+		schema, err := tx.Schemas().GetByClient(source.ID)
+		hasSchema := err == nil
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+
+		client := &result.Client
+		client.Status = models.ClientStatusActive
+		client.Contact = source.Contact
+		client.PartnerCode = source.PartnerCode
+		client.Tags = append(models.JSONStringList{}, source.Tags...)
+		client.Settings = source.Settings
+		client.Settings.DateLayouts = append(models.JSONStringList{}, source.Settings.DateLayouts...)
+		if err := tx.Clients().Create(client); err != nil {
+			return err
+		}
+		after := map[string]interface{}{"client": client, "cloned_from": source.ID, "path_rewrites": req.PathRewrites}
+		if err := RecordAudit(tx.Audit(), actor, client.ID, models.AuditEntityClient, client.ID, models.AuditActionCreate, nil, after); err != nil {
+			return err
+		}
+
+		plan := utils.RulePlan{Add: make([]models.MappingRule, 0, len(rules))}
+		rewritten := make([]bool, 0, len(rules))
+		for _, rule := range rules {
+			copied := models.NewMappingRuleSpec(rule).Rule(client.ID)
+			var sourceChanged, destinationChanged bool
+			copied.SourcePath, sourceChanged = rewritePath(copied.SourcePath, RewriteSource, req.PathRewrites)
+			copied.DestinationPath, destinationChanged = rewritePath(copied.DestinationPath, RewriteDestination, req.PathRewrites)
+			if copied.LookupTable != nil {
+				table := make(models.JSONStringMap, len(copied.LookupTable))
+				for key, value := range copied.LookupTable {
+					table[key] = value
+				}
+				copied.LookupTable = table
+			}
+			plan.Add = append(plan.Add, copied)
+			rewritten = append(rewritten, sourceChanged || destinationChanged)
+			if sourceChanged || destinationChanged {
+				result.RewrittenRules++
+			}
+		}
+		if result.RewrittenRules > 0 {
+			if err := ValidateRules(plan.Add); err != nil {
+				return err
+			}
+			var blocking bool
+			result.Conflicts, blocking = effectiveConflicts(client.ID, templates, plan.Add, func(rule ResolvedRule) bool {
+				return rule.clientIndex >= 0 && rewritten[rule.clientIndex]
+			})
+			if blocking {
+				return ErrRuleConflicts
+			}
+		}
+		if err := ApplyRulePlan(tx, actor, &plan); err != nil {
+			return fmt.Errorf("copying mapping rules: %w", err)
+		}
+		result.Rules = len(plan.Add)
+
+		if err := tx.Templates().SetForClient(client.ID, templateIDsOf(templates)); err != nil {
+			return fmt.Errorf("copying template links: %w", err)
+		}
+		result.Templates = len(templates)
+
+		for _, layout := range layouts {
+			definition, err := rewriteLayout(layout, req.PathRewrites)
+			if err != nil {
+				return fmt.Errorf("copying %s layout: %w", layout.Format, err)
+			}
+			copied := models.OutputLayout{ClientID: client.ID, Format: layout.Format, Definition: definition}
+			if err := tx.Layouts().Create(&copied); err != nil {
+				return err
+			}
+			result.Layouts++
+		}
+
+		if hasSchema {
+			fields, err := rewriteSchemaFields(schema.Fields, req.PathRewrites)
+			if err != nil {
+				return fmt.Errorf("copying input schema: %w", err)
+			}
+			copied := models.InputSchema{ClientID: client.ID, SampleCount: schema.SampleCount, Fields: fields}
+			if err := tx.Schemas().Create(&copied); err != nil {
+				return err
+			}
+			result.Schema = true
+		}
+		return nil
+	})
+	return result, err
+}
+
+// rewritePath applies the first rewrite for target whose prefix path starts
+// with. It always returns a new slice and reports whether a rewrite applied.
+func rewritePath(path models.JSONStringList, target string, rewrites []models.PathRewrite) (models.JSONStringList, bool) {
+	for _, rewrite := range rewrites {
+		if rewrite.Target != target || !hasPathPrefix(path, rewrite.From) {
+			continue
+		}
+		result := make(models.JSONStringList, 0, len(rewrite.To)+len(path)-len(rewrite.From))
+		result = append(result, rewrite.To...)
+		result = append(result, path[len(rewrite.From):]...)
+		return result, true
+	}
+	return append(models.JSONStringList{}, path...), false
+}
+
+func hasPathPrefix(path, prefix models.JSONStringList) bool {
+	if len(prefix) == 0 || len(prefix) > len(path) {
+		return false
+	}
+	for i := range prefix {
+		if path[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// rewriteDotted rewrites a destination path written with ".", as layouts
+// name them.
+func rewriteDotted(name string, rewrites []models.PathRewrite) string {
+	path, changed := rewritePath(strings.Split(name, "."), RewriteDestination, rewrites)
+	if !changed {
+		return name
+	}
+	return path.Dotted()
+}
+
+// rewriteLayout returns a copy of the layout definition with the destination
+// paths it names rewritten: the attributes of an XML layout and the field
+// names of a fixed-width layout. The rest of the definition is kept as
+// stored.
+func rewriteLayout(layout models.OutputLayout, rewrites []models.PathRewrite) (models.JSONDocument, error) {
+	definition := append(models.JSONDocument{}, layout.Definition...)
+	if !hasTarget(rewrites, RewriteDestination) {
+		return definition, nil
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(definition, &decoded); err != nil {
+		return nil, err
+	}
+	switch layout.Format {
+	case models.LayoutFormatXML:
+		attributes, _ := decoded["attributes"].([]interface{})
+		for i, attribute := range attributes {
+			if name, ok := attribute.(string); ok {
+				attributes[i] = rewriteDotted(name, rewrites)
+			}
+		}
+	case models.LayoutFormatFixedWidth:
+		fields, _ := decoded["fields"].([]interface{})
+		for _, field := range fields {
+			if field, ok := field.(map[string]interface{}); ok {
+				if name, ok := field["name"].(string); ok {
+					field["name"] = rewriteDotted(name, rewrites)
+				}
+			}
+		}
+	default:
+		return definition, nil
+	}
+	return models.NewJSONDocument(decoded)
+}
+
+// rewriteSchemaFields returns a copy of an input schema's fields with their
+// paths rewritten by the source rewrites.
+func rewriteSchemaFields(fields models.JSONDocument, rewrites []models.PathRewrite) (models.JSONDocument, error) {
+	if !hasTarget(rewrites, RewriteSource) {
+		return append(models.JSONDocument{}, fields...), nil
+	}
+	var decoded []models.SchemaField
+	if err := json.Unmarshal(fields, &decoded); err != nil {
+		return nil, err
+	}
+	for i := range decoded {
+		decoded[i].Path, _ = rewritePath(decoded[i].Path, RewriteSource, rewrites)
+	}
+	return models.NewJSONDocument(decoded)
+}
+
+func hasTarget(rewrites []models.PathRewrite, target string) bool {
+	for _, rewrite := range rewrites {
+		if rewrite.Target == target {
+			return true
+		}
+	}
+	return false
+}
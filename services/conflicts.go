@@ -0,0 +1,57 @@
+package services
+
+import (
+	"data_mapping/models"
+	"data_mapping/utils"
+	"errors"
+)
+
+// ErrRuleConflicts rolls back a rule change that introduces a conflict with
+// error severity.
+var ErrRuleConflicts = errors.New("mapping rules conflict")
+
+type ConflictRule struct {
+	ID              uint   `json:"id,omitempty"`
+	SourcePath      string `json:"source_path"`
+	DestinationPath string `json:"destination_path"`
+	MergeStrategy   string `json:"merge_strategy"`
+}
+
+// ConflictReport is a utils.RuleConflict with its rule indexes resolved to
+// the rules themselves.
+type ConflictReport struct {
+	Type     string         `json:"type"`
+	Severity string         `json:"severity"`
+	Path     string         `json:"path"`
+	Message  string         `json:"message"`
+	Rules    []ConflictRule `json:"rules"`
+}
+
+// AnalyzeConflicts reports the conflicts in rules. blocking is set when a
+// conflict with error severity involves a rule marked as changed, so that
+// conflicts already stored do not block unrelated edits.
+func AnalyzeConflicts(rules []models.MappingRule, changed []bool) (reports []ConflictReport, blocking bool) {
+	reports = []ConflictReport{}
+	for _, conflict := range utils.AnalyzeRuleConflicts(rules) {
+		report := ConflictReport{
+			Type:     conflict.Type,
+			Severity: conflict.Severity,
+			Path:     conflict.Path,
+			Message:  conflict.Message,
+		}
+		for _, i := range conflict.Rules {
+			rule := rules[i]
+			report.Rules = append(report.Rules, ConflictRule{
+				ID:              rule.ID,
+				SourcePath:      rule.SourcePath.Dotted(),
+				DestinationPath: rule.DestinationPath.Dotted(),
+				MergeStrategy:   rule.Strategy(),
+			})
+			if changed[i] && conflict.Severity == utils.SeverityError {
+				blocking = true
+			}
+		}
+		reports = append(reports, report)
+	}
+	return reports, blocking
+}
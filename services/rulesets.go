@@ -0,0 +1,232 @@
+package services
+
+import (
+	"bytes"
+	"data_mapping/models"
+	"data_mapping/repository"
+	"data_mapping/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	RuleSetFormatJSON = "json"
+	RuleSetFormatYAML = "yaml"
+)
+
+// ruleSetDocument is the body of an export, and one of the accepted import
+// bodies. Imports may also send the rules as a bare array.
+type ruleSetDocument struct {
+	Client  string                   `json:"client,omitempty" yaml:"client,omitempty"`
+	Version string                   `json:"version,omitempty" yaml:"version,omitempty"`
+	Rules   []models.MappingRuleSpec `json:"rules" yaml:"rules"`
+}
+
+// ExportedRule mirrors models.MappingRuleSpec with paths that can be written
+// in either notation.
+type ExportedRule struct {
+	SourcePath      interface{}       `json:"source_path" yaml:"source_path"`
+	DestinationPath interface{}       `json:"destination_path" yaml:"destination_path"`
+	TransformType   string            `json:"transform_type" yaml:"transform_type"`
+	TransformLogic  string            `json:"transform_logic,omitempty" yaml:"transform_logic,omitempty"`
+	Required        bool              `json:"required" yaml:"required"`
+	DefaultValue    string            `json:"default_value,omitempty" yaml:"default_value,omitempty"`
+	LookupTable     map[string]string `json:"lookup_table,omitempty" yaml:"lookup_table,omitempty"`
+	InverseLogic    string            `json:"inverse_logic,omitempty" yaml:"inverse_logic,omitempty"`
+	MergeStrategy   string            `json:"merge_strategy,omitempty" yaml:"merge_strategy,omitempty"`
+}
+
+type ExportedRuleSet struct {
+	Client  string         `json:"client" yaml:"client"`
+	Version string         `json:"version" yaml:"version"`
+	Rules   []ExportedRule `json:"rules" yaml:"rules"`
+}
+
+// ExportRuleSet returns the portable form of a client's rules. With dotted
+// set, paths are written as dotted strings where that round trips.
+func ExportRuleSet(client models.Client, rules []models.MappingRule, dotted bool) ExportedRuleSet {
+	export := ExportedRuleSet{
+		Client:  client.Name,
+		Version: utils.RuleSetVersion(rules),
+		Rules:   make([]ExportedRule, 0, len(rules)),
+	}
+	for _, rule := range rules {
+		export.Rules = append(export.Rules, ExportedRule{
+			SourcePath:      exportPath(rule.SourcePath, dotted),
+			DestinationPath: exportPath(rule.DestinationPath, dotted),
+			TransformType:   rule.TransformType,
+			TransformLogic:  rule.TransformLogic,
+			Required:        rule.Required,
+			DefaultValue:    rule.DefaultValue,
+			LookupTable:     rule.LookupTable,
+			InverseLogic:    rule.InverseLogic,
+			MergeStrategy:   exportStrategy(rule),
+		})
+	}
+	return export
+}
+
+// MarshalRuleSet encodes an export as indented JSON or as YAML.
+func MarshalRuleSet(export ExportedRuleSet, format string) ([]byte, error) {
+	if format == RuleSetFormatYAML {
+		return yaml.Marshal(export)
+	}
+	body, err := json.MarshalIndent(export, "", "    ")
+	return append(body, '\n'), err
+}
+
+// exportPath writes path in dotted notation when asked to, unless a segment
+// contains a dot and the path would not survive a round trip.
+func exportPath(path models.JSONStringList, dotted bool) interface{} {
+	if dotted {
+		for _, segment := range path {
+			if strings.Contains(segment, ".") {
+				return []string(path)
+			}
+		}
+		return path.Dotted()
+	}
+	return []string(path)
+}
+
+// exportStrategy leaves the default strategy out of exports.
+func exportStrategy(rule models.MappingRule) string {
+	if rule.Strategy() == models.MergeOverwrite {
+		return ""
+	}
+	return rule.MergeStrategy
+}
+
+// DecodeRuleSet reads rule specs from a JSON or YAML body holding either an
+// array of rules or a document with a rules member.
+func DecodeRuleSet(body []byte, format string) ([]models.MappingRuleSpec, error) {
+	var doc ruleSetDocument
+	if format == RuleSetFormatYAML {
+		var node yaml.Node
+		if err := yaml.Unmarshal(body, &node); err != nil {
+			return nil, err
+		}
+		if len(node.Content) == 0 {
+			return nil, errors.New("rule set is empty")
+		}
+		root := node.Content[0]
+		if root.Kind == yaml.SequenceNode {
+			err := root.Decode(&doc.Rules)
+			return doc.Rules, err
+		}
+		err := root.Decode(&doc)
+		return doc.Rules, err
+	}
+
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) == 0 {
+		return nil, errors.New("rule set is empty")
+	}
+	if trimmed[0] == '[' {
+		err := json.Unmarshal(trimmed, &doc.Rules)
+		return doc.Rules, err
+	}
+	err := json.Unmarshal(trimmed, &doc)
+	return doc.Rules, err
+}
+
+// ValidationError reports the rules that failed validation.
+type ValidationError struct {
+	Issues []utils.RuleIssue
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("validation failed for %d rules", len(e.Issues))
+}
+
+// ValidateRules validates rules the way every write of mapping rules does
+// and returns a *ValidationError listing each invalid rule.
+func ValidateRules(rules []models.MappingRule) error {
+	if issues := utils.ValidateMappingRules(rules); len(issues) > 0 {
+		return &ValidationError{Issues: issues}
+	}
+	return nil
+}
+
+// ImportRuleSet validates specs as the rules of clientID and upserts them.
+// In replace mode stored rules missing from specs are deleted.
+func ImportRuleSet(store repository.Store, actor Actor, clientID uint, specs []models.MappingRuleSpec, replace, dryRun bool) (utils.RulePlan, []ConflictReport, error) {
+	incoming := make([]models.MappingRule, len(specs))
+	for i, spec := range specs {
+		incoming[i] = spec.Rule(clientID)
+	}
+	if err := ValidateRules(incoming); err != nil {
+		return utils.RulePlan{}, nil, err
+	}
+	plan, _, conflicts, err := UpsertRules(store, actor, clientID, incoming, replace, dryRun)
+	return plan, conflicts, err
+}
+
+// UpsertRules plans the changes that incoming makes to a client's stored
+// rules and, unless dryRun is set, applies them in one transaction. It also
+// returns the client's rules as they were before the change and the
+// conflicts in the resulting effective rule set. Changes that introduce a conflict
+// with error severity fail with ErrRuleConflicts.
+func UpsertRules(store repository.Store, actor Actor, clientID uint, incoming []models.MappingRule, replace, dryRun bool) (utils.RulePlan, []models.MappingRule, []ConflictReport, error) {
+	var plan utils.RulePlan
+	var existing []models.MappingRule
+	var conflicts []ConflictReport
+	err := store.Transaction(func(tx repository.Store) error {
+		var err error
+		if existing, err = tx.Mappings().ListByClient(clientID); err != nil {
+			return err
+		}
+		plan = utils.PlanMappingChanges(existing, incoming, replace)
+		templates, err := tx.Templates().ListByClient(clientID)
+		if err != nil {
+			return err
+		}
+
+		var blocking bool
+		conflicts, blocking = PlannedConflicts(clientID, templates, existing, plan)
+		if blocking {
+			return ErrRuleConflicts
+		}
+		if dryRun {
+			return nil
+		}
+		return ApplyRulePlan(tx, actor, &plan)
+	})
+	return plan, existing, conflicts, err
+}
+
+// ApplyRulePlan writes plan through the repositories of tx and records an
+// audit event for each change. Added rules get their IDs filled in.
+func ApplyRulePlan(tx repository.Store, actor Actor, plan *utils.RulePlan) error {
+	for i := range plan.Add {
+		rule := &plan.Add[i]
+		if err := tx.Mappings().Create(rule); err != nil {
+			return err
+		}
+		if err := RecordAudit(tx.Audit(), actor, rule.ClientID, models.AuditEntityMappingRule, rule.ID, models.AuditActionCreate, nil, rule); err != nil {
+			return err
+		}
+	}
+	for i := range plan.Update {
+		update := &plan.Update[i]
+		if err := tx.Mappings().Update(&update.After); err != nil {
+			return err
+		}
+		if err := RecordAudit(tx.Audit(), actor, update.After.ClientID, models.AuditEntityMappingRule, update.After.ID, models.AuditActionUpdate, update.Before, update.After); err != nil {
+			return err
+		}
+	}
+	for _, rule := range plan.Delete {
+		if err := tx.Mappings().Delete(rule.ID); err != nil {
+			return err
+		}
+		if err := RecordAudit(tx.Audit(), actor, rule.ClientID, models.AuditEntityMappingRule, rule.ID, models.AuditActionDelete, rule, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,336 @@
+package services
+
+import (
+	"data_mapping/models"
+	"data_mapping/repository"
+	"data_mapping/utils"
+	"errors"
+	"fmt"
+)
+
+const (
+	OriginClient   = "client"
+	OriginTemplate = "template"
+)
+
+// ErrTemplateInUse is returned when deleting a template that clients extend.
+var ErrTemplateInUse = errors.New("rule template is extended by clients")
+
+// RuleOrigin tells where a rule of an effective rule set is defined. RuleID
+// is the ID of the mapping rule or of the template rule.
+type RuleOrigin struct {
+	Type         string `json:"type"`
+	RuleID       uint   `json:"rule_id"`
+	TemplateID   uint   `json:"template_id,omitempty"`
+	TemplateName string `json:"template_name,omitempty"`
+}
+
+// ResolvedRule is a rule of a client's effective rule set. Overrides lists
+// the template rules it replaced, lowest precedence first.
+type ResolvedRule struct {
+	models.MappingRule
+	Origin    RuleOrigin   `json:"origin"`
+	Overrides []RuleOrigin `json:"overrides,omitempty"`
+
+	// clientIndex is the index of the client rule, or -1 for template rules.
+	clientIndex int
+}
+
+// ClientConflicts lists the conflicts a template change causes in the
+// effective rule set of one client.
+type ClientConflicts struct {
+	ClientID  uint             `json:"client_id"`
+	Conflicts []ConflictReport `json:"conflicts"`
+}
+
+// ResolveRules builds the effective rule set of a client from the templates
+// it extends, lowest precedence first, and its own rules. A rule replaces a
+// rule of an earlier template with the same overrideKey in place, so that the
+// transformation order of templates is kept; other rules are appended.
+// Client rules are never merged with each other.
+func ResolveRules(clientID uint, templates []models.RuleTemplate, rules []models.MappingRule) []ResolvedRule {
+	var resolved []ResolvedRule
+	fromTemplate := make(map[string]int)
+	override := func(key string, rule ResolvedRule) bool {
+		i, ok := fromTemplate[key]
+		if !ok {
+			return false
+		}
+		rule.Overrides = append(resolved[i].Overrides, resolved[i].Origin)
+		resolved[i] = rule
+		return true
+	}
+
+	for _, template := range templates {
+		for _, templateRule := range template.Rules {
+			rule := ResolvedRule{
+				MappingRule: templateRule.MappingRuleSpec.Rule(clientID),
+				Origin: RuleOrigin{
+					Type:         OriginTemplate,
+					RuleID:       templateRule.ID,
+					TemplateID:   template.ID,
+					TemplateName: template.Name,
+				},
+				clientIndex: -1,
+			}
+			key := overrideKey(rule.MappingRule)
+			if !override(key, rule) {
+				fromTemplate[key] = len(resolved)
+				resolved = append(resolved, rule)
+			}
+		}
+	}
+
+	for i, clientRule := range rules {
+		rule := ResolvedRule{
+			MappingRule: clientRule,
+			Origin:      RuleOrigin{Type: OriginClient, RuleID: clientRule.ID},
+			clientIndex: i,
+		}
+		key := overrideKey(clientRule)
+		if override(key, rule) {
+			delete(fromTemplate, key)
+			continue
+		}
+		resolved = append(resolved, rule)
+	}
+	return resolved
+}
+
+// overrideKey identifies the template rule a rule replaces. A rule that
+// overwrites its destination replaces the rule writing it; rules with another
+// merge strategy may share a destination, so they only replace the rule that
+// also has their source path.
+func overrideKey(rule models.MappingRule) string {
+	if rule.Strategy() == models.MergeOverwrite {
+		return rule.DestinationPath.Dotted()
+	}
+	return utils.RuleKey(rule)
+}
+
+// MappingRules returns the rules of an effective rule set.
+func MappingRules(resolved []ResolvedRule) []models.MappingRule {
+	rules := make([]models.MappingRule, len(resolved))
+	for i, rule := range resolved {
+		rules[i] = rule.MappingRule
+	}
+	return rules
+}
+
+// ResolvedRules returns the effective rule set of a client with the origin of
+// each rule.
+func ResolvedRules(store repository.Store, clientID uint) ([]ResolvedRule, error) {
+	templates, err := store.Templates().ListByClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := store.Mappings().ListByClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+	return ResolveRules(clientID, templates, rules), nil
+}
+
+// EffectiveRules returns the rules a client's input is transformed with: its
+// templates' rules overridden by its own.
+func EffectiveRules(store repository.Store, clientID uint) ([]models.MappingRule, error) {
+	resolved, err := ResolvedRules(store, clientID)
+	if err != nil {
+		return nil, err
+	}
+	return MappingRules(resolved), nil
+}
+
+// effectiveConflicts resolves a client's planned rules against its templates
+// and reports the conflicts in the result. Only conflicts involving a rule
+// for which isChanged returns true block the change.
+func effectiveConflicts(clientID uint, templates []models.RuleTemplate, rules []models.MappingRule, isChanged func(ResolvedRule) bool) ([]ConflictReport, bool) {
+	resolved := ResolveRules(clientID, templates, rules)
+	changed := make([]bool, len(resolved))
+	for i, rule := range resolved {
+		changed[i] = isChanged(rule)
+	}
+	return AnalyzeConflicts(MappingRules(resolved), changed)
+}
+
+// PlannedConflicts reports the conflicts in the effective rule set a client
+// would have after plan is applied to its existing rules. Only conflicts
+// involving a changed rule block the plan.
+func PlannedConflicts(clientID uint, templates []models.RuleTemplate, existing []models.MappingRule, plan utils.RulePlan) ([]ConflictReport, bool) {
+	rules, changed := utils.PlannedRules(existing, plan)
+	return effectiveConflicts(clientID, templates, rules, func(rule ResolvedRule) bool {
+		return rule.clientIndex >= 0 && changed[rule.clientIndex]
+	})
+}
+
+// templateRules validates the rules of a template request.
+func templateRules(req models.RuleTemplateRequest) ([]models.TemplateRule, error) {
+	if err := utils.ValidateStruct(req); err != nil {
+		return nil, &InputError{Err: err}
+	}
+	rules := make([]models.MappingRule, len(req.Rules))
+	templateRules := make([]models.TemplateRule, len(req.Rules))
+	for i, spec := range req.Rules {
+		rules[i] = spec.Rule(0)
+		templateRules[i] = models.TemplateRule{MappingRuleSpec: spec}
+	}
+	if err := ValidateRules(rules); err != nil {
+		return nil, err
+	}
+	return templateRules, nil
+}
+
+// CreateTemplate validates and saves a rule template.
+func CreateTemplate(store repository.Store, actor Actor, req models.RuleTemplateRequest) (models.RuleTemplate, error) {
+	rules, err := templateRules(req)
+	if err != nil {
+		return models.RuleTemplate{}, err
+	}
+	template := models.RuleTemplate{Name: req.Name, Description: req.Description, Rules: rules}
+	err = store.Transaction(func(tx repository.Store) error {
+		if err := tx.Templates().Create(&template); err != nil {
+			return err
+		}
+		return RecordAudit(tx.Audit(), actor, 0, models.AuditEntityRuleTemplate, template.ID, models.AuditActionCreate, nil, template)
+	})
+	return template, err
+}
+
+// UpdateTemplate replaces a template's name, description and rules. The
+// change fails with ErrRuleConflicts when the new rules conflict with the
+// rule set of a client extending the template; the conflicts are returned
+// per client.
+func UpdateTemplate(store repository.Store, actor Actor, id uint, req models.RuleTemplateRequest) (models.RuleTemplate, []ClientConflicts, error) {
+	rules, err := templateRules(req)
+	if err != nil {
+		return models.RuleTemplate{}, nil, err
+	}
+	var template models.RuleTemplate
+	conflicts := []ClientConflicts{}
+	err = store.Transaction(func(tx repository.Store) error {
+		before, err := tx.Templates().Get(id)
+		if err != nil {
+			return err
+		}
+		template = before
+		template.Name = req.Name
+		template.Description = req.Description
+		template.Rules = rules
+		if err := tx.Templates().Update(&template); err != nil {
+			return err
+		}
+
+		clientIDs, err := tx.Templates().ClientIDs(id)
+		if err != nil {
+			return err
+		}
+		blocking := false
+		for _, clientID := range clientIDs {
+			templates, err := tx.Templates().ListByClient(clientID)
+			if err != nil {
+				return err
+			}
+			clientRules, err := tx.Mappings().ListByClient(clientID)
+			if err != nil {
+				return err
+			}
+			reports, block := effectiveConflicts(clientID, templates, clientRules, func(rule ResolvedRule) bool {
+				return rule.Origin.TemplateID == id
+			})
+			if len(reports) > 0 {
+				conflicts = append(conflicts, ClientConflicts{ClientID: clientID, Conflicts: reports})
+			}
+			blocking = blocking || block
+		}
+		if blocking {
+			return ErrRuleConflicts
+		}
+		return RecordAudit(tx.Audit(), actor, 0, models.AuditEntityRuleTemplate, id, models.AuditActionUpdate, before, template)
+	})
+	return template, conflicts, err
+}
+
+// DeleteTemplate deletes a template that no client extends.
+func DeleteTemplate(store repository.Store, actor Actor, id uint) error {
+	return store.Transaction(func(tx repository.Store) error {
+		template, err := tx.Templates().Get(id)
+		if err != nil {
+			return err
+		}
+		clientIDs, err := tx.Templates().ClientIDs(id)
+		if err != nil {
+			return err
+		}
+		if len(clientIDs) > 0 {
+			return fmt.Errorf("%w: %v", ErrTemplateInUse, clientIDs)
+		}
+		if err := tx.Templates().Delete(id); err != nil {
+			return err
+		}
+		return RecordAudit(tx.Audit(), actor, 0, models.AuditEntityRuleTemplate, id, models.AuditActionDelete, template, nil)
+	})
+}
+
+// SetClientTemplates replaces the templates a client extends, lowest
+// precedence first. It fails with ErrRuleConflicts when a template rule
+// conflicts with the resulting rule set.
+func SetClientTemplates(store repository.Store, actor Actor, clientID uint, templateIDs []uint) ([]ConflictReport, error) {
+	seen := make(map[uint]bool, len(templateIDs))
+	for _, id := range templateIDs {
+		if seen[id] {
+			return nil, &InputError{Err: fmt.Errorf("template %d is listed more than once", id)}
+		}
+		seen[id] = true
+	}
+
+	var conflicts []ConflictReport
+	err := store.Transaction(func(tx repository.Store) error {
+		client, err := tx.Clients().Get(clientID)
+		if err != nil {
+			return err
+		}
+		previous, err := tx.Templates().ListByClient(client.ID)
+		if err != nil {
+			return err
+		}
+		templates := make([]models.RuleTemplate, 0, len(templateIDs))
+		for _, id := range templateIDs {
+			template, err := tx.Templates().Get(id)
+			if errors.Is(err, repository.ErrNotFound) {
+				return &InputError{Err: fmt.Errorf("template %d not found", id)}
+			}
+			if err != nil {
+				return err
+			}
+			templates = append(templates, template)
+		}
+
+		rules, err := tx.Mappings().ListByClient(client.ID)
+		if err != nil {
+			return err
+		}
+		var blocking bool
+		conflicts, blocking = effectiveConflicts(client.ID, templates, rules, func(rule ResolvedRule) bool {
+			return rule.Origin.Type == OriginTemplate
+		})
+		if blocking {
+			return ErrRuleConflicts
+		}
+
+		if err := tx.Templates().SetForClient(client.ID, templateIDs); err != nil {
+			return err
+		}
+		before := map[string]interface{}{"template_ids": templateIDsOf(previous)}
+		after := map[string]interface{}{"template_ids": templateIDs}
+		return RecordAudit(tx.Audit(), actor, client.ID, models.AuditEntityClient, client.ID, models.AuditActionUpdate, before, after)
+	})
+	return conflicts, err
+}
+
+func templateIDsOf(templates []models.RuleTemplate) []uint {
+	ids := make([]uint, len(templates))
+	for i, template := range templates {
+		ids[i] = template.ID
+	}
+	return ids
+}
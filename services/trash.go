@@ -0,0 +1,110 @@
+package services
+
+import (
+	"data_mapping/models"
+	"data_mapping/repository"
+	"data_mapping/utils"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrClientNameTaken is returned when restoring a client whose name has
+	// been given to another client since it was deleted.
+	ErrClientNameTaken = errors.New("another client has this name")
+	// ErrClientDeleted is returned when restoring a rule whose client is in
+	// the trash.
+	ErrClientDeleted = errors.New("the rule's client is deleted")
+)
+
+// RestoreClient takes a client out of the trash together with the mapping
+// rules deleted with it. Rules deleted on their own before the client stay in
+// the trash.
+func RestoreClient(store repository.Store, actor Actor, id uint) (models.Client, []models.MappingRule, error) {
+	var client models.Client
+	var rules []models.MappingRule
+	err := store.Transaction(func(tx repository.Store) error {
+		var err error
+		if client, err = tx.Clients().GetDeleted(id); err != nil {
+			return err
+		}
+		_, err = tx.Clients().GetByName(client.Name)
+		if err == nil {
+			return ErrClientNameTaken
+		}
+		if !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+
+		if err := tx.Clients().Restore(client.ID); err != nil {
+			return err
+		}
+		if rules, err = tx.Mappings().RestoreByClient(client.ID, client.DeletedAt.Time); err != nil {
+			return err
+		}
+		if client, err = tx.Clients().Get(client.ID); err != nil {
+			return err
+		}
+		after := map[string]interface{}{"client": client, "mapping_rules": rules}
+		return RecordAudit(tx.Audit(), actor, client.ID, models.AuditEntityClient, client.ID, models.AuditActionRestore, nil, after)
+	})
+	return client, rules, err
+}
+
+// RestoreRule takes a mapping rule out of the trash. The rule set it returns
+// to is checked for conflicts like any other change, since the rule's
+// destination may have been mapped again while it was deleted.
+func RestoreRule(store repository.Store, actor Actor, id uint) (models.MappingRule, []ConflictReport, error) {
+	var rule models.MappingRule
+	var conflicts []ConflictReport
+	err := store.Transaction(func(tx repository.Store) error {
+		var err error
+		if rule, err = tx.Mappings().GetDeleted(id); err != nil {
+			return err
+		}
+		_, err = tx.Clients().Get(rule.ClientID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrClientDeleted
+		}
+		if err != nil {
+			return err
+		}
+
+		existing, err := tx.Mappings().ListByClient(rule.ClientID)
+		if err != nil {
+			return err
+		}
+		templates, err := tx.Templates().ListByClient(rule.ClientID)
+		if err != nil {
+			return err
+		}
+		var blocking bool
+		conflicts, blocking = PlannedConflicts(rule.ClientID, templates, existing, utils.RulePlan{Add: []models.MappingRule{rule}})
+		if blocking {
+			return ErrRuleConflicts
+		}
+
+		if err := tx.Mappings().Restore(rule.ID); err != nil {
+			return err
+		}
+		if rule, err = tx.Mappings().Get(rule.ID); err != nil {
+			return err
+		}
+		return RecordAudit(tx.Audit(), actor, rule.ClientID, models.AuditEntityMappingRule, rule.ID, models.AuditActionRestore, nil, rule)
+	})
+	return rule, conflicts, err
+}
+
+// PurgeTrash permanently removes the clients and mapping rules deleted before
+// cutoff.
+func PurgeTrash(store repository.Store, cutoff time.Time) (clients, rules int64, err error) {
+	err = store.Transaction(func(tx repository.Store) error {
+		var err error
+		if rules, err = tx.Mappings().Purge(cutoff); err != nil {
+			return err
+		}
+		clients, err = tx.Clients().Purge(cutoff)
+		return err
+	})
+	return clients, rules, err
+}
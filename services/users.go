@@ -0,0 +1,78 @@
+package services
+
+import (
+	"data_mapping/models"
+	"data_mapping/repository"
+	"errors"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength is the shortest password accepted for a user.
+const MinPasswordLength = 8
+
+// Until the first user is created, the API accepts the built-in development
+// account so that a fresh installation can be used.
+const (
+	defaultUsername = "admin"
+	defaultPassword = "password"
+)
+
+// AddUser creates a user with the given password.
+func AddUser(users repository.UserRepository, username, password string) (models.User, error) {
+	if username == "" || len(username) > 100 {
+		return models.User{}, &InputError{Err: errors.New("username must be between 1 and 100 characters")}
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return models.User{}, err
+	}
+	user := models.User{Username: username, PasswordHash: hash}
+	return user, users.Create(&user)
+}
+
+// ResetPassword replaces a user's password. It returns
+// repository.ErrNotFound when there is no such user.
+func ResetPassword(users repository.UserRepository, username, password string) error {
+	user, err := users.GetByUsername(username)
+	if err != nil {
+		return err
+	}
+	if user.PasswordHash, err = hashPassword(password); err != nil {
+		return err
+	}
+	return users.Update(&user)
+}
+
+// Authenticate reports whether password is the password of username. While
+// no users exist only the built-in admin account is accepted.
+func Authenticate(users repository.UserRepository, username, password string) (bool, error) {
+	count, err := users.Count()
+	if err != nil {
+		return false, err
+	}
+	if count == 0 {
+		return username == defaultUsername && password == defaultPassword, nil
+	}
+
+	user, err := users.GetByUsername(username)
+	if errors.Is(err, repository.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) == nil, nil
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", &InputError{Err: errors.New("password must be at least 8 characters")}
+	}
+	// bcrypt ignores anything after 72 bytes.
+	if len(password) > 72 {
+		return "", &InputError{Err: errors.New("password must be at most 72 bytes")}
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"data_mapping/models"
+	"fmt"
+	"strings"
+)
+
+const (
+	ConflictDuplicateDestination = "duplicate_destination"
+	ConflictPathCollision        = "path_collision"
+	ConflictUnreachableSource    = "unreachable_source"
+
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// RuleConflict describes a problem between rules, or within one rule, that
+// makes the output depend on rule order or lose values. Rules holds indexes
+// into the analysed slice.
+type RuleConflict struct {
+	Type     string `json:"type"`
+	Severity string `json:"severity"`
+	Rules    []int  `json:"rules"`
+	Path     string `json:"path"`
+	Message  string `json:"message"`
+}
+
+// AnalyzeRuleConflicts checks a client's rules, in transformation order, for
+// destinations written more than once, destinations nested inside another
+// rule's destination, and source paths that can never match input.
+//
+// Writing a destination again is an error when the later rule overwrites it,
+// and a warning when its merge strategy combines the values or, for
+// keep-first, makes it a fallback for the earlier rules. A path nested
+// under another rule's destination is an error unless the outer rule
+// deep-merges.
+func AnalyzeRuleConflicts(rules []models.MappingRule) []RuleConflict {
+	var conflicts []RuleConflict
+
+	for i, rule := range rules {
+		for _, segment := range rule.SourcePath {
+			if strings.TrimSpace(segment) == "" || strings.TrimSpace(segment) != segment {
+				conflicts = append(conflicts, RuleConflict{
+					Type:     ConflictUnreachableSource,
+					Severity: SeverityError,
+					Rules:    []int{i},
+					Path:     rule.SourcePath.Dotted(),
+					Message:  fmt.Sprintf("source path %q has an empty or space-padded segment and never matches input", rule.SourcePath.Dotted()),
+				})
+				break
+			}
+		}
+	}
+
+	writers := make(map[string][]int)
+	var order []string
+	for i, rule := range rules {
+		key := rule.DestinationPath.Dotted()
+		if _, ok := writers[key]; !ok {
+			order = append(order, key)
+		}
+		writers[key] = append(writers[key], i)
+	}
+
+	for _, key := range order {
+		indexes := writers[key]
+		if len(indexes) < 2 {
+			continue
+		}
+		severity := SeverityWarning
+		fallbacks := true
+		for _, i := range indexes[1:] {
+			if rules[i].Strategy() == models.MergeOverwrite {
+				severity = SeverityError
+			}
+			if rules[i].Strategy() != models.MergeKeepFirst {
+				fallbacks = false
+			}
+		}
+		message := fmt.Sprintf("destination path %q is written by %d rules", key, len(indexes))
+		if severity == SeverityError {
+			message += "; later rules overwrite earlier values"
+		} else if fallbacks {
+			message += "; later keep-first rules only fill it when earlier rules leave it unset"
+		}
+		conflicts = append(conflicts, RuleConflict{
+			Type:     ConflictDuplicateDestination,
+			Severity: severity,
+			Rules:    indexes,
+			Path:     key,
+			Message:  message,
+		})
+	}
+
+	for _, parent := range order {
+		for _, child := range order {
+			if !strings.HasPrefix(child, parent+".") {
+				continue
+			}
+			severity := SeverityError
+			for _, i := range writers[parent] {
+				if rules[i].Strategy() == models.MergeDeepMerge {
+					severity = SeverityWarning
+				}
+			}
+			conflicts = append(conflicts, RuleConflict{
+				Type:     ConflictPathCollision,
+				Severity: severity,
+				Rules:    append(append([]int{}, writers[parent]...), writers[child]...),
+				Path:     child,
+				Message:  fmt.Sprintf("destination path %q is nested inside %q, which is also written as a whole", child, parent),
+			})
+		}
+	}
+
+	return conflicts
+}
+
+// HasConflictErrors reports whether any conflict has error severity.
+func HasConflictErrors(conflicts []RuleConflict) bool {
+	for _, conflict := range conflicts {
+		if conflict.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"data_mapping/models"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestAnalyzeRuleConflictsDuplicateDestination(t *testing.T) {
+	rule := func(source, destination, strategy string) models.MappingRule {
+		return models.MappingRule{
+			SourcePath:      models.JSONStringList{source},
+			DestinationPath: models.JSONStringList{destination},
+			TransformType:   "copy",
+			MergeStrategy:   strategy,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		rules    []models.MappingRule
+		severity string
+	}{
+		{"overwrite", []models.MappingRule{rule("a", "x", ""), rule("b", "x", "")}, SeverityError},
+		{"keep-first fallback", []models.MappingRule{rule("a", "x", ""), rule("b", "x", models.MergeKeepFirst)}, SeverityWarning},
+		{"same source fallback", []models.MappingRule{rule("a", "x", ""), rule("a", "x", models.MergeKeepFirst)}, SeverityWarning},
+		{"append", []models.MappingRule{rule("a", "x", ""), rule("b", "x", models.MergeAppendToArray)}, SeverityWarning},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conflicts := AnalyzeRuleConflicts(tt.rules)
+			if len(conflicts) != 1 || conflicts[0].Type != ConflictDuplicateDestination {
+				t.Fatalf("got %+v, want one duplicate_destination conflict", conflicts)
+			}
+			if conflicts[0].Severity != tt.severity {
+				t.Errorf("severity = %q, want %q", conflicts[0].Severity, tt.severity)
+			}
+		})
+	}
+}
+
+func TestSampleRuleSetHasNoBlockingConflicts(t *testing.T) {
+	data, err := os.ReadFile("../sample_data/client_mapping_rules_fixed.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var specs []models.MappingRuleSpec
+	if err := json.Unmarshal(data, &specs); err != nil {
+		t.Fatal(err)
+	}
+	rules := make([]models.MappingRule, len(specs))
+	for i, spec := range specs {
+		rules[i] = spec.Rule(1)
+	}
+
+	if issues := ValidateMappingRules(rules); len(issues) > 0 {
+		t.Errorf("ValidateMappingRules: %+v", issues)
+	}
+	for _, conflict := range AnalyzeRuleConflicts(rules) {
+		if conflict.Severity == SeverityError {
+			t.Errorf("unexpected conflict: %+v", conflict)
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package utils
+
+import (
+	"bufio"
+	"data_mapping/models"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	CSVQuoteMinimal = "minimal"
+	CSVQuoteAll     = "all"
+)
+
+// CSVOptions controls how CSV input is parsed and how CSV output is written.
+type CSVOptions struct {
+	Delimiter rune
+	// Quote is CSVQuoteMinimal (quote only when needed) or CSVQuoteAll.
+	Quote string
+	// Columns fixes the output columns and their order. Each column is a
+	// DestinationPath joined with ".". When empty, the columns are the
+	// destinations of the rules in rule order.
+	Columns []string
+	// ColumnTypes converts input cells of the named columns to "string",
+	// "number", "integer", "boolean" or "json" values.
+	ColumnTypes map[string]string
+	// ErrorColumn, when set, adds a column holding the error message of
+	// records that failed. Otherwise failed records are left out and
+	// counted; see CSVRecordWriter.
+	ErrorColumn string
+}
+
+// DefaultCSVOptions returns comma-delimited, minimally quoted options.
+func DefaultCSVOptions() CSVOptions {
+	return CSVOptions{Delimiter: ',', Quote: CSVQuoteMinimal}
+}
+
+// ParseCSVColumnTypes parses hints of the form "amount:number,active:boolean".
+func ParseCSVColumnTypes(spec string) (map[string]string, error) {
+	types := make(map[string]string)
+	if strings.TrimSpace(spec) == "" {
+		return types, nil
+	}
+	for _, item := range strings.Split(spec, ",") {
+		parts := strings.SplitN(item, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid column type hint %q, expected column:type", item)
+		}
+		column, typ := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		switch typ {
+		case "string", "number", "integer", "boolean", "json":
+			types[column] = typ
+		default:
+			return nil, fmt.Errorf("unknown column type %q for column %q", typ, column)
+		}
+	}
+	return types, nil
+}
+
+// NewCSVDecoder returns a RecordDecoder that reads CSV rows as records keyed
+// by the header row. Header names are split on "." into nested objects, the
+// way CSV output joins destination paths, so "applicant.name" is read by a
+// rule with SourcePath ["applicant", "name"].
+func NewCSVDecoder(r io.Reader, opts CSVOptions) RecordDecoder {
+	return func(fn RecordFunc) error {
+		limit := &recordLimitReader{r: r, limit: MaxRecordSize}
+		reader := csv.NewReader(bufio.NewReader(limit))
+		reader.Comma = opts.Delimiter
+		reader.FieldsPerRecord = -1
+		reader.ReuseRecord = true
+
+		header, err := reader.Read()
+		if err != nil {
+			if err == io.EOF {
+				return fmt.Errorf("CSV input has no header row")
+			}
+			return err
+		}
+		columns := make([]string, len(header))
+		for i, name := range header {
+			columns[i] = strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))
+		}
+		paths, err := csvColumnPaths(columns)
+		if err != nil {
+			return err
+		}
+
+		for index := 0; ; index++ {
+			limit.mark(reader.InputOffset())
+			row, err := reader.Read()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				if errors.Is(err, errRecordTooLarge) {
+					return fmt.Errorf("record %d exceeds the maximum size of %d bytes", index, MaxRecordSize)
+				}
+				if _, ok := err.(*csv.ParseError); !ok {
+					return err
+				}
+				if err := fn(index, nil, err); err != nil {
+					return err
+				}
+				continue
+			}
+
+			record, err := csvRowToRecord(columns, paths, row, opts.ColumnTypes)
+			if err := fn(index, record, err); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+var errRecordTooLarge = errors.New("record too large")
+
+// recordLimitReader fails once more than limit bytes, plus what the CSV
+// reader buffers ahead, are read past the start of the current record.
+type recordLimitReader struct {
+	r     io.Reader
+	limit int64
+	read  int64
+	start int64
+}
+
+func (lr *recordLimitReader) mark(offset int64) {
+	lr.start = offset
+}
+
+func (lr *recordLimitReader) Read(p []byte) (int, error) {
+	if lr.read-lr.start > lr.limit+64*1024 {
+		return 0, errRecordTooLarge
+	}
+	n, err := lr.r.Read(p)
+	lr.read += int64(n)
+	return n, err
+}
+
+// csvColumnPaths splits header names into paths. A column that is a prefix
+// of another, such as "applicant" and "applicant.name", is rejected since a
+// field cannot hold both a value and nested fields.
+func csvColumnPaths(columns []string) ([][]string, error) {
+	paths := make([][]string, len(columns))
+	for i, column := range columns {
+		paths[i] = strings.Split(column, ".")
+	}
+	for _, column := range columns {
+		for _, other := range columns {
+			if strings.HasPrefix(other, column+".") {
+				return nil, fmt.Errorf("CSV header %q conflicts with %q", column, other)
+			}
+		}
+	}
+	return paths, nil
+}
+
+func csvRowToRecord(columns []string, paths [][]string, row []string, types map[string]string) (map[string]interface{}, error) {
+	if len(row) > len(columns) {
+		return nil, fmt.Errorf("row has %d fields but the header has %d", len(row), len(columns))
+	}
+	record := make(map[string]interface{}, len(columns))
+	for i, cell := range row {
+		column := columns[i]
+		typ := types[column]
+		if typ == "" || typ == "string" {
+			SetNestedValue(record, paths[i], cell)
+			continue
+		}
+		if strings.TrimSpace(cell) == "" {
+			continue
+		}
+		value, err := convertCSVCell(strings.TrimSpace(cell), typ)
+		if err != nil {
+			return nil, fmt.Errorf("column %q: %v", column, err)
+		}
+		SetNestedValue(record, paths[i], value)
+	}
+	return record, nil
+}
+
+func convertCSVCell(cell, typ string) (interface{}, error) {
+	switch typ {
+	case "number":
+		return strconv.ParseFloat(cell, 64)
+	case "integer":
+		return strconv.Atoi(cell)
+	case "boolean":
+		return strconv.ParseBool(cell)
+	case "json":
+		var value interface{}
+		err := json.Unmarshal([]byte(cell), &value)
+		return value, err
+	}
+	return cell, nil
+}
+
+// CSVColumnsForRules returns the destination paths of rules, joined with
+// ".", in rule order and without duplicates.
+func CSVColumnsForRules(rules []models.MappingRule) []string {
+	seen := make(map[string]bool)
+	var columns []string
+	for _, rule := range rules {
+		column := strings.Join(rule.DestinationPath, ".")
+		if !seen[column] {
+			seen[column] = true
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// CSVRecordWriter is a RecordWriter that counts the failed records it left
+// out for want of an error column.
+type CSVRecordWriter interface {
+	RecordWriter
+	Dropped() int
+}
+
+type csvRecordWriter struct {
+	w       *bufio.Writer
+	flusher http.Flusher
+	opts    CSVOptions
+	columns []string
+	paths   [][]string
+	started bool
+	dropped int
+}
+
+// NewCSVRecordWriter flattens transformed records into CSV rows with one
+// column per destination path. Rows are flushed as they are written.
+func NewCSVRecordWriter(w io.Writer, rules []models.MappingRule, opts CSVOptions) CSVRecordWriter {
+	columns := opts.Columns
+	if len(columns) == 0 {
+		columns = CSVColumnsForRules(rules)
+	}
+	paths := make([][]string, len(columns))
+	for i, column := range columns {
+		paths[i] = strings.Split(column, ".")
+	}
+	flusher, _ := w.(http.Flusher)
+	return &csvRecordWriter{w: bufio.NewWriter(w), flusher: flusher, opts: opts, columns: columns, paths: paths}
+}
+
+func (cw *csvRecordWriter) start() error {
+	if cw.started {
+		return nil
+	}
+	cw.started = true
+	header := cw.columns
+	if cw.opts.ErrorColumn != "" {
+		header = append(append([]string{}, header...), cw.opts.ErrorColumn)
+	}
+	return cw.writeRow(header)
+}
+
+func (cw *csvRecordWriter) WriteRecord(index int, output map[string]interface{}, missingRequired []string) error {
+	if err := cw.start(); err != nil {
+		return err
+	}
+	row := make([]string, len(cw.columns), len(cw.columns)+1)
+	for i, path := range cw.paths {
+		if value, ok := GetNestedValue(output, path); ok {
+			row[i] = FormatCell(value)
+		}
+	}
+	if cw.opts.ErrorColumn != "" {
+		row = append(row, "")
+	}
+	return cw.writeRow(row)
+}
+
+func (cw *csvRecordWriter) WriteError(index int, err error) error {
+	if startErr := cw.start(); startErr != nil {
+		return startErr
+	}
+	if cw.opts.ErrorColumn == "" {
+		cw.dropped++
+		return nil
+	}
+	return cw.writeErrorRow(fmt.Sprintf("record %d: %v", index, err))
+}
+
+// Close flushes the output. A stream-level error is written as a last row
+// when there is an error column; otherwise it is left for the caller to
+// report. Nothing is written when the stream failed before the header row,
+// so that the caller can still reject the request.
+func (cw *csvRecordWriter) Close(err error) error {
+	if err != nil && !cw.started {
+		return nil
+	}
+	if startErr := cw.start(); startErr != nil {
+		return startErr
+	}
+	if err != nil && cw.opts.ErrorColumn != "" {
+		return cw.writeErrorRow(err.Error())
+	}
+	return cw.flush()
+}
+
+func (cw *csvRecordWriter) Dropped() int {
+	return cw.dropped
+}
+
+func (cw *csvRecordWriter) writeErrorRow(message string) error {
+	row := make([]string, len(cw.columns)+1)
+	row[len(cw.columns)] = message
+	return cw.writeRow(row)
+}
+
+func (cw *csvRecordWriter) writeRow(fields []string) error {
+	for i, field := range fields {
+		if i > 0 {
+			cw.w.WriteRune(cw.opts.Delimiter)
+		}
+		if cw.opts.Quote == CSVQuoteAll || cw.needsQuotes(field) {
+			cw.w.WriteByte('"')
+			cw.w.WriteString(strings.ReplaceAll(field, `"`, `""`))
+			cw.w.WriteByte('"')
+		} else {
+			cw.w.WriteString(field)
+		}
+	}
+	if _, err := cw.w.WriteString("\n"); err != nil {
+		return err
+	}
+	return cw.flush()
+}
+
+func (cw *csvRecordWriter) flush() error {
+	if err := cw.w.Flush(); err != nil {
+		return err
+	}
+	if cw.flusher != nil {
+		cw.flusher.Flush()
+	}
+	return nil
+}
+
+func (cw *csvRecordWriter) needsQuotes(field string) bool {
+	if field == "" {
+		return false
+	}
+	return strings.ContainsRune(field, cw.opts.Delimiter) ||
+		strings.ContainsAny(field, "\"\r\n") ||
+		field[0] == ' ' || field[len(field)-1] == ' '
+}
+
+// FormatCell renders a transformed value as flat text. Objects and arrays are
+// written as JSON.
+func FormatCell(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// JSONDiff describes one difference between two decoded JSON documents.
+type JSONDiff struct {
+	Path   string      `json:"path"`
+	Op     string      `json:"op"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// DiffJSON compares two decoded JSON values and returns the differences as
+// dotted paths, sorted by path.
+func DiffJSON(before, after interface{}) []JSONDiff {
+	var diffs []JSONDiff
+	diffValues(nil, before, after, &diffs)
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Path < diffs[j].Path })
+	return diffs
+}
+
+func diffValues(path []string, before, after interface{}, diffs *[]JSONDiff) {
+	beforeMap, beforeIsMap := before.(map[string]interface{})
+	afterMap, afterIsMap := after.(map[string]interface{})
+	if beforeIsMap && afterIsMap {
+		for key, b := range beforeMap {
+			if a, ok := afterMap[key]; ok {
+				diffValues(append(path, key), b, a, diffs)
+			} else {
+				*diffs = append(*diffs, JSONDiff{Path: joinPath(append(path, key)), Op: DiffRemoved, Before: b})
+			}
+		}
+		for key, a := range afterMap {
+			if _, ok := beforeMap[key]; !ok {
+				*diffs = append(*diffs, JSONDiff{Path: joinPath(append(path, key)), Op: DiffAdded, After: a})
+			}
+		}
+		return
+	}
+
+	beforeArr, beforeIsArr := before.([]interface{})
+	afterArr, afterIsArr := after.([]interface{})
+	if beforeIsArr && afterIsArr {
+		for i := 0; i < len(beforeArr) || i < len(afterArr); i++ {
+			elemPath := append(path, strconv.Itoa(i))
+			switch {
+			case i >= len(afterArr):
+				*diffs = append(*diffs, JSONDiff{Path: joinPath(elemPath), Op: DiffRemoved, Before: beforeArr[i]})
+			case i >= len(beforeArr):
+				*diffs = append(*diffs, JSONDiff{Path: joinPath(elemPath), Op: DiffAdded, After: afterArr[i]})
+			default:
+				diffValues(elemPath, beforeArr[i], afterArr[i], diffs)
+			}
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(before, after) {
+		*diffs = append(*diffs, JSONDiff{Path: joinPath(path), Op: DiffChanged, Before: before, After: after})
+	}
+}
+
+func joinPath(path []string) string {
+	return strings.Join(path, ".")
+}
@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"data_mapping/models"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldIssue reports a fixed-width field whose value did not fit.
+type FieldIssue struct {
+	Index    int    `json:"index"`
+	Field    string `json:"field"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// FormatFixedWidthRecord renders output as one fixed-width line. Values that
+// are too long are truncated and reported; if any of them belongs to a field
+// with OnTruncate "error", ok is false and the line must not be used.
+func FormatFixedWidthRecord(output map[string]interface{}, layout models.FixedWidthLayout) (line string, issues []FieldIssue, ok bool) {
+	length := layout.LineLength
+	for _, field := range layout.Fields {
+		if end := field.Start + field.Length - 1; end > length {
+			length = end
+		}
+	}
+	buf := []rune(strings.Repeat(" ", length))
+	ok = true
+
+	for _, field := range layout.Fields {
+		value, _ := GetNestedValue(output, strings.Split(field.Name, "."))
+		text, err := formatFixedWidthValue(value, field)
+		if err != nil {
+			issues = append(issues, FieldIssue{Field: field.Name, Severity: "error", Message: err.Error()})
+			ok = false
+			continue
+		}
+
+		if n := utf8.RuneCountInString(text); n > field.Length {
+			severity := "warning"
+			if field.OnTruncate == "error" {
+				severity = "error"
+				ok = false
+			}
+			issues = append(issues, FieldIssue{
+				Field:    field.Name,
+				Severity: severity,
+				Message:  fmt.Sprintf("value of length %d truncated to %d", n, field.Length),
+			})
+			text = truncateFixedWidth(text, field)
+		}
+
+		copy(buf[field.Start-1:], []rune(padFixedWidth(text, field)))
+	}
+	return string(buf), issues, ok
+}
+
+func formatFixedWidthValue(value interface{}, field models.FixedWidthField) (string, error) {
+	number, isNumber := value.(float64)
+	if n, ok := value.(int); ok {
+		number, isNumber = float64(n), true
+	}
+	if !isNumber && (field.ImpliedDecimals > 0 || field.Format != "") {
+		if s, ok := value.(string); ok && strings.TrimSpace(s) != "" {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			if err != nil {
+				return "", fmt.Errorf("value %q is not numeric", s)
+			}
+			number, isNumber = parsed, true
+		}
+	}
+
+	switch {
+	case isNumber && field.ImpliedDecimals > 0:
+		scaled := math.Round(number * math.Pow10(field.ImpliedDecimals))
+		return strconv.FormatFloat(scaled, 'f', 0, 64), nil
+	case isNumber && field.Format != "":
+		return fmt.Sprintf(field.Format, number), nil
+	default:
+		return FormatCell(value), nil
+	}
+}
+
+func padFixedWidth(text string, field models.FixedWidthField) string {
+	pad := field.Pad
+	if pad == "" {
+		pad = " "
+	}
+	missing := field.Length - utf8.RuneCountInString(text)
+	if missing <= 0 {
+		return text
+	}
+	if field.Align == "right" {
+		return strings.Repeat(pad, missing) + text
+	}
+	return text + strings.Repeat(pad, missing)
+}
+
+// truncateFixedWidth keeps the leftmost characters of left-aligned values and
+// the rightmost characters of right-aligned ones.
+func truncateFixedWidth(text string, field models.FixedWidthField) string {
+	runes := []rune(text)
+	if field.Align == "right" {
+		return string(runes[len(runes)-field.Length:])
+	}
+	return string(runes[:field.Length])
+}
+
+type fixedWidthRecordWriter struct {
+	w       io.Writer
+	layout  models.FixedWidthLayout
+	flusher http.Flusher
+	issues  []FieldIssue
+}
+
+// FixedWidthRecordWriter is a RecordWriter that also reports per-field
+// issues, which fixed-width output has no room for.
+type FixedWidthRecordWriter interface {
+	RecordWriter
+	Issues() []FieldIssue
+}
+
+// NewFixedWidthRecordWriter writes one fixed-width line per record. Records
+// rejected by a field with OnTruncate "error", and records that failed to
+// transform, are left out and reported through Issues.
+func NewFixedWidthRecordWriter(w io.Writer, layout models.FixedWidthLayout) FixedWidthRecordWriter {
+	flusher, _ := w.(http.Flusher)
+	return &fixedWidthRecordWriter{w: w, layout: layout, flusher: flusher}
+}
+
+func (fw *fixedWidthRecordWriter) WriteRecord(index int, output map[string]interface{}, missingRequired []string) error {
+	line, issues, ok := FormatFixedWidthRecord(output, fw.layout)
+	for _, issue := range issues {
+		issue.Index = index
+		fw.issues = append(fw.issues, issue)
+	}
+	if !ok {
+		return nil
+	}
+	if _, err := io.WriteString(fw.w, line+"\n"); err != nil {
+		return err
+	}
+	if fw.flusher != nil {
+		fw.flusher.Flush()
+	}
+	return nil
+}
+
+func (fw *fixedWidthRecordWriter) WriteError(index int, err error) error {
+	fw.issues = append(fw.issues, FieldIssue{Index: index, Severity: "error", Message: err.Error()})
+	return nil
+}
+
+func (fw *fixedWidthRecordWriter) Close(err error) error {
+	if err != nil {
+		fw.issues = append(fw.issues, FieldIssue{Index: -1, Severity: "error", Message: err.Error()})
+	}
+	return nil
+}
+
+func (fw *fixedWidthRecordWriter) Issues() []FieldIssue {
+	return fw.issues
+}
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"data_mapping/models"
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// DecodeXMLLayout parses and validates an XML layout definition.
+func DecodeXMLLayout(definition []byte) (models.XMLLayout, error) {
+	var layout models.XMLLayout
+	if err := json.Unmarshal(definition, &layout); err != nil {
+		return layout, err
+	}
+	if err := ValidateStruct(layout); err != nil {
+		return layout, err
+	}
+	return layout, nil
+}
+
+// DecodeFixedWidthLayout parses and validates a fixed-width layout
+// definition, rejecting overlapping fields.
+func DecodeFixedWidthLayout(definition []byte) (models.FixedWidthLayout, error) {
+	var layout models.FixedWidthLayout
+	if err := json.Unmarshal(definition, &layout); err != nil {
+		return layout, err
+	}
+	if err := ValidateStruct(layout); err != nil {
+		return layout, err
+	}
+
+	fields := append([]models.FixedWidthField{}, layout.Fields...)
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Start < fields[j].Start })
+	for i := 1; i < len(fields); i++ {
+		prev := fields[i-1]
+		if fields[i].Start < prev.Start+prev.Length {
+			return layout, fmt.Errorf("field %q overlaps field %q", fields[i].Name, prev.Name)
+		}
+	}
+	if layout.LineLength > 0 {
+		last := fields[len(fields)-1]
+		if end := last.Start + last.Length - 1; end > layout.LineLength {
+			return layout, fmt.Errorf("field %q ends at column %d, past line_length %d", last.Name, end, layout.LineLength)
+		}
+	}
+	return layout, nil
+}
@@ -0,0 +1,217 @@
+package utils
+
+import (
+	"data_mapping/models"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/antonmedv/expr"
+	"github.com/antonmedv/expr/ast"
+	"github.com/antonmedv/expr/builtin"
+	"github.com/antonmedv/expr/parser"
+)
+
+const (
+	LintSyntaxError            = "syntax_error"
+	LintUndefinedFunction      = "undefined_function"
+	LintUndefinedVariable      = "undefined_variable"
+	LintTypeMismatch           = "type_mismatch"
+	LintRequiredWithoutDefault = "required_without_default"
+	LintLogicOverridesType     = "logic_overrides_type"
+	LintDeadRule               = "dead_rule"
+)
+
+// LintIssue is a problem found in a single rule. Rule is the index of the
+// rule in the linted slice.
+type LintIssue struct {
+	Rule            int    `json:"rule"`
+	RuleID          uint   `json:"rule_id,omitempty"`
+	DestinationPath string `json:"destination_path,omitempty"`
+	Code            string `json:"code"`
+	Severity        string `json:"severity"`
+	Message         string `json:"message"`
+}
+
+// LintRules statically checks rules, in transformation order, without
+// running them.
+func LintRules(rules []models.MappingRule) []LintIssue {
+	var issues []LintIssue
+	add := func(i int, code, severity, message string) {
+		issues = append(issues, LintIssue{
+			Rule:            i,
+			RuleID:          rules[i].ID,
+			DestinationPath: rules[i].DestinationPath.Dotted(),
+			Code:            code,
+			Severity:        severity,
+			Message:         message,
+		})
+	}
+
+	for i, rule := range rules {
+		if rule.TransformLogic != "" {
+			for _, issue := range LintExpression(rule.TransformLogic, rule) {
+				add(i, issue.Code, issue.Severity, issue.Message)
+			}
+			if rule.TransformType != "expression" {
+				add(i, LintLogicOverridesType, SeverityWarning,
+					fmt.Sprintf("transform_logic is evaluated instead of the %q transform", rule.TransformType))
+			}
+		}
+		if rule.InverseLogic != "" {
+			for _, issue := range LintExpression(InverseExpression(rule), rule) {
+				add(i, issue.Code, issue.Severity, "inverse_logic: "+issue.Message)
+			}
+		}
+		if rule.Required && rule.DefaultValue == "" {
+			add(i, LintRequiredWithoutDefault, SeverityWarning,
+				"required rule has no default_value; a placeholder guessed from the field name is written when the source is missing")
+		}
+		if j, ok := shadowingRule(rules, i); ok {
+			add(i, LintDeadRule, SeverityWarning,
+				fmt.Sprintf("output of this rule is always replaced by rule %d", j))
+		} else if j, ok := blockingRule(rules, i); ok {
+			add(i, LintDeadRule, SeverityWarning,
+				fmt.Sprintf("rule %d always writes %q first, so this keep-first rule never writes", j, rule.DestinationPath.Dotted()))
+		}
+	}
+	return issues
+}
+
+// LintExpression checks an expression for syntax errors, calls to undefined
+// functions, references to undefined variables and type errors against the
+// environment rule's TransformLogic runs in.
+func LintExpression(expression string, rule models.MappingRule) []LintIssue {
+	tree, err := parser.Parse(expression)
+	if err != nil {
+		return []LintIssue{{Code: LintSyntaxError, Severity: SeverityError, Message: err.Error()}}
+	}
+
+	env := lintEnv(rule)
+	finder := &identifierFinder{callees: make(map[*ast.IdentifierNode]bool)}
+	ast.Walk(&tree.Node, finder)
+	functions := make(map[string]bool)
+	variables := make(map[string]bool)
+	for _, ident := range finder.identifiers {
+		if envDefines(env, ident.Value) {
+			continue
+		}
+		if finder.callees[ident] {
+			functions[ident.Value] = true
+		} else {
+			variables[ident.Value] = true
+		}
+	}
+
+	var issues []LintIssue
+	for _, name := range sortedKeys(functions) {
+		issues = append(issues, LintIssue{
+			Code:     LintUndefinedFunction,
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("function %q is not defined", name),
+		})
+	}
+	for _, name := range sortedKeys(variables) {
+		issues = append(issues, LintIssue{
+			Code:     LintUndefinedVariable,
+			Severity: SeverityError,
+			Message:  fmt.Sprintf("variable %q is not defined", name),
+		})
+	}
+	if len(issues) > 0 {
+		return issues
+	}
+
+	if _, err := expr.Compile(expression, expr.Env(env)); err != nil {
+		issues = append(issues, LintIssue{Code: LintTypeMismatch, Severity: SeverityError, Message: err.Error()})
+	}
+	return issues
+}
+
+// lintEnv is the expression environment with typed placeholders for the
+// per-record variables. value depends on the input, so it is bound to an
+// interface{} that the type checker accepts in any position.
+func lintEnv(rule models.MappingRule) map[string]interface{} {
+	var value interface{}
+	return ExpressionEnv(ruleExpressionContext(&value, map[string]interface{}{}, map[string]interface{}{}, rule))
+}
+
+// identifierFinder collects the identifiers of an expression and which of
+// them are called as functions.
+type identifierFinder struct {
+	identifiers []*ast.IdentifierNode
+	callees     map[*ast.IdentifierNode]bool
+}
+
+func (f *identifierFinder) Visit(node *ast.Node) {
+	switch n := (*node).(type) {
+	case *ast.CallNode:
+		if callee, ok := n.Callee.(*ast.IdentifierNode); ok {
+			f.callees[callee] = true
+		}
+	case *ast.IdentifierNode:
+		f.identifiers = append(f.identifiers, n)
+	}
+}
+
+func envDefines(env map[string]interface{}, name string) bool {
+	if _, ok := env[name]; ok {
+		return true
+	}
+	for _, fn := range builtin.Builtins {
+		if fn.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(names map[string]bool) []string {
+	keys := make([]string, 0, len(names))
+	for name := range names {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// shadowingRule finds a later rule that always replaces the output of rule i:
+// it overwrites the same destination or an ancestor of it, and writes
+// whenever rule i does.
+func shadowingRule(rules []models.MappingRule, i int) (int, bool) {
+	rule := rules[i]
+	destination := rule.DestinationPath.Dotted()
+	for j := i + 1; j < len(rules); j++ {
+		later := rules[j]
+		if later.Strategy() != models.MergeOverwrite {
+			continue
+		}
+		ancestor := later.DestinationPath.Dotted()
+		if ancestor != destination && !strings.HasPrefix(destination, ancestor+".") {
+			continue
+		}
+		if later.Required || samePath(later.SourcePath, rule.SourcePath) {
+			return j, true
+		}
+	}
+	return 0, false
+}
+
+// blockingRule finds an earlier rule that always writes the destination of
+// keep-first rule i before it runs.
+func blockingRule(rules []models.MappingRule, i int) (int, bool) {
+	rule := rules[i]
+	if rule.Strategy() != models.MergeKeepFirst {
+		return 0, false
+	}
+	for j := 0; j < i; j++ {
+		earlier := rules[j]
+		if earlier.DestinationPath.Dotted() != rule.DestinationPath.Dotted() {
+			continue
+		}
+		if earlier.Required || samePath(earlier.SourcePath, rule.SourcePath) {
+			return j, true
+		}
+	}
+	return 0, false
+}
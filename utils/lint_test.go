@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"data_mapping/models"
+	"testing"
+)
+
+func TestLintExpression(t *testing.T) {
+	rule := models.MappingRule{
+		SourcePath:      models.JSONStringList{"amount"},
+		DestinationPath: models.JSONStringList{"total"},
+		TransformType:   "expression",
+	}
+
+	tests := []struct {
+		expression string
+		code       string
+	}{
+		{`value > 0 ? 3 : 1`, ""},
+		{`len(value) > 0 ? "Y" : "N"`, ""},
+		{`value + "x"`, ""},
+		{`value.nested`, ""},
+		{`toFloat(value) * 2`, ""},
+		{`toUpper(value)`, ""},
+		{`input.amount == value`, ""},
+		{`value >`, LintSyntaxError},
+		{`missing(value)`, LintUndefinedFunction},
+		{`value + other`, LintUndefinedVariable},
+		{`len(1)`, LintTypeMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			issues := LintExpression(tt.expression, rule)
+			if tt.code == "" {
+				if len(issues) > 0 {
+					t.Fatalf("got %+v, want no issues", issues)
+				}
+				return
+			}
+			if len(issues) != 1 || issues[0].Code != tt.code {
+				t.Fatalf("got %+v, want one %s issue", issues, tt.code)
+			}
+		})
+	}
+}
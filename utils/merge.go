@@ -0,0 +1,76 @@
+package utils
+
+import "data_mapping/models"
+
+// MergeNestedValue writes value at path like SetNestedValue, combining it
+// with a value already at path according to strategy:
+//
+//   - overwrite replaces the existing value.
+//   - keep-first leaves an existing value in place.
+//   - append-to-array collects values into an array; array values are
+//     appended element by element.
+//   - deep-merge merges objects key by key, with value winning on scalar
+//     conflicts, and overwrites anything that is not an object.
+func MergeNestedValue(data map[string]interface{}, path []string, value interface{}, strategy string) {
+	if strategy == "" || strategy == models.MergeOverwrite || len(path) == 0 {
+		SetNestedValue(data, path, value)
+		return
+	}
+	existing, exists := GetNestedValue(data, path)
+	if !exists {
+		if strategy == models.MergeAppendToArray {
+			value = appendValue(nil, value)
+		}
+		SetNestedValue(data, path, value)
+		return
+	}
+
+	switch strategy {
+	case models.MergeKeepFirst:
+		return
+	case models.MergeAppendToArray:
+		SetNestedValue(data, path, appendValue(existing, value))
+	case models.MergeDeepMerge:
+		SetNestedValue(data, path, deepMerge(existing, value))
+	default:
+		SetNestedValue(data, path, value)
+	}
+}
+
+func appendValue(existing, value interface{}) []interface{} {
+	var result []interface{}
+	switch current := existing.(type) {
+	case nil:
+	case []interface{}:
+		result = append(result, current...)
+	default:
+		result = append(result, current)
+	}
+	if values, ok := value.([]interface{}); ok {
+		return append(result, values...)
+	}
+	return append(result, value)
+}
+
+func deepMerge(existing, value interface{}) interface{} {
+	current, ok := existing.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	incoming, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	merged := make(map[string]interface{}, len(current)+len(incoming))
+	for k, v := range current {
+		merged[k] = v
+	}
+	for k, v := range incoming {
+		if prev, exists := merged[k]; exists {
+			merged[k] = deepMerge(prev, v)
+		} else {
+			merged[k] = v
+		}
+	}
+	return merged
+}
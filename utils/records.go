@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+const (
+	RecordFormatNDJSON    = "ndjson"
+	RecordFormatJSONArray = "json"
+)
+
+// MaxRecordSize bounds the size of a single NDJSON line or CSV row so that
+// memory use does not depend on the size of the whole input.
+const MaxRecordSize = 10 * 1024 * 1024
+
+// DetectRecordFormat peeks at the first non-whitespace byte of r to decide
+// whether the input is a JSON array or newline-delimited JSON.
+func DetectRecordFormat(r *bufio.Reader) (string, error) {
+	for {
+		b, err := r.Peek(1)
+		if err != nil {
+			return "", err
+		}
+		switch b[0] {
+		case ' ', '\t', '\r', '\n':
+			r.ReadByte()
+		case '[':
+			return RecordFormatJSONArray, nil
+		default:
+			return RecordFormatNDJSON, nil
+		}
+	}
+}
+
+// RecordFunc receives each decoded input record with its zero-based index.
+// Records that cannot be decoded are passed with a non-nil err so that callers
+// can report them and carry on. An error returned by a RecordFunc stops
+// decoding.
+type RecordFunc func(index int, record map[string]interface{}, err error) error
+
+// RecordDecoder produces input records by calling fn for each one.
+type RecordDecoder func(fn RecordFunc) error
+
+// DecodeRecords reads input records in the given format and calls fn for each one.
+func DecodeRecords(r io.Reader, format string, fn RecordFunc) error {
+	switch format {
+	case RecordFormatNDJSON:
+		return decodeNDJSON(r, fn)
+	case RecordFormatJSONArray:
+		return decodeJSONArray(r, fn)
+	default:
+		return fmt.Errorf("unsupported record format %q", format)
+	}
+}
+
+func decodeNDJSON(r io.Reader, fn RecordFunc) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), MaxRecordSize)
+	index := 0
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var value interface{}
+		var record map[string]interface{}
+		err := json.Unmarshal(line, &value)
+		if err == nil {
+			record, err = asRecord(value)
+		}
+		if err := fn(index, record, err); err != nil {
+			return err
+		}
+		index++
+	}
+	if err := scanner.Err(); err != nil {
+		if err == bufio.ErrTooLong {
+			return fmt.Errorf("record %d exceeds the maximum size of %d bytes", index, MaxRecordSize)
+		}
+		return err
+	}
+	return nil
+}
+
+func decodeJSONArray(r io.Reader, fn RecordFunc) error {
+	dec := json.NewDecoder(r)
+	t, err := dec.Token()
+	if err != nil || t != json.Delim('[') {
+		return fmt.Errorf("expected start of array: %v", err)
+	}
+	for index := 0; dec.More(); index++ {
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			return fmt.Errorf("record %d: %w", index, err)
+		}
+		record, err := asRecord(value)
+		if err := fn(index, record, err); err != nil {
+			return err
+		}
+	}
+	t, err = dec.Token()
+	if err != nil || t != json.Delim(']') {
+		return fmt.Errorf("expected end of array: %v", err)
+	}
+	return nil
+}
+
+// NewRecordDecoder returns a RecordDecoder for r in the given format.
+func NewRecordDecoder(r io.Reader, format string) RecordDecoder {
+	return func(fn RecordFunc) error {
+		return DecodeRecords(r, format, fn)
+	}
+}
+
+// asRecord converts a decoded JSON value into an input record. A record
+// wrapped as {"input_data": {...}}, the shape accepted by the transform
+// endpoint, is unwrapped.
+func asRecord(value interface{}) (map[string]interface{}, error) {
+	record, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("record must be a JSON object")
+	}
+	if len(record) == 1 {
+		if inner, ok := record["input_data"].(map[string]interface{}); ok {
+			return inner, nil
+		}
+	}
+	return record, nil
+}
@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"data_mapping/models"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// NonInvertibleRule explains why a rule was left out of an inverse mapping.
+// Rule is the index of the rule in the inverted slice.
+type NonInvertibleRule struct {
+	Rule            int    `json:"rule"`
+	RuleID          uint   `json:"rule_id,omitempty"`
+	DestinationPath string `json:"destination_path"`
+	Reason          string `json:"reason"`
+}
+
+// InvertRules builds rules that map a client's target format back to its
+// input shape. A rule is inverted when:
+//
+//   - it copies its value unchanged;
+//   - it uses a lookup table whose values are unique;
+//   - it changes case and its InverseLogic names the canonical case of the
+//     source data: "lower", "upper" or "capitalize";
+//   - it declares InverseLogic, an expression over the destination value, as
+//     any other transform or expression must.
+//
+// Rules that combine values with append-to-array or deep-merge, and rules
+// whose source path is written by an earlier inverted rule, are reported
+// instead.
+func InvertRules(rules []models.MappingRule) ([]models.MappingRule, []NonInvertibleRule) {
+	var inverse []models.MappingRule
+	skipped := []NonInvertibleRule{}
+	skip := func(i int, reason string) {
+		skipped = append(skipped, NonInvertibleRule{
+			Rule:            i,
+			RuleID:          rules[i].ID,
+			DestinationPath: rules[i].DestinationPath.Dotted(),
+			Reason:          reason,
+		})
+	}
+
+	written := make(map[string]int)
+	for i, rule := range rules {
+		strategy := rule.Strategy()
+		if strategy == models.MergeAppendToArray || strategy == models.MergeDeepMerge {
+			skip(i, fmt.Sprintf("values combined with %s cannot be split back apart", strategy))
+			continue
+		}
+		reversed := models.MappingRule{
+			ID:              rule.ID,
+			ClientID:        rule.ClientID,
+			SourcePath:      rule.DestinationPath,
+			DestinationPath: rule.SourcePath,
+			TransformType:   "copy",
+		}
+		switch {
+		case rule.InverseLogic != "":
+			reversed.TransformType = "expression"
+			reversed.TransformLogic = InverseExpression(rule)
+		case rule.TransformType == "lookup":
+			table, err := invertTable(rule.LookupTable)
+			if err != nil {
+				skip(i, err.Error())
+				continue
+			}
+			reversed.TransformType = "lookup"
+			reversed.LookupTable = table
+		case rule.TransformType == "copy" && rule.TransformLogic == "":
+		case rule.TransformLogic != "":
+			skip(i, "transform_logic has no declared inverse_logic")
+			continue
+		case caseTransforms[rule.TransformType]:
+			skip(i, fmt.Sprintf("the %s transform has no declared canonical case; set inverse_logic to \"lower\", \"upper\" or \"capitalize\"", rule.TransformType))
+			continue
+		default:
+			skip(i, fmt.Sprintf("the %s transform has no declared inverse_logic", rule.TransformType))
+			continue
+		}
+
+		if first, ok := written[rule.SourcePath.Dotted()]; ok {
+			skip(i, fmt.Sprintf("source path %q is already restored by rule %d", rule.SourcePath.Dotted(), first))
+			continue
+		}
+		written[rule.SourcePath.Dotted()] = i
+		inverse = append(inverse, reversed)
+	}
+	return inverse, skipped
+}
+
+var caseTransforms = map[string]bool{"toUpperCase": true, "toLowerCase": true, "capitalize": true}
+
+// canonicalCases maps the inverse_logic shortcuts of case transforms to the
+// expressions restoring that case.
+var canonicalCases = map[string]string{
+	"lower":      "toLower(value)",
+	"upper":      "toUpper(value)",
+	"capitalize": "capitalize(value)",
+}
+
+// InverseExpression returns the expression inverting rule: the expression
+// of a canonical case shortcut, or InverseLogic itself.
+func InverseExpression(rule models.MappingRule) string {
+	if caseTransforms[rule.TransformType] && rule.TransformLogic == "" {
+		if expression, ok := canonicalCases[rule.InverseLogic]; ok {
+			return expression
+		}
+	}
+	return rule.InverseLogic
+}
+
+func invertTable(table models.JSONStringMap) (models.JSONStringMap, error) {
+	keys := make([]string, 0, len(table))
+	for key := range table {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	inverse := make(models.JSONStringMap, len(table))
+	for _, key := range keys {
+		value := table[key]
+		if other, ok := inverse[value]; ok {
+			return nil, fmt.Errorf("lookup value %q is produced by both %q and %q", value, other, key)
+		}
+		inverse[value] = key
+	}
+	return inverse, nil
+}
+
+// ReverseTransform maps a record in the client's target format back to its
+// input shape using the invertible rules. Source paths that index into
+// arrays, such as applicants.0.name, are rebuilt as arrays.
+func ReverseTransform(input map[string]interface{}, rules []models.MappingRule) (map[string]interface{}, []NonInvertibleRule) {
+	inverse, skipped := InvertRules(rules)
+	output := ApplyRules(input, inverse)
+	for key, value := range output {
+		output[key] = indexedMapsToArrays(value)
+	}
+	return output, skipped
+}
+
+// indexedMapsToArrays replaces objects whose keys are all array indexes with
+// arrays. Missing indexes become null.
+func indexedMapsToArrays(value interface{}) interface{} {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	for key, child := range object {
+		object[key] = indexedMapsToArrays(child)
+	}
+
+	length := 0
+	for key := range object {
+		index, err := strconv.Atoi(key)
+		if err != nil || index < 0 || strconv.Itoa(index) != key {
+			return object
+		}
+		if index+1 > length {
+			length = index + 1
+		}
+	}
+	if length == 0 || length > 10000 {
+		return object
+	}
+	array := make([]interface{}, length)
+	for key, child := range object {
+		index, _ := strconv.Atoi(key)
+		array[index] = child
+	}
+	return array
+}
@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"data_mapping/models"
+	"reflect"
+	"testing"
+)
+
+func TestReverseTransformCanonicalCase(t *testing.T) {
+	rules := []models.MappingRule{
+		{SourcePath: models.JSONStringList{"status"}, DestinationPath: models.JSONStringList{"STATUS"}, TransformType: "toUpperCase", InverseLogic: "lower"},
+		{SourcePath: models.JSONStringList{"city"}, DestinationPath: models.JSONStringList{"CITY"}, TransformType: "toUpperCase", InverseLogic: "capitalize"},
+		{SourcePath: models.JSONStringList{"code"}, DestinationPath: models.JSONStringList{"code"}, TransformType: "toLowerCase"},
+	}
+
+	output, skipped := ReverseTransform(map[string]interface{}{"STATUS": "APPROVED", "CITY": "PUNE", "code": "ab"}, rules)
+	if want := map[string]interface{}{"status": "approved", "city": "Pune"}; !reflect.DeepEqual(output, want) {
+		t.Errorf("output = %v, want %v", output, want)
+	}
+	if len(skipped) != 1 || skipped[0].Rule != 2 {
+		t.Errorf("skipped = %+v, want the toLowerCase rule without a canonical case", skipped)
+	}
+	if issues := LintRules(rules); len(issues) != 0 {
+		t.Errorf("LintRules = %+v, want no issues for canonical case shortcuts", issues)
+	}
+}
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"data_mapping/models"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+)
+
+// RuleSetVersion returns a short fingerprint of the parts of rules that affect
+// transformation output. Two rule sets with the same version transform input
+// identically.
+func RuleSetVersion(rules []models.MappingRule) string {
+	type ruleFingerprint struct {
+		ID              uint              `json:"id"`
+		SourcePath      []string          `json:"s"`
+		DestinationPath []string          `json:"d"`
+		TransformType   string            `json:"t"`
+		TransformLogic  string            `json:"l"`
+		Required        bool              `json:"r"`
+		DefaultValue    string            `json:"v"`
+		MergeStrategy   string            `json:"m,omitempty"`
+		LookupTable     map[string]string `json:"k,omitempty"`
+	}
+
+	fingerprints := make([]ruleFingerprint, len(rules))
+	for i, rule := range rules {
+		fingerprints[i] = ruleFingerprint{
+			ID:              rule.ID,
+			SourcePath:      rule.SourcePath,
+			DestinationPath: rule.DestinationPath,
+			TransformType:   rule.TransformType,
+			TransformLogic:  rule.TransformLogic,
+			Required:        rule.Required,
+			DefaultValue:    rule.DefaultValue,
+			LookupTable:     rule.LookupTable,
+		}
+		if rule.Strategy() != models.MergeOverwrite {
+			fingerprints[i].MergeStrategy = rule.MergeStrategy
+		}
+	}
+	sort.SliceStable(fingerprints, func(i, j int) bool { return fingerprints[i].ID < fingerprints[j].ID })
+
+	data, _ := json.Marshal(fingerprints)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
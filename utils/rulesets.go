@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"data_mapping/models"
+	"fmt"
+)
+
+// RuleIssue lists every validation error found for one rule of a payload.
+type RuleIssue struct {
+	Index           int      `json:"index"`
+	DestinationPath string   `json:"destination_path,omitempty"`
+	Errors          []string `json:"errors"`
+}
+
+// RuleKey identifies a rule within a client's rule set by its destination
+// and source path. Everything else about a rule, its merge strategy included,
+// can be changed without changing its key.
+func RuleKey(rule models.MappingRule) string {
+	return rule.DestinationPath.Dotted() + " <- " + rule.SourcePath.Dotted()
+}
+
+// ValidateMappingRules validates every rule and reports all failures instead
+// of stopping at the first one. Two rules with the same RuleKey are reported
+// as well.
+func ValidateMappingRules(rules []models.MappingRule) []RuleIssue {
+	var issues []RuleIssue
+	seen := make(map[string]int)
+	for i, rule := range rules {
+		errs := MappingRuleErrors(rule)
+		key := RuleKey(rule)
+		if len(rule.DestinationPath) > 0 {
+			if first, ok := seen[key]; ok {
+				errs = append(errs, fmt.Sprintf("source path %q is already mapped to %q by rule %d", rule.SourcePath.Dotted(), rule.DestinationPath.Dotted(), first))
+			} else {
+				seen[key] = i
+			}
+		}
+		if len(errs) > 0 {
+			issues = append(issues, RuleIssue{Index: i, DestinationPath: rule.DestinationPath.Dotted(), Errors: errs})
+		}
+	}
+	return issues
+}
+
+// RuleUpdate pairs a stored rule with the values that replace it.
+type RuleUpdate struct {
+	Before models.MappingRule `json:"before"`
+	After  models.MappingRule `json:"after"`
+}
+
+// RulePlan describes how a client's stored rules change when a rule set is
+// applied.
+type RulePlan struct {
+	Add       []models.MappingRule `json:"add"`
+	Update    []RuleUpdate         `json:"update"`
+	Delete    []models.MappingRule `json:"delete"`
+	Unchanged int                  `json:"unchanged"`
+}
+
+// PlanMappingChanges matches incoming rules to existing ones by RuleKey.
+// Existing rules that are not matched are deleted only when replace is set.
+func PlanMappingChanges(existing, incoming []models.MappingRule, replace bool) RulePlan {
+	plan := RulePlan{
+		Add:    []models.MappingRule{},
+		Update: []RuleUpdate{},
+		Delete: []models.MappingRule{},
+	}
+	byKey := make(map[string]models.MappingRule, len(existing))
+	for _, rule := range existing {
+		byKey[RuleKey(rule)] = rule
+	}
+
+	matched := make(map[uint]bool)
+	for _, rule := range incoming {
+		current, ok := byKey[RuleKey(rule)]
+		if !ok {
+			plan.Add = append(plan.Add, rule)
+			continue
+		}
+		matched[current.ID] = true
+		if sameRule(current, rule) {
+			plan.Unchanged++
+			continue
+		}
+		updated := current
+		updated.TransformType = rule.TransformType
+		updated.TransformLogic = rule.TransformLogic
+		updated.Required = rule.Required
+		updated.DefaultValue = rule.DefaultValue
+		updated.LookupTable = rule.LookupTable
+		updated.InverseLogic = rule.InverseLogic
+		updated.MergeStrategy = rule.MergeStrategy
+		plan.Update = append(plan.Update, RuleUpdate{Before: current, After: updated})
+	}
+
+	if replace {
+		for _, rule := range existing {
+			if !matched[rule.ID] {
+				plan.Delete = append(plan.Delete, rule)
+			}
+		}
+	}
+	return plan
+}
+
+func sameRule(a, b models.MappingRule) bool {
+	return samePath(a.SourcePath, b.SourcePath) &&
+		a.TransformType == b.TransformType &&
+		a.TransformLogic == b.TransformLogic &&
+		a.Required == b.Required &&
+		a.DefaultValue == b.DefaultValue &&
+		a.InverseLogic == b.InverseLogic &&
+		sameTable(a.LookupTable, b.LookupTable) &&
+		a.Strategy() == b.Strategy()
+}
+
+func sameTable(a, b models.JSONStringMap) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if other, ok := b[k]; !ok || other != v {
+			return false
+		}
+	}
+	return true
+}
+
+// PlannedRules returns the rule set that results from applying plan to
+// existing, in transformation order, and marks which rules the plan adds or
+// changes.
+func PlannedRules(existing []models.MappingRule, plan RulePlan) ([]models.MappingRule, []bool) {
+	updated := make(map[uint]models.MappingRule, len(plan.Update))
+	for _, update := range plan.Update {
+		updated[update.After.ID] = update.After
+	}
+	deleted := make(map[uint]bool, len(plan.Delete))
+	for _, rule := range plan.Delete {
+		deleted[rule.ID] = true
+	}
+
+	var rules []models.MappingRule
+	var changed []bool
+	for _, rule := range existing {
+		if deleted[rule.ID] {
+			continue
+		}
+		after, ok := updated[rule.ID]
+		if ok {
+			rule = after
+		}
+		rules = append(rules, rule)
+		changed = append(changed, ok)
+	}
+	for _, rule := range plan.Add {
+		rules = append(rules, rule)
+		changed = append(changed, true)
+	}
+	return rules, changed
+}
+
+func samePath(a, b models.JSONStringList) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
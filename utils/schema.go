@@ -0,0 +1,432 @@
+package utils
+
+import (
+	"data_mapping/models"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// SchemaWildcard stands for any array index in a schema path.
+const SchemaWildcard = "*"
+
+const maxSchemaExamples = 3
+
+// SampleRecords converts decoded JSON samples into records. Samples wrapped
+// as {"input_data": {...}} are unwrapped.
+func SampleRecords(samples []interface{}) ([]map[string]interface{}, error) {
+	records := make([]map[string]interface{}, 0, len(samples))
+	for i, sample := range samples {
+		record, err := asRecord(sample)
+		if err != nil {
+			return nil, fmt.Errorf("sample %d: %w", i, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// InferSchema builds a path catalog from sample records, sorted by path.
+func InferSchema(samples []map[string]interface{}) []models.SchemaField {
+	fields := make(map[string]*models.SchemaField)
+	for _, sample := range samples {
+		seen := make(map[string]bool)
+		for key, value := range sample {
+			inferValue(fields, seen, []string{key}, value, false)
+		}
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	catalog := make([]models.SchemaField, 0, len(keys))
+	for _, key := range keys {
+		field := fields[key]
+		sort.Strings(field.Types)
+		field.Optional = field.Samples < len(samples)
+		catalog = append(catalog, *field)
+	}
+	return catalog
+}
+
+func inferValue(fields map[string]*models.SchemaField, seen map[string]bool, path []string, value interface{}, repeated bool) {
+	key := strings.Join(path, "\x00")
+	field, ok := fields[key]
+	if !ok {
+		field = &models.SchemaField{
+			Path:        append(models.JSONStringList(nil), path...),
+			Cardinality: models.CardinalityOne,
+		}
+		fields[key] = field
+	}
+	if repeated {
+		field.Cardinality = models.CardinalityMany
+	}
+	if !seen[key] {
+		seen[key] = true
+		field.Samples++
+	}
+
+	kind := JSONType(value)
+	if !containsString(field.Types, kind) {
+		field.Types = append(field.Types, kind)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for childKey, child := range v {
+			inferValue(fields, seen, append(path, childKey), child, repeated)
+		}
+	case []interface{}:
+		if len(v) > field.MaxItems {
+			field.MaxItems = len(v)
+		}
+		for _, item := range v {
+			inferValue(fields, seen, append(path, SchemaWildcard), item, true)
+		}
+	case nil:
+	default:
+		if len(field.Examples) < maxSchemaExamples && !containsValue(field.Examples, v) {
+			field.Examples = append(field.Examples, v)
+		}
+	}
+}
+
+// JSONType names the JSON type of a decoded value, telling integers apart
+// from other numbers.
+func JSONType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case int, int64, int32:
+		return "integer"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsValue(list []interface{}, value interface{}) bool {
+	for _, item := range list {
+		if reflect.DeepEqual(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// MappingSuggestion proposes a rule for one target field. Score is between 0
+// and 1; Reasons explains it.
+type MappingSuggestion struct {
+	DestinationPath string                  `json:"destination_path"`
+	Rule            models.MappingRuleSpec  `json:"rule"`
+	Score           float64                 `json:"score"`
+	Reasons         []string                `json:"reasons"`
+	Alternatives    []SuggestionAlternative `json:"alternatives,omitempty"`
+}
+
+// SuggestionAlternative is a lower scoring source for the same target.
+type SuggestionAlternative struct {
+	SourcePath string  `json:"source_path"`
+	Score      float64 `json:"score"`
+}
+
+// MinSuggestionScore is the score below which a source is not suggested.
+const MinSuggestionScore = 0.35
+
+type suggestionCandidate struct {
+	source    models.SchemaField
+	score     float64
+	reasons   []string
+	transform string
+	logic     string
+}
+
+// SuggestMappings proposes a rule for each scalar target field by comparing
+// it with every scalar source field on name similarity, type compatibility
+// and shared example values. Targets without a good enough source are
+// returned as unmatched.
+func SuggestMappings(sources, targets []models.SchemaField) ([]MappingSuggestion, []string) {
+	suggestions := []MappingSuggestion{}
+	unmatched := []string{}
+	for _, target := range targets {
+		if !isScalarField(target) {
+			continue
+		}
+		var candidates []suggestionCandidate
+		for _, source := range sources {
+			if !isScalarField(source) {
+				continue
+			}
+			if candidate := scoreCandidate(source, target); candidate.score >= MinSuggestionScore {
+				candidates = append(candidates, candidate)
+			}
+		}
+		destination := dottedSchemaPath(target.Path)
+		if len(candidates) == 0 {
+			unmatched = append(unmatched, destination)
+			continue
+		}
+		sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].score > candidates[j].score })
+
+		best := candidates[0]
+		suggestion := MappingSuggestion{
+			DestinationPath: destination,
+			Rule: models.MappingRuleSpec{
+				SourcePath:      concreteSchemaPath(best.source.Path),
+				DestinationPath: concreteSchemaPath(target.Path),
+				TransformType:   best.transform,
+				TransformLogic:  best.logic,
+			},
+			Score:   best.score,
+			Reasons: best.reasons,
+		}
+		for _, alternative := range candidates[1:] {
+			if len(suggestion.Alternatives) == 2 {
+				break
+			}
+			suggestion.Alternatives = append(suggestion.Alternatives, SuggestionAlternative{
+				SourcePath: dottedSchemaPath(alternative.source.Path),
+				Score:      alternative.score,
+			})
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	return suggestions, unmatched
+}
+
+func scoreCandidate(source, target models.SchemaField) suggestionCandidate {
+	candidate := suggestionCandidate{source: source, transform: "copy"}
+
+	name := nameSimilarity(source.Path, target.Path)
+	if name > 0 {
+		candidate.reasons = append(candidate.reasons, fmt.Sprintf("name similarity %.2f", name))
+	}
+
+	typeScore := 0.0
+	switch {
+	case len(target.Types) == 0:
+		// Target fields may be listed without types.
+		typeScore = 0.5
+	case typesOverlap(source.Types, target.Types):
+		typeScore = 1
+		candidate.reasons = append(candidate.reasons, "same type")
+	case containsString(target.Types, "string"):
+		typeScore = 0.5
+		candidate.transform, candidate.logic = "expression", "toString(value)"
+		candidate.reasons = append(candidate.reasons, "converted to string")
+	}
+
+	valueScore := 0.0
+	switch matchExamples(source.Examples, target.Examples) {
+	case exampleMatchExact:
+		valueScore = 1
+		candidate.reasons = append(candidate.reasons, "matching example values")
+	case exampleMatchUpper:
+		valueScore = 0.9
+		candidate.transform, candidate.logic = "expression", "toUpper(value)"
+		candidate.reasons = append(candidate.reasons, "matching example values in upper case")
+	case exampleMatchLower:
+		valueScore = 0.9
+		candidate.transform, candidate.logic = "expression", "toLower(value)"
+		candidate.reasons = append(candidate.reasons, "matching example values in lower case")
+	}
+
+	candidate.score = math.Round((0.5*name+0.2*typeScore+0.3*valueScore)*100) / 100
+	return candidate
+}
+
+func isScalarField(field models.SchemaField) bool {
+	for _, kind := range field.Types {
+		if kind == "object" || kind == "array" {
+			return false
+		}
+	}
+	return true
+}
+
+func typesOverlap(a, b []string) bool {
+	for _, kind := range a {
+		if kind == "null" {
+			continue
+		}
+		if containsString(b, kind) {
+			return true
+		}
+		// Integers are numbers too.
+		if (kind == "integer" && containsString(b, "number")) || (kind == "number" && containsString(b, "integer")) {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	exampleMatchNone = iota
+	exampleMatchExact
+	exampleMatchUpper
+	exampleMatchLower
+)
+
+// matchExamples compares example values, ignoring values such as 0, 1,
+// booleans and very short strings that match almost anything by chance.
+func matchExamples(source, target []interface{}) int {
+	match := exampleMatchNone
+	for _, s := range source {
+		if trivialValue(s) {
+			continue
+		}
+		for _, t := range target {
+			sv, tv := fmt.Sprint(s), fmt.Sprint(t)
+			switch {
+			case sv == tv:
+				return exampleMatchExact
+			case strings.ToUpper(sv) == tv:
+				match = exampleMatchUpper
+			case strings.ToLower(sv) == tv:
+				match = exampleMatchLower
+			}
+		}
+	}
+	return match
+}
+
+func trivialValue(value interface{}) bool {
+	switch v := value.(type) {
+	case bool, nil:
+		return true
+	case float64:
+		return v == 0 || v == 1
+	case string:
+		return len(strings.TrimSpace(v)) < 3
+	}
+	return false
+}
+
+// nameSimilarity compares the last segment of two paths, helped by the
+// segment before it, as word sets.
+func nameSimilarity(source, target []string) float64 {
+	sourceWords := pathWords(source)
+	targetWords := pathWords(target)
+	leaf := jaccard(pathWords(lastSegments(source, 1)), pathWords(lastSegments(target, 1)))
+	withParent := jaccard(sourceWords, targetWords)
+	return math.Max(leaf, withParent)
+}
+
+// lastSegments returns the last n named segments of path, skipping array
+// wildcards and indexes.
+func lastSegments(path []string, n int) []string {
+	var segments []string
+	for i := len(path) - 1; i >= 0 && len(segments) < n; i-- {
+		if path[i] == SchemaWildcard || isIndex(path[i]) {
+			continue
+		}
+		segments = append([]string{path[i]}, segments...)
+	}
+	return segments
+}
+
+func pathWords(path []string) map[string]bool {
+	words := make(map[string]bool)
+	for _, segment := range lastSegments(path, 2) {
+		for _, word := range splitWords(segment) {
+			words[word] = true
+		}
+	}
+	return words
+}
+
+// splitWords splits camelCase, snake_case, kebab-case and spaced names into
+// lower case words.
+func splitWords(name string) []string {
+	var words []string
+	var current []rune
+	flush := func() {
+		if len(current) > 0 {
+			words = append(words, strings.ToLower(string(current)))
+			current = nil
+		}
+	}
+	runes := []rune(name)
+	for i, r := range runes {
+		switch {
+		case r == '_' || r == '-' || r == ' ' || r == '.':
+			flush()
+		case r >= 'A' && r <= 'Z' && i > 0 && runes[i-1] >= 'a' && runes[i-1] <= 'z':
+			flush()
+			current = append(current, r)
+		default:
+			current = append(current, r)
+		}
+	}
+	flush()
+	return words
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for word := range a {
+		if b[word] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+func isIndex(segment string) bool {
+	if segment == "" {
+		return false
+	}
+	for _, r := range segment {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func dottedSchemaPath(path []string) string {
+	return strings.Join(path, ".")
+}
+
+// concreteSchemaPath turns a schema path into a rule path by reading the
+// first element of every array.
+func concreteSchemaPath(path []string) models.JSONStringList {
+	concrete := make(models.JSONStringList, len(path))
+	for i, segment := range path {
+		if segment == SchemaWildcard {
+			segment = "0"
+		}
+		concrete[i] = segment
+	}
+	return concrete
+}
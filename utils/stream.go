@@ -0,0 +1,320 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"data_mapping/models"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+)
+
+// RecordWriter writes transformed records in an output format. Close finishes
+// the output; a non-nil err is a failure that stopped the stream part way
+// through and is reported in the output where the format allows it.
+type RecordWriter interface {
+	WriteRecord(index int, output map[string]interface{}, missingRequired []string) error
+	WriteError(index int, err error) error
+	Close(err error) error
+}
+
+// TransformRecords applies rules to every record produced by decode and
+// writes each result to w as soon as it is ready.
+func TransformRecords(decode RecordDecoder, w RecordWriter, rules []models.MappingRule) error {
+	return TransformRecordsWithOptions(decode, w, rules, TransformOptions{})
+}
+
+// TransformRecordsWithOptions is TransformRecords with a client's settings. In
+// strict mode a record a rule fails on is written as an error.
+func TransformRecordsWithOptions(decode RecordDecoder, w RecordWriter, rules []models.MappingRule, opts TransformOptions) error {
+	err := decode(func(index int, record map[string]interface{}, err error) error {
+		if err != nil {
+			return w.WriteError(index, err)
+		}
+		output, err := ApplyRulesWithOptions(record, rules, opts)
+		if err != nil {
+			return w.WriteError(index, err)
+		}
+		return w.WriteRecord(index, output, MissingRequiredFields(output, rules))
+	})
+	if closeErr := w.Close(err); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// StreamTransformNDJSON transforms newline-delimited JSON records one at a
+// time. Each input line yields one output line, either
+// {"index":n,"data":{...}} or {"index":n,"error":"..."}, and output is
+// flushed as it is produced. If reading the input fails part way through, a
+// final {"error":"..."} line is written and the error is returned.
+func StreamTransformNDJSON(r io.Reader, w io.Writer, rules []models.MappingRule) error {
+	return TransformRecords(NewRecordDecoder(r, RecordFormatNDJSON), NewNDJSONRecordWriter(w), rules)
+}
+
+// StreamTransformJSONWithRules streams and transforms large JSONs using the same rules as the standard transform logic.
+//
+// A top-level array is treated as a list of records: each element is decoded
+// on its own, transformed with the full rule set and written to an output
+// array as a {"index","data"} element, like a line of NDJSON output. A top-level object keeps the original behaviour of transforming each
+// top-level value. Once output has started, a failure is reported as a
+// trailing error entry and the output is closed so that it stays valid JSON;
+// callers can tell whether anything was written from their ResponseWriter.
+// In strict mode a failing rule fails a top-level object but only the element
+// of a top-level array.
+func StreamTransformJSONWithRules(r io.Reader, w io.Writer, rules []models.MappingRule, opts TransformOptions) error {
+	return StreamTransformJSONHashed(r, w, rules, opts, nil)
+}
+
+// StreamTransformJSONHashed is StreamTransformJSONWithRules that also adds
+// every input record, or top-level value of an object, to hasher unless it
+// is nil.
+func StreamTransformJSONHashed(r io.Reader, w io.Writer, rules []models.MappingRule, opts TransformOptions, hasher *InputHasher) error {
+	br := bufio.NewReader(r)
+	format, err := DetectRecordFormat(br)
+	if err != nil {
+		return fmt.Errorf("expected start of object or array: %w", err)
+	}
+	if format == RecordFormatJSONArray {
+		return TransformRecordsWithOptions(hasher.Decoder(NewRecordDecoder(br, RecordFormatJSONArray)), NewJSONArrayRecordWriter(w), rules, opts)
+	}
+
+	dec := json.NewDecoder(br)
+	t, err := dec.Token()
+	if err != nil || t != json.Delim('{') {
+		return fmt.Errorf("expected start of object or array, got %v", t)
+	}
+	return streamObject(dec, newStreamWriter(w), rules, opts, hasher)
+}
+
+// InputHasher hashes transform input in one canonical form: the JSON
+// encoding of each record, with object keys sorted, followed by a newline.
+// The same records hash the same whether they are sent in one request or
+// streamed in any format. Records that fail to decode are left out. A nil
+// InputHasher hashes nothing.
+type InputHasher struct {
+	h hash.Hash
+}
+
+func NewInputHasher() *InputHasher {
+	return &InputHasher{h: sha256.New()}
+}
+
+// Add hashes one record.
+func (ih *InputHasher) Add(record interface{}) error {
+	if ih == nil {
+		return nil
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	ih.h.Write(append(data, '\n'))
+	return nil
+}
+
+// Decoder returns a decoder that hashes the records decode produces.
+func (ih *InputHasher) Decoder(decode RecordDecoder) RecordDecoder {
+	if ih == nil {
+		return decode
+	}
+	return func(fn RecordFunc) error {
+		return decode(func(index int, record map[string]interface{}, err error) error {
+			if err == nil {
+				ih.Add(record)
+			}
+			return fn(index, record, err)
+		})
+	}
+}
+
+// Sum returns the hex encoded SHA-256 of the records added so far.
+func (ih *InputHasher) Sum() string {
+	return hex.EncodeToString(ih.h.Sum(nil))
+}
+
+func streamObject(dec *json.Decoder, sw *streamWriter, rules []models.MappingRule, opts TransformOptions, hasher *InputHasher) error {
+	sw.write("{")
+	fail := func(err error) error {
+		sw.member("error", err.Error())
+		sw.write("}")
+		return err
+	}
+
+	for dec.More() {
+		keyToken, err := dec.Token()
+		if err != nil {
+			return fail(err)
+		}
+		key := keyToken.(string)
+		var value interface{}
+		if err := dec.Decode(&value); err != nil {
+			return fail(err)
+		}
+		hasher.Add(value)
+		// Use ApplyRules for each top-level object
+		var transformed interface{}
+		if vMap, ok := value.(map[string]interface{}); ok {
+			transformed, err = ApplyRulesWithOptions(vMap, rules, opts)
+			if err != nil {
+				return fail(err)
+			}
+		} else {
+			transformed = value
+		}
+		if err := sw.member(key, transformed); err != nil {
+			return fail(err)
+		}
+		if sw.err != nil {
+			return sw.err
+		}
+	}
+	if t, err := dec.Token(); err != nil || t != json.Delim('}') {
+		return fail(fmt.Errorf("expected end of object: %v", err))
+	}
+	sw.write("}")
+	return sw.err
+}
+
+type ndjsonRecordWriter struct {
+	enc     *json.Encoder
+	flusher http.Flusher
+}
+
+// NewNDJSONRecordWriter writes one {"index","data"} or {"index","error"}
+// object per line, flushing after each.
+func NewNDJSONRecordWriter(w io.Writer) RecordWriter {
+	flusher, _ := w.(http.Flusher)
+	return &ndjsonRecordWriter{enc: json.NewEncoder(w), flusher: flusher}
+}
+
+func (nw *ndjsonRecordWriter) WriteRecord(index int, output map[string]interface{}, missingRequired []string) error {
+	line := map[string]interface{}{"index": index, "data": output}
+	if len(missingRequired) > 0 {
+		line["warnings"] = map[string]interface{}{"missingRequiredFields": missingRequired}
+	}
+	return nw.encode(line)
+}
+
+func (nw *ndjsonRecordWriter) WriteError(index int, err error) error {
+	return nw.encode(map[string]interface{}{"index": index, "error": err.Error()})
+}
+
+func (nw *ndjsonRecordWriter) Close(err error) error {
+	if err != nil {
+		return nw.encode(map[string]interface{}{"error": err.Error()})
+	}
+	return nil
+}
+
+func (nw *ndjsonRecordWriter) encode(line map[string]interface{}) error {
+	if err := nw.enc.Encode(line); err != nil {
+		return err
+	}
+	if nw.flusher != nil {
+		nw.flusher.Flush()
+	}
+	return nil
+}
+
+type jsonArrayRecordWriter struct {
+	sw      *streamWriter
+	started bool
+}
+
+// NewJSONArrayRecordWriter writes the objects NewNDJSONRecordWriter writes
+// as lines as the elements of a JSON array instead.
+func NewJSONArrayRecordWriter(w io.Writer) RecordWriter {
+	return &jsonArrayRecordWriter{sw: newStreamWriter(w)}
+}
+
+func (aw *jsonArrayRecordWriter) start() {
+	if !aw.started {
+		aw.sw.write("[")
+		aw.started = true
+	}
+}
+
+func (aw *jsonArrayRecordWriter) WriteRecord(index int, output map[string]interface{}, missingRequired []string) error {
+	aw.start()
+	element := map[string]interface{}{"index": index, "data": output}
+	if len(missingRequired) > 0 {
+		element["warnings"] = map[string]interface{}{"missingRequiredFields": missingRequired}
+	}
+	if err := aw.sw.element(element); err != nil {
+		return aw.WriteError(index, err)
+	}
+	return aw.sw.err
+}
+
+func (aw *jsonArrayRecordWriter) WriteError(index int, err error) error {
+	aw.start()
+	aw.sw.element(map[string]interface{}{"index": index, "error": err.Error()})
+	return aw.sw.err
+}
+
+func (aw *jsonArrayRecordWriter) Close(err error) error {
+	aw.start()
+	if err != nil {
+		aw.sw.element(map[string]interface{}{"error": err.Error()})
+	}
+	aw.sw.write("]")
+	return aw.sw.err
+}
+
+// streamWriter writes the elements of a JSON array or members of an object,
+// flushing after each one and remembering the first write error.
+type streamWriter struct {
+	w       io.Writer
+	flusher http.Flusher
+	first   bool
+	err     error
+}
+
+func newStreamWriter(w io.Writer) *streamWriter {
+	flusher, _ := w.(http.Flusher)
+	return &streamWriter{w: w, flusher: flusher, first: true}
+}
+
+func (sw *streamWriter) write(s string) {
+	if sw.err == nil {
+		_, sw.err = io.WriteString(sw.w, s)
+	}
+	if sw.flusher != nil && sw.err == nil {
+		sw.flusher.Flush()
+	}
+}
+
+func (sw *streamWriter) separator() {
+	if !sw.first {
+		sw.write(",")
+	}
+	sw.first = false
+}
+
+// element writes value as the next array element. It returns an error only
+// when value cannot be encoded; write errors are kept in sw.err.
+func (sw *streamWriter) element(value interface{}) error {
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	sw.separator()
+	sw.write(string(valueBytes))
+	return nil
+}
+
+// member writes the next object member, with the same error handling as element.
+func (sw *streamWriter) member(key string, value interface{}) error {
+	keyBytes, _ := json.Marshal(key)
+	valueBytes, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	sw.separator()
+	sw.write(string(keyBytes) + ":" + string(valueBytes))
+	return nil
+}
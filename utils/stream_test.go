@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestJSONArrayMatchesNDJSON(t *testing.T) {
+	write := func(w RecordWriter) {
+		t.Helper()
+		if err := w.WriteRecord(0, map[string]interface{}{"customer": "Asha"}, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.WriteRecord(1, map[string]interface{}{}, []string{"customer"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.WriteError(2, errors.New("record must be a JSON object")); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(errors.New("unexpected EOF")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var array, ndjson bytes.Buffer
+	write(NewJSONArrayRecordWriter(&array))
+	write(NewNDJSONRecordWriter(&ndjson))
+
+	var elements []interface{}
+	if err := json.Unmarshal(array.Bytes(), &elements); err != nil {
+		t.Fatalf("output %q is not a JSON array: %v", array.String(), err)
+	}
+	var lines []interface{}
+	for _, line := range strings.Split(strings.TrimSpace(ndjson.String()), "\n") {
+		var value interface{}
+		if err := json.Unmarshal([]byte(line), &value); err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, value)
+	}
+	if !reflect.DeepEqual(elements, lines) {
+		t.Errorf("array elements = %v, want the NDJSON lines %v", elements, lines)
+	}
+	if len(elements) != 4 || elements[1].(map[string]interface{})["warnings"] == nil {
+		t.Errorf("elements = %v, want warnings on the record missing a required field", elements)
+	}
+}
@@ -64,14 +64,80 @@ func SetNestedValue(data map[string]interface{}, path []string, value interface{
 	}
 }
 
+// TransformOptions are the client settings rules are applied with. The zero
+// value applies rules with the defaults.
+type TransformOptions struct {
+	// Location is the zone dates without a zone are read in and that now
+	// and today use; nil means UTC for parsing and local time for now.
+	Location    *time.Location
+	DateLayouts []string
+	NullPolicy  string
+	// Strict makes a failing rule fail the record.
+	Strict bool
+}
+
 func Transform(input map[string]interface{}, rules []models.MappingRule) (map[string]interface{}, error) {
-	return ApplyRules(input, rules), nil
+	return TransformWithOptions(input, rules, TransformOptions{})
+}
+
+// TransformWithOptions is Transform with a client's settings.
+func TransformWithOptions(input map[string]interface{}, rules []models.MappingRule, opts TransformOptions) (map[string]interface{}, error) {
+	return ApplyRulesWithOptions(input, rules, opts)
+}
+
+// MissingRequiredFields returns the destination paths of required rules that
+// are absent from output, without duplicates.
+func MissingRequiredFields(output map[string]interface{}, rules []models.MappingRule) []string {
+	var missingFields []string
+	for _, rule := range rules {
+		if rule.Required {
+			// Check if the output has applicants array
+			if applicants, ok := output["applicants"].([]interface{}); ok {
+				// Check the first applicant (assuming all applicants have the same structure)
+				if len(applicants) > 0 {
+					if applicant, ok := applicants[0].(map[string]interface{}); ok {
+						if _, exists := GetNestedValue(applicant, rule.DestinationPath); !exists {
+							path := strings.Join(rule.DestinationPath, ".")
+							missingFields = append(missingFields, path)
+						}
+					}
+				}
+			} else {
+				// Single object output
+				if _, exists := GetNestedValue(output, rule.DestinationPath); !exists {
+					path := strings.Join(rule.DestinationPath, ".")
+					missingFields = append(missingFields, path)
+				}
+			}
+		}
+	}
+
+	// Remove duplicate entries from missingFields
+	seen := make(map[string]bool)
+	unique := make([]string, 0, len(missingFields))
+	for _, field := range missingFields {
+		if !seen[field] {
+			seen[field] = true
+			unique = append(unique, field)
+		}
+	}
+	return unique
 }
 
 func ApplyRules(input map[string]interface{}, rules []models.MappingRule) map[string]interface{} {
+	output, _ := ApplyRulesWithOptions(input, rules, TransformOptions{})
+	return output
+}
+
+// ApplyRulesWithOptions applies rules with a client's settings. It only fails
+// in strict mode, when a rule fails.
+func ApplyRulesWithOptions(input map[string]interface{}, rules []models.MappingRule, opts TransformOptions) (map[string]interface{}, error) {
 	output := make(map[string]interface{})
 	for _, rule := range rules {
 		val, exists := GetNestedValue(input, rule.SourcePath)
+		if exists && val == nil && opts.NullPolicy == models.NullPolicyOmit {
+			exists = false
+		}
 		var transformedVal interface{}
 		var err error
 
@@ -95,7 +161,7 @@ func ApplyRules(input map[string]interface{}, rules []models.MappingRule) map[st
 						defaultVal = val
 					}
 
-					SetNestedValue(output, rule.DestinationPath, defaultVal)
+					MergeNestedValue(output, rule.DestinationPath, defaultVal, rule.Strategy())
 				} else {
 					// No default value provided, but field is required
 					// Set an empty value based on destination field name hints
@@ -105,12 +171,12 @@ func ApplyRules(input map[string]interface{}, rules []models.MappingRule) map[st
 					if strings.Contains(strings.ToLower(destField), "count") ||
 						strings.Contains(strings.ToLower(destField), "number") ||
 						strings.Contains(strings.ToLower(destField), "id") {
-						SetNestedValue(output, rule.DestinationPath, 0)
+						MergeNestedValue(output, rule.DestinationPath, 0, rule.Strategy())
 					} else if strings.Contains(strings.ToLower(destField), "is") ||
 						strings.Contains(strings.ToLower(destField), "has") {
-						SetNestedValue(output, rule.DestinationPath, false)
+						MergeNestedValue(output, rule.DestinationPath, false, rule.Strategy())
 					} else {
-						SetNestedValue(output, rule.DestinationPath, "")
+						MergeNestedValue(output, rule.DestinationPath, "", rule.Strategy())
 					}
 				}
 			}
@@ -120,14 +186,7 @@ func ApplyRules(input map[string]interface{}, rules []models.MappingRule) map[st
 		// Normal transformation for existing fields
 		if rule.TransformType == "expression" || rule.TransformLogic != "" {
 			// Create a rich context with various helper functions and input data
-			params := map[string]interface{}{
-				"value":      val,
-				"input":      input,
-				"output":     output,
-				"sourcePath": rule.SourcePath,
-				"destPath":   rule.DestinationPath,
-				"rule":       rule,
-			}
+			params := ruleExpressionContext(val, input, output, rule)
 
 			// Use transform logic if available, otherwise create a simple expression that just returns the value
 			exprToEval := rule.TransformLogic
@@ -135,7 +194,7 @@ func ApplyRules(input map[string]interface{}, rules []models.MappingRule) map[st
 				exprToEval = "value"
 			}
 
-			transformedVal, err = EvaluateExpression(exprToEval, params)
+			transformedVal, err = expr.Eval(exprToEval, expressionEnv(params, opts))
 
 			// If result is a JSON string, try to parse it
 			if err == nil {
@@ -149,18 +208,69 @@ func ApplyRules(input map[string]interface{}, rules []models.MappingRule) map[st
 				}
 			}
 		} else {
-			transformedVal, err = ApplyTransform(val, rule.TransformType)
+			transformedVal, err = applyRuleTransform(val, rule)
 		}
-		if err == nil {
-			SetNestedValue(output, rule.DestinationPath, transformedVal)
+		if err != nil {
+			if opts.Strict {
+				return nil, fmt.Errorf("rule %s -> %s: %w", strings.Join(rule.SourcePath, "."), strings.Join(rule.DestinationPath, "."), err)
+			}
+			continue
 		}
+		MergeNestedValue(output, rule.DestinationPath, transformedVal, rule.Strategy())
 	}
-	return output
+	return output, nil
+}
+
+// ruleExpressionContext returns the variables a rule's TransformLogic can
+// reference.
+func ruleExpressionContext(value interface{}, input, output map[string]interface{}, rule models.MappingRule) map[string]interface{} {
+	return map[string]interface{}{
+		"value":      value,
+		"input":      input,
+		"output":     output,
+		"sourcePath": rule.SourcePath,
+		"destPath":   rule.DestinationPath,
+		"rule":       rule,
+	}
+}
+
+func applyRuleTransform(value interface{}, rule models.MappingRule) (interface{}, error) {
+	if rule.TransformType == "lookup" {
+		return LookupValue(value, rule.LookupTable)
+	}
+	return ApplyTransform(value, rule.TransformType)
 }
+
 func ApplyTransform(value interface{}, transformType string) (interface{}, error) {
 	return value, nil
 }
 
+// LookupValue maps value through table. Values are looked up by their string
+// form; a value missing from the table is an error.
+func LookupValue(value interface{}, table map[string]string) (interface{}, error) {
+	key := FormatScalar(value)
+	mapped, ok := table[key]
+	if !ok {
+		return nil, fmt.Errorf("no lookup entry for %q", key)
+	}
+	return mapped, nil
+}
+
+// FormatScalar returns the string form of a decoded JSON value, writing
+// numbers without exponents.
+func FormatScalar(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
+
 // StreamTransformJSON streams and transforms large client JSONs in real-time.
 func StreamTransformJSON(r io.Reader, w io.Writer, transform func(key string, value interface{}) (string, interface{})) error {
 	dec := json.NewDecoder(r)
@@ -200,54 +310,30 @@ func StreamTransformJSON(r io.Reader, w io.Writer, transform func(key string, va
 	return nil
 }
 
-// StreamTransformJSONWithRules streams and transforms large JSONs using the same rules as the standard transform logic.
-func StreamTransformJSONWithRules(r io.Reader, w io.Writer, rules []models.MappingRule) error {
-	dec := json.NewDecoder(r)
-	t, err := dec.Token()
-	if err != nil || t != json.Delim('{') {
-		return fmt.Errorf("expected start of object: %v", err)
-	}
-	w.Write([]byte("{"))
-	first := true
-	for dec.More() {
-		keyToken, err := dec.Token()
-		if err != nil {
-			return err
-		}
-		key := keyToken.(string)
-		var value interface{}
-		if err := dec.Decode(&value); err != nil {
-			return err
-		}
-		// Use ApplyRules for each top-level object
-		var transformed interface{}
-		if vMap, ok := value.(map[string]interface{}); ok {
-			transformed = ApplyRules(vMap, rules)
-		} else {
-			transformed = value
-		}
-		if !first {
-			w.Write([]byte(","))
-		}
-		first = false
-		keyBytes, _ := json.Marshal(key)
-		valueBytes, _ := json.Marshal(transformed)
-		w.Write(keyBytes)
-		w.Write([]byte(":"))
-		w.Write(valueBytes)
-	}
-	t, err = dec.Token()
-	if err != nil || t != json.Delim('}') {
-		return fmt.Errorf("expected end of object: %v", err)
-	}
-	w.Write([]byte("}"))
-	return nil
-}
-
 // expressionFuncs contains reusable functions for expression evaluation
 
 // EvaluateExpression evaluates an expression with rich context and helper functions
 func EvaluateExpression(expression string, context map[string]interface{}) (interface{}, error) {
+	// Evaluate the expression with the enriched context
+	return expr.Eval(expression, ExpressionEnv(context))
+}
+
+// ExpressionEnv builds the environment expressions are evaluated in: the
+// helper functions below plus every variable in context.
+func ExpressionEnv(context map[string]interface{}) map[string]interface{} {
+	return expressionEnv(context, TransformOptions{})
+}
+
+func expressionEnv(context map[string]interface{}, opts TransformOptions) map[string]interface{} {
+	location := opts.Location
+	if location == nil {
+		location = time.UTC
+	}
+	now := time.Now()
+	if opts.Location != nil {
+		now = now.In(opts.Location)
+	}
+
 	// Create a set of functions for the expression environment
 	env := map[string]interface{}{
 		// Pass through all existing context
@@ -257,16 +343,16 @@ func EvaluateExpression(expression string, context map[string]interface{}) (inte
 
 		// Date/time functions
 		"formatDate": func(dateStr string, format string) string {
-			formats := []string{
+			formats := append(append([]string{}, opts.DateLayouts...),
 				"02-January-2006",
 				"02-Jan-2006",
 				"02/January/2006",
 				"02-January-06",
 				"2006-01-02",
 				time.RFC3339,
-			}
+			)
 			for _, f := range formats {
-				if t, err := time.Parse(f, dateStr); err == nil {
+				if t, err := time.ParseInLocation(f, dateStr, location); err == nil {
 					return t.Format(format)
 				}
 			}
@@ -395,9 +481,9 @@ func EvaluateExpression(expression string, context map[string]interface{}) (inte
 		},
 
 		// Current time
-		"now":     time.Now(),
-		"today":   time.Now().Format("2006-01-02"),
-		"isoDate": time.Now().Format(time.RFC3339),
+		"now":     now,
+		"today":   now.Format("2006-01-02"),
+		"isoDate": now.Format(time.RFC3339),
 	}
 
 	// Add any other context variables
@@ -407,6 +493,5 @@ func EvaluateExpression(expression string, context map[string]interface{}) (inte
 		}
 	}
 
-	// Evaluate the expression with the enriched context
-	return expr.Eval(expression, env)
+	return env
 }
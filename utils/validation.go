@@ -25,14 +25,22 @@ func ValidateStruct(s interface{}) error {
 
 // ValidateMappingRule validates only the essential fields of a mapping rule
 func ValidateMappingRule(rule interface{}) error {
+	if errors := MappingRuleErrors(rule); len(errors) > 0 {
+		return fmt.Errorf("validation failed: %s", strings.Join(errors, ", "))
+	}
+	return nil
+}
+
+// MappingRuleErrors returns every reason rule fails validation.
+func MappingRuleErrors(rule interface{}) []string {
 	// Create a custom validator that skips nested structs
 	v := validator.New()
 
 	// Configure validator to skip dive validation on nested structs
 	v.SetTagName("validate")
 
+	var errors []string
 	if err := v.Struct(rule); err != nil {
-		var errors []string
 		for _, err := range err.(validator.ValidationErrors) {
 			// Skip validation errors for nested structs (like Client.Name)
 			fieldName := err.Field()
@@ -41,24 +49,30 @@ func ValidateMappingRule(rule interface{}) error {
 			}
 			errors = append(errors, fmt.Sprintf("Field '%s' failed validation: %s", fieldName, err.Tag()))
 		}
-		if len(errors) > 0 {
-			return fmt.Errorf("validation failed: %s", strings.Join(errors, ", "))
-		}
 	}
 
 	// Additional validation for expression type mappings
 	if r, ok := rule.(models.MappingRule); ok {
 		if r.TransformType == "expression" && r.TransformLogic == "" {
-			return fmt.Errorf("validation failed: TransformLogic is required when TransformType is 'expression'")
+			errors = append(errors, "TransformLogic is required when TransformType is 'expression'")
 		}
 
 		// If TransformLogic is provided, try to validate it's a valid expression
 		if r.TransformLogic != "" {
 			if _, err := expr.Compile(r.TransformLogic); err != nil {
-				return fmt.Errorf("validation failed: Invalid expression syntax in TransformLogic: %s", err.Error())
+				errors = append(errors, fmt.Sprintf("Invalid expression syntax in TransformLogic: %s", err.Error()))
+			}
+		}
+		if r.InverseLogic != "" {
+			if _, err := expr.Compile(r.InverseLogic); err != nil {
+				errors = append(errors, fmt.Sprintf("Invalid expression syntax in InverseLogic: %s", err.Error()))
 			}
 		}
+
+		if r.TransformType == "lookup" && len(r.LookupTable) == 0 {
+			errors = append(errors, "LookupTable is required when TransformType is 'lookup'")
+		}
 	}
 
-	return nil
+	return errors
 }
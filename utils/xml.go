@@ -0,0 +1,384 @@
+package utils
+
+import (
+	"data_mapping/models"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// XML elements are mapped to the generic tree used by GetNestedValue:
+// attributes become "@name" keys, repeated child elements become arrays,
+// elements with only text become strings and mixed text is kept under "#text".
+const xmlTextKey = "#text"
+
+// DefaultXMLLayout is used for clients without an XML layout.
+func DefaultXMLLayout() models.XMLLayout {
+	return models.XMLLayout{RootElement: "root", RecordElement: "record"}
+}
+
+// ParseXMLDocument decodes a whole XML document into a record. The root
+// element's attributes and children become the record's fields.
+func ParseXMLDocument(r io.Reader) (map[string]interface{}, error) {
+	dec := xml.NewDecoder(r)
+	start, err := nextStartElement(dec)
+	if err != nil {
+		return nil, err
+	}
+	value, err := decodeXMLElement(dec, start)
+	if err != nil {
+		return nil, err
+	}
+	if record, ok := value.(map[string]interface{}); ok {
+		return record, nil
+	}
+	return map[string]interface{}{xmlTextKey: value}, nil
+}
+
+// NewXMLDecoder returns a RecordDecoder that treats each child element of the
+// document root as one record, decoding them one at a time.
+func NewXMLDecoder(r io.Reader) RecordDecoder {
+	return func(fn RecordFunc) error {
+		dec := xml.NewDecoder(r)
+		if _, err := nextStartElement(dec); err != nil {
+			return err
+		}
+		for index := 0; ; {
+			tok, err := dec.Token()
+			if err != nil {
+				if err == io.EOF {
+					return fmt.Errorf("unexpected end of XML document")
+				}
+				return err
+			}
+			switch t := tok.(type) {
+			case xml.StartElement:
+				value, err := decodeXMLElement(dec, t)
+				if err != nil {
+					return fmt.Errorf("record %d: %v", index, err)
+				}
+				record, ok := value.(map[string]interface{})
+				if !ok {
+					record = map[string]interface{}{xmlTextKey: value}
+				}
+				if err := fn(index, record, nil); err != nil {
+					return err
+				}
+				index++
+			case xml.EndElement:
+				return nil
+			}
+		}
+	}
+}
+
+func nextStartElement(dec *xml.Decoder) (xml.StartElement, error) {
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			if err == io.EOF {
+				return xml.StartElement{}, fmt.Errorf("XML document has no root element")
+			}
+			return xml.StartElement{}, err
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			return start, nil
+		}
+	}
+}
+
+func decodeXMLElement(dec *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	node := make(map[string]interface{})
+	for _, attr := range start.Attr {
+		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+			continue
+		}
+		node["@"+attr.Name.Local] = attr.Value
+	}
+
+	var text strings.Builder
+	hasChildren := false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			hasChildren = true
+			child, err := decodeXMLElement(dec, t)
+			if err != nil {
+				return nil, err
+			}
+			name := t.Name.Local
+			switch existing := node[name].(type) {
+			case nil:
+				node[name] = child
+			case []interface{}:
+				node[name] = append(existing, child)
+			default:
+				node[name] = []interface{}{existing, child}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			content := strings.TrimSpace(text.String())
+			if !hasChildren && len(node) == 0 {
+				return content, nil
+			}
+			if content != "" {
+				node[xmlTextKey] = content
+			}
+			return node, nil
+		}
+	}
+}
+
+// xmlSerializer writes transformed records as XML elements according to a
+// layout, ordering child elements by the order of the rules that produce them.
+type xmlSerializer struct {
+	enc        *xml.Encoder
+	attributes map[string]bool
+	rank       map[string]int
+}
+
+func newXMLSerializer(w io.Writer, rules []models.MappingRule, layout models.XMLLayout) *xmlSerializer {
+	s := &xmlSerializer{
+		enc:        xml.NewEncoder(w),
+		attributes: make(map[string]bool),
+		rank:       make(map[string]int),
+	}
+	for _, path := range layout.Attributes {
+		s.attributes[path] = true
+	}
+	for i, rule := range rules {
+		for k := 1; k <= len(rule.DestinationPath); k++ {
+			prefix := strings.Join(rule.DestinationPath[:k], ".")
+			if _, exists := s.rank[prefix]; !exists {
+				s.rank[prefix] = i
+			}
+		}
+	}
+	return s
+}
+
+// startRoot writes the XML declaration and opens the root element with the
+// layout's namespace declarations.
+func (s *xmlSerializer) startRoot(layout models.XMLLayout, attrs []xml.Attr) error {
+	if err := s.enc.EncodeToken(xml.ProcInst{Target: "xml", Inst: []byte(`version="1.0" encoding="UTF-8"`)}); err != nil {
+		return err
+	}
+	root := xml.StartElement{Name: xml.Name{Local: layout.RootElement}}
+	prefixes := make([]string, 0, len(layout.Namespaces))
+	for prefix := range layout.Namespaces {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	for _, prefix := range prefixes {
+		name := "xmlns"
+		if prefix != "" {
+			name = "xmlns:" + prefix
+		}
+		root.Attr = append(root.Attr, xml.Attr{Name: xml.Name{Local: name}, Value: layout.Namespaces[prefix]})
+	}
+	root.Attr = append(root.Attr, attrs...)
+	return s.enc.EncodeToken(root)
+}
+
+func (s *xmlSerializer) end(name string) error {
+	return s.enc.EncodeToken(xml.EndElement{Name: xml.Name{Local: name}})
+}
+
+// writeElement writes value as an element called name. Arrays become repeated
+// elements and objects are split into attributes, text and child elements.
+func (s *xmlSerializer) writeElement(name, path string, value interface{}) error {
+	if items, ok := value.([]interface{}); ok {
+		for _, item := range items {
+			if err := s.writeElement(name, path, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	fields, isMap := value.(map[string]interface{})
+	if !isMap {
+		if err := s.enc.EncodeToken(start); err != nil {
+			return err
+		}
+		if err := s.enc.EncodeToken(xml.CharData(FormatCell(value))); err != nil {
+			return err
+		}
+		return s.end(name)
+	}
+
+	children, attrs, text := s.split(path, fields)
+	start.Attr = attrs
+	if err := s.enc.EncodeToken(start); err != nil {
+		return err
+	}
+	if text != "" {
+		if err := s.enc.EncodeToken(xml.CharData(text)); err != nil {
+			return err
+		}
+	}
+	for _, key := range children {
+		if err := s.writeElement(key, joinXMLPath(path, key), fields[key]); err != nil {
+			return err
+		}
+	}
+	return s.end(name)
+}
+
+// split separates the members of fields into ordered child element names,
+// attributes and text content.
+func (s *xmlSerializer) split(path string, fields map[string]interface{}) ([]string, []xml.Attr, string) {
+	var children []string
+	var attrs []xml.Attr
+	var text string
+	for key, value := range fields {
+		switch {
+		case key == xmlTextKey:
+			text = FormatCell(value)
+		case strings.HasPrefix(key, "@"):
+			attrs = append(attrs, xml.Attr{Name: xml.Name{Local: key[1:]}, Value: FormatCell(value)})
+		case s.attributes[joinXMLPath(path, key)]:
+			attrs = append(attrs, xml.Attr{Name: xml.Name{Local: key}, Value: FormatCell(value)})
+		default:
+			children = append(children, key)
+		}
+	}
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].Name.Local < attrs[j].Name.Local })
+	sort.Slice(children, func(i, j int) bool {
+		ri, iok := s.rank[joinXMLPath(path, children[i])]
+		rj, jok := s.rank[joinXMLPath(path, children[j])]
+		if iok != jok {
+			return iok
+		}
+		if ri != rj {
+			return ri < rj
+		}
+		return children[i] < children[j]
+	})
+	return children, attrs, text
+}
+
+func joinXMLPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// WriteXMLDocument writes a single transformed record as an XML document
+// whose root element is the layout's root.
+func WriteXMLDocument(w io.Writer, output map[string]interface{}, rules []models.MappingRule, layout models.XMLLayout) error {
+	s := newXMLSerializer(w, rules, layout)
+	children, attrs, text := s.split("", output)
+	if err := s.startRoot(layout, attrs); err != nil {
+		return err
+	}
+	if text != "" {
+		if err := s.enc.EncodeToken(xml.CharData(text)); err != nil {
+			return err
+		}
+	}
+	for _, key := range children {
+		if err := s.writeElement(key, key, output[key]); err != nil {
+			return err
+		}
+	}
+	if err := s.end(layout.RootElement); err != nil {
+		return err
+	}
+	return s.enc.Flush()
+}
+
+type xmlRecordWriter struct {
+	s       *xmlSerializer
+	layout  models.XMLLayout
+	flusher http.Flusher
+	started bool
+}
+
+// NewXMLRecordWriter writes each transformed record as a RecordElement inside
+// the layout's root element, flushing after every record. Failed records are
+// written as <error index="n"> elements.
+func NewXMLRecordWriter(w io.Writer, rules []models.MappingRule, layout models.XMLLayout) RecordWriter {
+	if layout.RecordElement == "" {
+		layout.RecordElement = DefaultXMLLayout().RecordElement
+	}
+	flusher, _ := w.(http.Flusher)
+	return &xmlRecordWriter{s: newXMLSerializer(w, rules, layout), layout: layout, flusher: flusher}
+}
+
+func (xw *xmlRecordWriter) start() error {
+	if xw.started {
+		return nil
+	}
+	xw.started = true
+	return xw.s.startRoot(xw.layout, nil)
+}
+
+func (xw *xmlRecordWriter) WriteRecord(index int, output map[string]interface{}, missingRequired []string) error {
+	if err := xw.start(); err != nil {
+		return err
+	}
+	if err := xw.s.writeElement(xw.layout.RecordElement, "", output); err != nil {
+		return err
+	}
+	return xw.flush()
+}
+
+func (xw *xmlRecordWriter) WriteError(index int, err error) error {
+	if startErr := xw.start(); startErr != nil {
+		return startErr
+	}
+	if err := xw.writeError(fmt.Sprint(index), err); err != nil {
+		return err
+	}
+	return xw.flush()
+}
+
+func (xw *xmlRecordWriter) Close(err error) error {
+	if startErr := xw.start(); startErr != nil {
+		return startErr
+	}
+	if err != nil {
+		if writeErr := xw.writeError("", err); writeErr != nil {
+			return writeErr
+		}
+	}
+	if err := xw.s.end(xw.layout.RootElement); err != nil {
+		return err
+	}
+	return xw.flush()
+}
+
+func (xw *xmlRecordWriter) writeError(index string, err error) error {
+	start := xml.StartElement{Name: xml.Name{Local: "error"}}
+	if index != "" {
+		start.Attr = []xml.Attr{{Name: xml.Name{Local: "index"}, Value: index}}
+	}
+	if err := xw.s.enc.EncodeToken(start); err != nil {
+		return err
+	}
+	if err := xw.s.enc.EncodeToken(xml.CharData(err.Error())); err != nil {
+		return err
+	}
+	return xw.s.end("error")
+}
+
+func (xw *xmlRecordWriter) flush() error {
+	if err := xw.s.enc.Flush(); err != nil {
+		return err
+	}
+	if xw.flusher != nil {
+		xw.flusher.Flush()
+	}
+	return nil
+}